@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	network "github.com/filecoin-project/filecoin-network-sim/network"
+	randfile "github.com/filecoin-project/filecoin-network-sim/randfile"
+	scenario "github.com/filecoin-project/filecoin-network-sim/scenario"
+)
+
+// API is a JSON control plane for a running Instance, served under /api/:
+//
+//	GET    /api/nodes[?type=Miner]          list nodes
+//	POST   /api/nodes                       add nodes: {"type": "Miner", "count": 2}
+//	DELETE /api/nodes/<id>                  remove a node
+//	POST   /api/actions                     run an action, see apiAction
+//	GET    /api/randomizer                  randomizer state
+//	POST   /api/randomizer/pause            pause random actions, mining and churn
+//	POST   /api/randomizer/resume
+//	POST   /api/randomizer/step             advance the paused clock one epoch
+//	GET    /api/args                        randomizer Args
+//	PATCH  /api/args                        change Args: {"BlockTime": "1s", "ForkProbability": 0.5}
+//	GET    /api/report[?format=md]          report of the run so far, as JSON or markdown
+//
+// Errors are {"error": "..."}, with a 4xx or 5xx status.
+type API struct {
+	I    *Instance
+	mux  *http.ServeMux
+	rand *rand.Rand // for deal files
+}
+
+func NewAPI(i *Instance) *API {
+	a := &API{I: i, mux: http.NewServeMux(), rand: network.NewRand(time.Now().UnixNano())}
+	a.mux.HandleFunc("/api/nodes", a.handleNodes)
+	a.mux.HandleFunc("/api/nodes/", a.handleNode)
+	a.mux.HandleFunc("/api/actions", a.handleActions)
+	a.mux.HandleFunc("/api/randomizer", a.handleRandomizer)
+	a.mux.HandleFunc("/api/randomizer/", a.handleRandomizer)
+	a.mux.HandleFunc("/api/args", a.handleArgs)
+	a.mux.HandleFunc("/api/report", a.handleReport)
+	return a
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	a.mux.ServeHTTP(w, req)
+}
+
+type apiNode struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	WalletAddr string `json:"walletAddr"`
+	MinerAddr  string `json:"minerAddr,omitempty"`
+	SwarmAddr  string `json:"swarmAddr"`
+	CmdAddr    string `json:"cmdAddr"`
+	RepoDir    string `json:"repoDir"`
+	State      string `json:"state"`
+}
+
+func toAPINode(nd *network.Node) apiNode {
+	return apiNode{
+		ID:         nd.ID,
+		Type:       string(nd.Type),
+		WalletAddr: nd.WalletAddr,
+		MinerAddr:  nd.GetMinerIdentity(),
+		SwarmAddr:  nd.GetSwarmAddr(),
+		CmdAddr:    nd.CmdAddr(),
+		RepoDir:    nd.RepoDir(),
+		State:      string(nd.State()),
+	}
+}
+
+func (a *API) handleNodes(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		t := network.AnyNodeType
+		if q := req.URL.Query().Get("type"); q != "" {
+			var err error
+			if t, err = network.ParseNodeType(q); err != nil {
+				writeErr(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		nodes := []apiNode{}
+		for _, nd := range a.I.N.GetNodesOfType(t) {
+			nodes = append(nodes, toAPINode(nd))
+		}
+		writeJSON(w, http.StatusOK, nodes)
+
+	case http.MethodPost:
+		var body struct {
+			Type  string `json:"type"`
+			Count int    `json:"count"`
+		}
+		if err := readJSON(req, &body); err != nil {
+			writeErr(w, http.StatusBadRequest, err)
+			return
+		}
+		t, err := network.ParseNodeType(body.Type)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.Count == 0 {
+			body.Count = 1
+		}
+		if body.Count < 0 {
+			writeErr(w, http.StatusBadRequest, fmt.Errorf("count must be positive"))
+			return
+		}
+
+		nodes := []apiNode{}
+		for i := 0; i < body.Count; i++ {
+			nd, err := a.I.N.AddNode(t)
+			if err != nil {
+				writeErr(w, http.StatusInternalServerError, err)
+				return
+			}
+			nodes = append(nodes, toAPINode(nd))
+		}
+		writeJSON(w, http.StatusCreated, nodes)
+
+	default:
+		writeErr(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", req.Method))
+	}
+}
+
+func (a *API) handleNode(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/api/nodes/")
+	nd := a.I.N.GetNodeByID(id)
+	if nd == nil {
+		writeErr(w, http.StatusNotFound, fmt.Errorf("no node %q", id))
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, toAPINode(nd))
+
+	case http.MethodDelete:
+		if err := a.I.N.RemoveNode(id); err != nil {
+			writeErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toAPINode(nd))
+
+	default:
+		writeErr(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", req.Method))
+	}
+}
+
+// apiAction is an action to run, between nodes given by id. It uses the
+// scenario action names, and the same fields as a scenario step.
+type apiAction struct {
+	Action string `json:"action"`
+
+	Node   string `json:"node,omitempty"`   // mine, ask, bid
+	From   string `json:"from,omitempty"`   // payment
+	To     string `json:"to,omitempty"`     // payment
+	Client string `json:"client,omitempty"` // deal, retrieve
+	Miner  string `json:"miner,omitempty"`  // deal (optional)
+
+	Size   int    `json:"size,omitempty"`
+	Price  int    `json:"price,omitempty"`
+	Amount int    `json:"amount,omitempty"`
+	File   string `json:"file,omitempty"` // deal (optional)
+	Deal   *int   `json:"deal,omitempty"` // retrieve. default: the latest deal
+}
+
+func (a *API) handleActions(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeErr(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", req.Method))
+		return
+	}
+
+	var act apiAction
+	if err := readJSON(req, &act); err != nil {
+		writeErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := a.doAction(req.Context(), act); err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(badInput); ok {
+			status = http.StatusBadRequest
+		}
+		writeErr(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, act)
+}
+
+// badInput is an error in an action itself, rather than in running it.
+type badInput struct{ error }
+
+// doAction runs act. Its errors are badInput if act is bad, e.g. names
+// an unknown node; others come from the network.
+func (a *API) doAction(ctx context.Context, act apiAction) error {
+	n := a.I.N
+	switch act.Action {
+	case scenario.ActionMine:
+		nd, err := a.node(act.Node)
+		if err != nil {
+			return err
+		}
+		return n.MineOnce(ctx, nd)
+
+	case scenario.ActionAsk:
+		nd, err := a.node(act.Node)
+		if err != nil {
+			return err
+		}
+		return n.Ask(ctx, nd, act.Size, act.Price)
+
+	case scenario.ActionBid:
+		nd, err := a.node(act.Node)
+		if err != nil {
+			return err
+		}
+		return n.Bid(ctx, nd, act.Size, act.Price)
+
+	case scenario.ActionPayment:
+		from, err := a.node(act.From)
+		if err != nil {
+			return err
+		}
+		to, err := a.node(act.To)
+		if err != nil {
+			return err
+		}
+		return n.Payment(ctx, from, to, act.Amount)
+
+	case scenario.ActionDeal:
+		client, err := a.node(act.Client)
+		if err != nil {
+			return err
+		}
+
+		var miner *network.Node
+		if act.Miner != "" {
+			if miner, err = a.node(act.Miner); err != nil {
+				return err
+			}
+		}
+
+		ask, bid, err := n.FindDeal(ctx, client, miner)
+		if err != nil {
+			return err
+		}
+
+		fp := act.File
+		if fp == "" {
+			fp, err = randfile.RandomFile(a.rand, a.I.R.Args().TestfilesDir, client.RepoDir())
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = n.ProposeDeal(ctx, client, ask, bid, fp)
+		return err
+
+	case scenario.ActionRetrieve:
+		client, err := a.node(act.Client)
+		if err != nil {
+			return err
+		}
+
+		deals := n.Deals()
+		i := len(deals) - 1
+		if act.Deal != nil {
+			i = *act.Deal
+		}
+		if i < 0 || i >= len(deals) {
+			return badInput{fmt.Errorf("no deal %d (have %d)", i, len(deals))}
+		}
+		return n.Retrieve(ctx, client, deals[i])
+
+	default:
+		return badInput{fmt.Errorf("unknown action: %q", act.Action)}
+	}
+}
+
+func (a *API) node(id string) (*network.Node, error) {
+	nd := a.I.N.GetNodeByID(id)
+	if nd == nil {
+		return nil, badInput{fmt.Errorf("no node %q", id)}
+	}
+	return nd, nil
+}
+
+func (a *API) handleRandomizer(w http.ResponseWriter, req *http.Request) {
+	r := a.I.R
+	switch {
+	case req.URL.Path == "/api/randomizer" && req.Method == http.MethodGet:
+	case req.URL.Path == "/api/randomizer/pause" && req.Method == http.MethodPost:
+		r.Pause()
+	case req.URL.Path == "/api/randomizer/resume" && req.Method == http.MethodPost:
+		r.Resume()
+	case req.URL.Path == "/api/randomizer/step" && req.Method == http.MethodPost:
+		r.Step()
+	default:
+		writeErr(w, http.StatusNotFound, fmt.Errorf("not found: %s %s", req.Method, req.URL.Path))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"paused":  r.Paused(),
+		"steps":   r.Clock.Steps(),
+		"actions": r.Actions().String(),
+	})
+}
+
+func (a *API) handleArgs(w http.ResponseWriter, req *http.Request) {
+	r := a.I.R
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err)
+			return
+		}
+		args, err := patchArgs(r.Args(), body)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := r.SetArgs(args); err != nil {
+			writeErr(w, http.StatusBadRequest, err)
+			return
+		}
+	default:
+		writeErr(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", req.Method))
+		return
+	}
+
+	m, err := argsToJSON(r.Args())
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+func (a *API) handleReport(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeErr(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", req.Method))
+		return
+	}
+
+	r := a.I.Report.Report()
+	switch f := req.URL.Query().Get("format"); f {
+	case "", "json":
+		writeJSON(w, http.StatusOK, r)
+	case "md", "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		r.WriteMarkdown(w)
+	default:
+		writeErr(w, http.StatusBadRequest, fmt.Errorf("unknown format: %q", f))
+	}
+}
+
+// durationFields are the names of the time.Duration fields of
+// network.Args, which the API writes as strings like "3s".
+func durationFields() []string {
+	var names []string
+	t := reflect.TypeOf(network.Args{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type == reflect.TypeOf(time.Duration(0)) {
+			names = append(names, t.Field(i).Name)
+		}
+	}
+	return names
+}
+
+func argsToJSON(args network.Args) (map[string]interface{}, error) {
+	buf, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := decodeNumbers(buf, &m); err != nil {
+		return nil, err
+	}
+	for _, name := range durationFields() {
+		ns, err := m[name].(json.Number).Int64()
+		if err != nil {
+			return nil, err
+		}
+		m[name] = time.Duration(ns).String()
+	}
+	return m, nil
+}
+
+// patchArgs applies the fields set in the JSON object patch to args. It
+// rejects fields args does not have.
+func patchArgs(args network.Args, patch []byte) (network.Args, error) {
+	var m map[string]interface{}
+	if err := decodeNumbers(patch, &m); err != nil {
+		return args, err
+	}
+	for _, name := range durationFields() {
+		if s, ok := m[name].(string); ok {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return args, fmt.Errorf("%s: %s", name, err)
+			}
+			m[name] = int64(d)
+		}
+	}
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return args, err
+	}
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.DisallowUnknownFields()
+	err = d.Decode(&args)
+	return args, err
+}
+
+// decodeNumbers decodes json, keeping numbers exact (e.g. int64 seeds).
+func decodeNumbers(buf []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+func readJSON(req *http.Request, v interface{}) error {
+	d := json.NewDecoder(req.Body)
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeErr(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	report "github.com/filecoin-project/filecoin-network-sim/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func apiCall(t *testing.T, method, url, body string, out interface{}) int {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	if out != nil {
+		require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+	}
+	return res.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	args := argDefaults
+	args.Backend = "fake"
+
+	i, err := SetupInstance(args)
+	require.NoError(t, err)
+	defer i.N.ShutdownAll()
+	go io.Copy(ioutil.Discard, i.L)
+
+	s := httptest.NewServer(NewAPI(i))
+	defer s.Close()
+
+	// nodes
+	var nodes []apiNode
+	require.Equal(t, 201, apiCall(t, "POST", s.URL+"/api/nodes", `{"type": "Miner"}`, &nodes))
+	require.Len(t, nodes, 1)
+	miner := nodes[0]
+	require.Equal(t, 201, apiCall(t, "POST", s.URL+"/api/nodes", `{"type": "Client", "count": 2}`, &nodes))
+	require.Len(t, nodes, 2)
+	client, other := nodes[0], nodes[1]
+
+	require.Equal(t, 200, apiCall(t, "GET", s.URL+"/api/nodes", "", &nodes))
+	assert.Len(t, nodes, 3)
+	require.Equal(t, 200, apiCall(t, "GET", s.URL+"/api/nodes?type=Miner", "", &nodes))
+	assert.Equal(t, []apiNode{miner}, nodes)
+
+	var e map[string]string
+	assert.Equal(t, 400, apiCall(t, "POST", s.URL+"/api/nodes", `{"type": "Bird"}`, &e))
+	assert.NotEmpty(t, e["error"])
+
+	// actions
+	ok := func(body string) {
+		var act apiAction
+		assert.Equal(t, 200, apiCall(t, "POST", s.URL+"/api/actions", body, &act), body)
+	}
+	ok(`{"action": "mine", "node": "` + miner.ID + `"}`)
+	ok(`{"action": "ask", "node": "` + miner.ID + `", "size": 1000, "price": 5}`)
+	ok(`{"action": "bid", "node": "` + client.ID + `", "size": 10, "price": 10}`)
+	ok(`{"action": "deal", "client": "` + client.ID + `", "miner": "` + miner.ID + `"}`)
+	ok(`{"action": "retrieve", "client": "` + other.ID + `"}`)
+	ok(`{"action": "payment", "from": "` + miner.ID + `", "to": "` + client.ID + `", "amount": 10}`)
+
+	assert.Equal(t, 400, apiCall(t, "POST", s.URL+"/api/actions", `{"action": "fly"}`, &e))
+	assert.Equal(t, 400, apiCall(t, "POST", s.URL+"/api/actions", `{"action": "mine", "node": "nope"}`, &e))
+	assert.Equal(t, 400, apiCall(t, "POST", s.URL+"/api/actions", `{"action": "retrieve", "client": "`+other.ID+`", "deal": 9}`, &e))
+	// the network failing is not the request's fault.
+	assert.Equal(t, 500, apiCall(t, "POST", s.URL+"/api/actions", `{"action": "payment", "from": "`+miner.ID+`", "to": "`+client.ID+`", "amount": 1000000000}`, &e))
+
+	// randomizer and args
+	var st map[string]interface{}
+	require.Equal(t, 200, apiCall(t, "POST", s.URL+"/api/randomizer/pause", "", &st))
+	assert.Equal(t, true, st["paused"])
+	assert.True(t, i.R.Paused())
+	require.Equal(t, 200, apiCall(t, "POST", s.URL+"/api/randomizer/step", "", &st))
+	assert.Equal(t, float64(1), st["steps"])
+	require.Equal(t, 200, apiCall(t, "POST", s.URL+"/api/randomizer/resume", "", &st))
+	assert.Equal(t, false, st["paused"])
+
+	var a map[string]interface{}
+	require.Equal(t, 200, apiCall(t, "GET", s.URL+"/api/args", "", &a))
+	assert.Equal(t, "3s", a["BlockTime"])
+
+	patch := `{"BlockTime": "1s", "ForkProbability": 0.5, "Actions": {"Weights": {"Deal": 5}}}`
+	require.Equal(t, 200, apiCall(t, "PATCH", s.URL+"/api/args", patch, &a))
+	assert.Equal(t, "1s", a["BlockTime"])
+	assert.Equal(t, time.Second, i.R.Args().BlockTime)
+	assert.Equal(t, 0.5, i.R.Args().ForkProbability)
+	assert.Equal(t, 5, i.R.Args().Actions.Weights.Deal)
+	assert.Equal(t, 1, i.R.Args().Actions.Weights.Bid)
+	assert.Equal(t, args.NetArgs.JoinTime, i.R.Args().JoinTime)
+
+	assert.Equal(t, 400, apiCall(t, "PATCH", s.URL+"/api/args", `{"BlockTime": "soon"}`, &e))
+	assert.Equal(t, 400, apiCall(t, "PATCH", s.URL+"/api/args", `{"ForkProbability": 2}`, &e))
+	assert.Equal(t, 400, apiCall(t, "PATCH", s.URL+"/api/args", `{"BlockTyme": "2s"}`, &e))
+	assert.Equal(t, 400, apiCall(t, "PATCH", s.URL+"/api/args", `{"Actions": {"Wieghts": {"Deal": 1}}}`, &e))
+	assert.Equal(t, time.Second, i.R.Args().BlockTime)
+	assert.Equal(t, 0.5, i.R.Args().ForkProbability)
+
+	// report
+	var r report.Report
+	require.Eventually(t, func() bool {
+		require.Equal(t, 200, apiCall(t, "GET", s.URL+"/api/report", "", &r))
+		return r.Payments.Count == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, r.Market.Asks)
+	assert.Equal(t, 1, r.Market.Deals)
+	assert.Len(t, r.Nodes, 3)
+	assert.NotZero(t, r.Chain.Blocks)
+
+	res, err := http.Get(s.URL + "/api/report?format=md")
+	require.NoError(t, err)
+	md, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Contains(t, string(md), "# Sim report")
+	assert.Equal(t, 400, apiCall(t, "GET", s.URL+"/api/report?format=pdf", "", &e))
+
+	// remove
+	require.Equal(t, 200, apiCall(t, "DELETE", s.URL+"/api/nodes/"+other.ID, "", nil))
+	assert.Equal(t, 404, apiCall(t, "DELETE", s.URL+"/api/nodes/"+other.ID, "", &e))
+	assert.Equal(t, 2, i.N.Size())
+}
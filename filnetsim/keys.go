@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	network "github.com/filecoin-project/filecoin-network-sim/network"
+)
+
+const keysHelp = `keys (then enter): p pause, r resume, s step one epoch, ? help`
+
+// readKeys drives the randomizer's clock from lines typed into in, until
+// in ends.
+func readKeys(in io.Reader, out io.Writer, r *network.Randomizer) {
+	s := bufio.NewScanner(in)
+	for s.Scan() {
+		switch strings.TrimSpace(s.Text()) {
+		case "p":
+			r.Pause()
+			fmt.Fprintln(out, "[paused]")
+		case "r":
+			r.Resume()
+			fmt.Fprintln(out, "[resumed]")
+		case "s":
+			r.Step()
+			fmt.Fprintf(out, "[step %d]\n", r.Clock.Steps())
+		case "":
+		default:
+			fmt.Fprintln(out, keysHelp)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	network "github.com/filecoin-project/filecoin-network-sim/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadKeys(t *testing.T) {
+	r := network.NewRandomizer(nil, network.Args{})
+	out := bytes.NewBuffer(nil)
+
+	readKeys(strings.NewReader("p\ns\ns\n"), out, r)
+	assert.True(t, r.Paused())
+	assert.Equal(t, uint64(2), r.Clock.Steps())
+
+	readKeys(strings.NewReader("r\nx\n"), out, r)
+	assert.False(t, r.Paused())
+	assert.Equal(t, "[paused]\n[step 1]\n[step 2]\n[resumed]\n"+keysHelp+"\n", out.String())
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+const (
+	DefaultLogQueue = 1000 // how many lines a client may fall behind.
+)
+
+// SlowPolicy is what to do with a client that falls more than its queue
+// behind the logs.
+type SlowPolicy string
+
+const (
+	SlowDrop       SlowPolicy = "drop"       // drop the lines that do not fit
+	SlowDisconnect SlowPolicy = "disconnect" // end the client's response
+)
+
+func ParseSlowPolicy(s string) (SlowPolicy, error) {
+	switch p := SlowPolicy(s); p {
+	case SlowDrop, SlowDisconnect:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown slow client policy: %q (drop or disconnect)", s)
+}
+
+var (
+	errClientGone = errors.New("logs client went away")
+	errClientSlow = errors.New("logs client too slow")
+)
+
+// ClientStats are the numbers of one logs client.
+type ClientStats struct {
+	Addr      string // remote address
+	Transport string // ndjson, sse or ws
+	Queued    int    // lines waiting to be written
+	Dropped   uint64 // lines dropped for not fitting the queue
+}
+
+type queuedLine struct {
+	seq  uint64
+	line []byte
+}
+
+// client writes the logs that pass its filter to an http client, from
+// its own goroutine, through a queue of at most max lines. The pipeline
+// never waits for the client: when the queue is full, the client either
+// drops lines or is disconnected, by its policy.
+type client struct {
+	addr      string
+	transport string
+	f         *LogFilter // nil for all lines
+	w         LineWriter // only written to by run
+	max       int
+	policy    SlowPolicy
+
+	lk       sync.Mutex
+	queue    []queuedLine
+	caughtUp int // lines of queue from the catch-up, which max does not count
+	dropped  uint64
+	closed   bool
+
+	ready   chan struct{} // has a value when the queue has lines
+	gone    chan struct{} // closed when the client is closed
+	stopped chan struct{} // closed when run returns
+}
+
+func newClient(addr, transport string, w LineWriter, f *LogFilter, max int, policy SlowPolicy) *client {
+	return &client{
+		addr:      addr,
+		transport: transport,
+		f:         f,
+		w:         w,
+		max:       max,
+		policy:    policy,
+		ready:     make(chan struct{}, 1),
+		gone:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// WriteLine queues a line, if it passes the filter.
+func (c *client) WriteLine(seq uint64, line []byte) error {
+	return c.enqueue(seq, line, false)
+}
+
+// catchUp queues a buffered line, if it passes the filter. The buffer
+// does not count towards the queue size, so catching up drops nothing.
+func (c *client) catchUp(seq uint64, line []byte) error {
+	return c.enqueue(seq, line, true)
+}
+
+func (c *client) enqueue(seq uint64, line []byte, catchingUp bool) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if c.closed {
+		return errClientGone
+	}
+
+	if c.f != nil {
+		var ok bool
+		if line, ok = c.f.Apply(line); !ok {
+			return nil
+		}
+	}
+
+	if catchingUp {
+		c.caughtUp++
+	} else if len(c.queue)-c.caughtUp >= c.max {
+		if c.policy == SlowDisconnect {
+			log.Printf("logs client %s fell %d lines behind. disconnected.\n", c.addr, len(c.queue)-c.caughtUp)
+			c.close()
+			return errClientSlow
+		}
+		c.dropped++
+		return nil
+	}
+
+	c.queue = append(c.queue, queuedLine{seq, append([]byte(nil), line...)})
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// run writes the queued lines to the client, until it is closed, or
+// writing fails.
+func (c *client) run() {
+	defer close(c.stopped)
+	for {
+		select {
+		case <-c.gone:
+			return
+		case <-c.ready:
+		}
+
+		c.lk.Lock()
+		lines := c.queue
+		c.queue = nil
+		c.caughtUp = 0
+		c.lk.Unlock()
+
+		for _, l := range lines {
+			select {
+			case <-c.gone:
+				return
+			default:
+			}
+			if err := c.w.WriteLine(l.seq, l.line); err != nil {
+				c.Close()
+				return
+			}
+		}
+		tryFlushing(c.w)
+	}
+}
+
+// Close stops the client. run returns after the write in progress, if
+// any.
+func (c *client) Close() {
+	c.lk.Lock()
+	c.close()
+	c.lk.Unlock()
+}
+
+// close should be called with the lock held.
+func (c *client) close() {
+	if !c.closed {
+		c.closed = true
+		close(c.gone)
+	}
+}
+
+func (c *client) Stats() ClientStats {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return ClientStats{Addr: c.addr, Transport: c.transport, Queued: len(c.queue), Dropped: c.dropped}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedWriter records the lines written to it, each once gate lets it.
+type gatedWriter struct {
+	gate chan struct{}
+
+	lk   sync.Mutex
+	seqs []uint64
+}
+
+func (g *gatedWriter) WriteLine(seq uint64, line []byte) error {
+	<-g.gate
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	g.seqs = append(g.seqs, seq)
+	return nil
+}
+
+func (g *gatedWriter) Seqs() []uint64 {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	return append([]uint64(nil), g.seqs...)
+}
+
+func TestClientDrop(t *testing.T) {
+	g := &gatedWriter{gate: make(chan struct{})}
+	f := &LogFilter{Types: map[string]bool{"a": true}}
+	c := newClient("addr", "test", g, f, 2, SlowDrop)
+
+	// catching up does not count towards the queue.
+	for seq := uint64(1); seq <= 3; seq++ {
+		require.NoError(t, c.catchUp(seq, []byte(`{"type":"a"}`+"\n")))
+	}
+	for seq := uint64(4); seq <= 5; seq++ {
+		require.NoError(t, c.WriteLine(seq, []byte(`{"type":"a"}`+"\n")))
+	}
+	require.NoError(t, c.WriteLine(6, []byte(`{"type":"b"}`+"\n"))) // filtered, not dropped
+	assert.Equal(t, ClientStats{Addr: "addr", Transport: "test", Queued: 5, Dropped: 0}, c.Stats())
+	require.NoError(t, c.WriteLine(7, []byte(`{"type":"a"}`+"\n")))
+	assert.Equal(t, uint64(1), c.Stats().Dropped)
+
+	go c.run()
+	close(g.gate)
+	require.Eventually(t, func() bool { return len(g.Seqs()) == 5 }, time.Second, time.Millisecond)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5}, g.Seqs())
+
+	// a stuck client drops what does not fit.
+	g.gate = make(chan struct{})
+	for seq := uint64(8); seq <= 20; seq++ {
+		require.NoError(t, c.WriteLine(seq, []byte(`{"type":"a"}`+"\n")))
+		time.Sleep(time.Millisecond)
+	}
+	st := c.Stats()
+	assert.Equal(t, 2, st.Queued)
+	assert.True(t, st.Dropped >= 11, "dropped %d", st.Dropped)
+
+	c.Close()
+	assert.Equal(t, errClientGone, c.WriteLine(21, []byte("{}\n")))
+	close(g.gate)
+	<-c.stopped
+}
+
+func TestClientDisconnect(t *testing.T) {
+	g := &gatedWriter{gate: make(chan struct{})}
+	c := newClient("addr", "test", g, nil, 2, SlowDisconnect)
+
+	var err error
+	for seq := uint64(1); seq <= 3 && err == nil; seq++ {
+		err = c.WriteLine(seq, []byte(fmt.Sprintf(`{"seq":%d}`+"\n", seq)))
+	}
+	assert.Equal(t, errClientSlow, err)
+	select {
+	case <-c.gone:
+	default:
+		t.Fatal("slow client not closed")
+	}
+
+	_, err = ParseSlowPolicy("disconnect")
+	assert.NoError(t, err)
+	_, err = ParseSlowPolicy("wait")
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// LogFilter picks the log lines a client gets, and the fields of them,
+// from the query of its request:
+//
+//	?type=NewBlockMined,MakeDeal    only events of these types
+//	?node=node0,node3               only events from or to these nodes (by sim id)
+//	?from=<addr>,<addr>             only events from these addresses
+//	?fields=type,from,to            only these fields of the events
+//
+// Each parameter may also be repeated. Lines that are not events only
+// pass a filter without type, node or from.
+type LogFilter struct {
+	Types  map[string]bool
+	From   map[string]bool
+	Nodes  []func() []string // the addresses of the node= nodes, as of now
+	Fields []string
+}
+
+// NodeAddrs finds a node by its sim id, and returns a func that returns
+// the addresses its events are from or to, as of each call. A node gets
+// new addresses as it runs, e.g. when it creates a miner.
+type NodeAddrs func(id string) (func() []string, error)
+
+// ParseLogFilter parses the filter in q, or returns nil if there is none.
+// nodeAddrs finds the nodes of node=, if it is given.
+func ParseLogFilter(q url.Values, nodeAddrs NodeAddrs) (*LogFilter, error) {
+	f := &LogFilter{
+		Types:  listSet(queryList(q, "type")),
+		From:   listSet(queryList(q, "from")),
+		Fields: queryList(q, "fields"),
+	}
+
+	if ids := queryList(q, "node"); len(ids) > 0 {
+		if nodeAddrs == nil {
+			return nil, fmt.Errorf("node filters need a running sim")
+		}
+		for _, id := range ids {
+			addrs, err := nodeAddrs(id)
+			if err != nil {
+				return nil, err
+			}
+			f.Nodes = append(f.Nodes, addrs)
+		}
+	}
+
+	if f.Types == nil && f.From == nil && f.Nodes == nil && f.Fields == nil {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// queryList returns the comma separated values of key, in all its
+// occurrences in q.
+func queryList(q url.Values, key string) []string {
+	var l []string
+	for _, v := range q[key] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				l = append(l, s)
+			}
+		}
+	}
+	return l
+}
+
+func listSet(l []string) map[string]bool {
+	if len(l) == 0 {
+		return nil
+	}
+	m := make(map[string]bool, len(l))
+	for _, s := range l {
+		m[s] = true
+	}
+	return m
+}
+
+// Apply returns line as the client should get it, and false if the
+// client should not get it at all. line ends with its newline.
+func (f *LogFilter) Apply(line []byte) ([]byte, bool) {
+	if f.Types != nil || f.From != nil || f.Nodes != nil {
+		var env struct {
+			Type string `json:"type"`
+			From string `json:"from"`
+			To   string `json:"to"`
+		}
+		if err := json.Unmarshal(line, &env); err != nil {
+			return nil, false
+		}
+		if f.Types != nil && !f.Types[env.Type] {
+			return nil, false
+		}
+		if f.From != nil && !f.From[env.From] {
+			return nil, false
+		}
+		if f.Nodes != nil && !f.fromOrToNodes(env.From, env.To) {
+			return nil, false
+		}
+	}
+
+	if f.Fields == nil {
+		return line, true
+	}
+	return project(line, f.Fields), true
+}
+
+// fromOrToNodes returns whether from or to is an address of the node=
+// nodes, as of now.
+func (f *LogFilter) fromOrToNodes(from, to string) bool {
+	for _, addrs := range f.Nodes {
+		for _, a := range addrs() {
+			if a == from || a == to {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// project returns the line with only fields, in that order. Lines that
+// are not JSON objects are returned as they are.
+func project(line []byte, fields []string) []byte {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(line, &m); err != nil {
+		return line
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for _, k := range fields {
+		v, ok := m[k]
+		if !ok {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
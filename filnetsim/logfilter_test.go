@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFilter(t *testing.T) {
+	node1 := []string{"w1", "m1"}
+	nodeAddrs := func(id string) (func() []string, error) {
+		if id != "node1" {
+			return nil, fmt.Errorf("no node %q", id)
+		}
+		return func() []string { return node1 }, nil
+	}
+	parse := func(q string) (*LogFilter, error) {
+		v, err := url.ParseQuery(q)
+		require.NoError(t, err)
+		return ParseLogFilter(v, nodeAddrs)
+	}
+
+	f, err := parse("")
+	require.NoError(t, err)
+	assert.Nil(t, f)
+
+	_, err = parse("node=node2")
+	assert.Error(t, err)
+	_, err = ParseLogFilter(url.Values{"node": {"node1"}}, nil)
+	assert.Error(t, err)
+
+	block := []byte(`{"seq":1,"type":"NewBlockMined","from":"m1","to":"all","block":"b1"}` + "\n")
+	saw := []byte(`{"seq":2,"type":"SawBlock","from":"w2","to":"m1"}` + "\n")
+	beat := []byte(`{"seq":3,"type":"HeartBeat","from":"w2"}` + "\n")
+	junk := []byte("not json\n")
+
+	cases := []struct {
+		query string
+		in    []byte
+		out   string // "" if dropped
+	}{
+		{"type=NewBlockMined,SawBlock", block, string(block)},
+		{"type=NewBlockMined&type=SawBlock", saw, string(saw)},
+		{"type=NewBlockMined,SawBlock", beat, ""},
+		{"type=HeartBeat", junk, ""},
+		{"from=w2", saw, string(saw)},
+		{"from=w2", block, ""},
+		{"node=node1", block, string(block)},
+		{"node=node1", saw, string(saw)}, // to m1
+		{"node=node1", beat, ""},
+		{"fields=type,from,to", block, `{"type":"NewBlockMined","from":"m1","to":"all"}` + "\n"},
+		{"fields=to,seq,nope", beat, `{"seq":3}` + "\n"},
+		{"fields=type", junk, "not json\n"},
+		{"type=NewBlockMined&fields=block", block, `{"block":"b1"}` + "\n"},
+	}
+	for _, c := range cases {
+		f, err := parse(c.query)
+		require.NoError(t, err, c.query)
+		out, ok := f.Apply(c.in)
+		if c.out == "" {
+			assert.False(t, ok, "%s: %s", c.query, c.in)
+			continue
+		}
+		assert.True(t, ok, "%s: %s", c.query, c.in)
+		assert.Equal(t, c.out, string(out), c.query)
+	}
+
+	// addresses a node gets later, such as its miner's, count too.
+	f, err = parse("node=node1")
+	require.NoError(t, err)
+	ask := []byte(`{"seq":4,"type":"AddAsk","from":"m2"}` + "\n")
+	_, ok := f.Apply(ask)
+	assert.False(t, ok)
+	node1 = append(node1, "m2")
+	out, ok := f.Apply(ask)
+	assert.True(t, ok)
+	assert.Equal(t, string(ask), string(out))
+}
@@ -1,104 +1,414 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 const (
-	LogBufferSize = 5000 // how many old messages to keep for new writers.
+	LogBufferSize = 5000 // how many old lines to keep for new writers, by default.
+
+	// StuckWriteTimeout is how long a client that is let go may take to
+	// finish the write in progress, before its connection is closed.
+	StuckWriteTimeout = time.Second
 )
 
+// LineWriter takes the logs a line at a time, with the line's sequence
+// number. Lines are numbered from 1 in the order the sim writes them, the
+// same as the "seq" of the events. line ends with its newline.
+type LineWriter interface {
+	WriteLine(seq uint64, line []byte) error
+}
+
+// newWriter is a writer to add, caught up with the lines after since.
+type newWriter struct {
+	w     LineWriter
+	since uint64
+}
+
 type LogHandler struct {
 	ctx  context.Context
 	logs io.Reader
-	wch  chan io.Writer
+	win  Window // of the catch-up buffer
+	wch  chan newWriter
+	done chan struct{} // closed when the logs are read to their end
+
+	writers int64 // how many writers logs go to, updated atomically
+
+	clk     sync.Mutex
+	clients map[*client]bool
+	dropped uint64 // by clients that left
+
+	// NodeAddrs finds the nodes of the node= filter of clients. nil if
+	// there are no nodes, e.g. in a replay.
+	NodeAddrs NodeAddrs
+
+	// QueueSize is how many lines a client may fall behind, before
+	// SlowPolicy applies. Set them before serving clients.
+	QueueSize  int
+	SlowPolicy SlowPolicy
 }
 
-func NewLogHandler(ctx context.Context, logs io.Reader) *LogHandler {
-	lh := &LogHandler{ctx, logs, make(chan io.Writer, 20)}
-	go lh.PipeLogsToWriters()
+// NewLogHandler pipes logs to sinks, and to the writers added to it, from
+// now on. New writers catch up with the lines within win first. Sinks get
+// every line, e.g. to record them to a file, including those written
+// after ctx is done, until the logs end.
+func NewLogHandler(ctx context.Context, logs io.Reader, win Window, sinks ...io.Writer) *LogHandler {
+	lh := &LogHandler{
+		ctx:        ctx,
+		logs:       logs,
+		win:        win,
+		wch:        make(chan newWriter, 20),
+		done:       make(chan struct{}),
+		clients:    make(map[*client]bool),
+		QueueSize:  DefaultLogQueue,
+		SlowPolicy: SlowDrop,
+	}
+	go lh.PipeLogsToWriters(sinks)
 	return lh
 }
 
+// clientQuery parses the query all the log handlers take: the query of
+// a LogFilter, and ?since=N, to start after the line with seq N (if still
+// buffered) instead of with all the buffered lines.
+func (l *LogHandler) clientQuery(req *http.Request) (*LogFilter, uint64, error) {
+	f, err := ParseLogFilter(req.URL.Query(), l.NodeAddrs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var since uint64
+	if s := req.URL.Query().Get("since"); s != "" {
+		if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return nil, 0, fmt.Errorf("invalid since: %q", s)
+		}
+	}
+	return f, since, nil
+}
+
+// HandleHttp serves the logs as ndjson, in a never-ending response.
 func (l *LogHandler) HandleHttp(w http.ResponseWriter, req *http.Request) {
+	f, since, err := l.clientQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
-	l.AddWriter(w)
-	l.Wait()
+	tryFlushing(w)
+	l.serveClient(req.Context(), req.RemoteAddr, "ndjson", rawWriter{w}, closeConn(req), since, f)
 }
 
-func (l *LogHandler) Wait() {
-	<-l.ctx.Done()
+// HandleSSE serves the logs as Server-Sent Events, one per line, with the
+// line's sequence number as the event id. A reconnecting EventSource sends
+// the last id it got as Last-Event-ID, and resumes after it, if the lines
+// are still buffered. It takes precedence over ?since.
+func (l *LogHandler) HandleSSE(w http.ResponseWriter, req *http.Request) {
+	f, since, err := l.clientQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if id := req.Header.Get("Last-Event-ID"); id != "" {
+		if since, err = strconv.ParseUint(id, 10, 64); err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	tryFlushing(w)
+	l.serveClient(req.Context(), req.RemoteAddr, "sse", sseWriter{w}, closeConn(req), since, f)
 }
 
-func (l *LogHandler) PipeLogsToWriters() {
-	// buffer to store last n logs for new clients
-	// need to keep full writes, not bytes.
-	// n * 300 chars per write = ~300n Bytes of storage
-	lastLogs := NewRingWriter(LogBufferSize)
+var upgrader = websocket.Upgrader{
+	// the visualizations may be served from elsewhere, e.g. a dev server.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
 
-	// wait for the first writer before reading starts.
-	w := <-l.wch
-	ws := []io.Writer{w}
+// HandleWS serves the logs over a WebSocket, one text message per line.
+// Anything the client sends is ignored.
+func (l *LogHandler) HandleWS(w http.ResponseWriter, req *http.Request) {
+	f, since, err := l.clientQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	buf := make([]byte, 2048)
-	for {
-		// read from logs. (blocks here)
-		n, err := l.logs.Read(buf)
-		if err != nil {
-			return
+	c, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return // Upgrade already replied.
+	}
+	defer c.Close()
+
+	// the server stops watching a hijacked connection, so reading is how
+	// we notice the client went away.
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := c.NextReader(); err != nil {
+				return
+			}
 		}
-		bytesRead := buf[:n]
+	}()
+
+	l.serveClient(ctx, req.RemoteAddr, "ws", wsWriter{c}, func() { c.Close() }, since, f)
+	c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
+
+// serveClient sends the logs after since that pass f (if not nil) to w,
+// until ctx (the client's request) or the handler's context is done, or
+// the client is dropped. If a write to w is still stuck StuckWriteTimeout
+// after that, abort (if not nil) closes the client's connection, to fail
+// it. w is never written to after serveClient returns.
+func (l *LogHandler) serveClient(ctx context.Context, addr, transport string, w LineWriter, abort func(), since uint64, f *LogFilter) {
+	c := newClient(addr, transport, w, f, l.QueueSize, l.SlowPolicy)
+	go c.run()
+	l.addClient(c)
+	defer func() {
+		c.Close()
+		select {
+		case <-c.stopped:
+		case <-time.After(StuckWriteTimeout):
+			if abort != nil {
+				log.Printf("logs client %s is stuck in a write. closing its connection.\n", addr)
+				abort()
+			}
+			<-c.stopped
+		}
+		l.removeClient(c)
+	}()
+
+	select {
+	case l.wch <- newWriter{c, since}:
+	case <-ctx.Done():
+		return
+	case <-l.ctx.Done():
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		log.Println("logs client went away.")
+	case <-c.gone:
+	case <-l.ctx.Done():
+	}
+}
+
+type connKey struct{}
+
+// WithConn keeps the connection of each request in its context, so the
+// log handlers can close the connections of clients stuck in a write. It
+// is an http.Server ConnContext.
+func WithConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// closeConn returns a func closing the connection of req, or nil if the
+// server does not keep it (see WithConn).
+func closeConn(req *http.Request) func() {
+	c, ok := req.Context().Value(connKey{}).(net.Conn)
+	if !ok {
+		return nil
+	}
+	return func() { c.Close() }
+}
+
+func (l *LogHandler) addClient(c *client) {
+	l.clk.Lock()
+	defer l.clk.Unlock()
+	l.clients[c] = true
+}
+
+func (l *LogHandler) removeClient(c *client) {
+	l.clk.Lock()
+	defer l.clk.Unlock()
+	delete(l.clients, c)
+	l.dropped += c.Stats().Dropped
+}
+
+// Clients returns the stats of the clients connected now.
+func (l *LogHandler) Clients() []ClientStats {
+	l.clk.Lock()
+	defer l.clk.Unlock()
+
+	var cs []ClientStats
+	for c := range l.clients {
+		cs = append(cs, c.Stats())
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Addr < cs[j].Addr })
+	return cs
+}
+
+// Dropped returns how many lines all clients ever dropped.
+func (l *LogHandler) Dropped() uint64 {
+	l.clk.Lock()
+	defer l.clk.Unlock()
+
+	n := l.dropped
+	for c := range l.clients {
+		n += c.Stats().Dropped
+	}
+	return n
+}
+
+// Wait waits until the logs are read to their end.
+func (l *LogHandler) Wait() {
+	<-l.done
+}
+
+// PipeLogsToWriters reads the logs from the start to their end, whether
+// or not there are writers, so the sim never waits on them. Lines go to
+// the sinks, the catch-up buffer, and the writers added since.
+func (l *LogHandler) PipeLogsToWriters(sinks []io.Writer) {
+	defer close(l.done)
 
+	// buffer to store the last lines for new clients
+	// n * 300 chars per line = ~300n Bytes of storage
+	lastLogs := NewLineBuffer(l.win)
+
+	var ws []LineWriter
+	for _, w := range sinks {
+		ws = append(ws, rawWriter{w})
+	}
+	l.setWriters(ws)
+
+	lines := make(chan [][]byte)
+	go l.readLines(lines)
+
+	var seq uint64
+	ctxDone := l.ctx.Done()
+	for {
 		select {
-		case w := <-l.wch:
+		case batch, ok := <-lines:
+			if !ok {
+				return
+			}
+
+			// write to all writers
+			for i, w := range ws {
+				if err := writeLines(w, seq+1, batch); err != nil {
+					log.Println("failed to write logs to writer. removed.")
+					ws[i] = nil // delete/gc writer
+					continue
+				}
+				tryFlushing(w)
+			}
+			ws = pruneNils(ws) // remove dead writers
+
+			// store in buffer
+			for i, line := range batch {
+				lastLogs.Add(seq+uint64(i)+1, line)
+			}
+			seq += uint64(len(batch))
+
+		case nw := <-l.wch:
 			newWs := DrainWriterCh(l.wch)
-			newWs = append(newWs, w)
+			newWs = append(newWs, nw)
 
 			// first, catch them up.
 			log.Println("catching up new writers", len(newWs))
-			for i, w := range newWs {
-				_, err := lastLogs.WriteTo(w)
+			for _, nw := range newWs {
+				catchUp := nw.w.WriteLine
+				if c, ok := nw.w.(*client); ok {
+					catchUp = c.catchUp
+				}
+				err := lastLogs.Since(nw.since, catchUp)
 				if err != nil {
 					log.Println("failed to write logs to new writer.")
-					newWs[i] = nil // sad that it failed so soon...
-					continue
+					continue // sad that it failed so soon...
 				}
-				tryFlushing(w)
+				tryFlushing(nw.w)
+				ws = append(ws, nw.w) // track new writers.
 			}
 
-			ws = append(ws, newWs...) // track new writers.
-			ws = pruneNils(ws)        // remove dead writers
-		case <-l.ctx.Done():
-			return // ok bye
-		default:
+		case <-ctxDone:
+			// clients are going away, but the logs go on until the nodes
+			// are shut down, and the sinks should get them.
+			ctxDone = nil
 		}
+		l.setWriters(ws)
+	}
+}
 
-		// write to all writers
-		for i, w := range ws {
-			if w == nil {
-				continue // skip dead writer.
-			}
+// readLines reads the logs, and sends them to ch, whole lines at a time,
+// until reading fails, e.g. at the end of the logs.
+func (l *LogHandler) readLines(ch chan<- [][]byte) {
+	defer close(ch)
 
-			_, err := w.Write(bytesRead)
-			if err != nil {
-				log.Println("failed to write logs to writer. removed.")
-				ws[i] = nil // delete/gc writer
-				continue
-			}
+	var partial []byte // a line not read to its end yet
+	buf := make([]byte, 2048)
+	for {
+		// read from logs. (blocks here)
+		n, err := l.logs.Read(buf)
+		if err != nil {
+			return
+		}
+		partial = append(partial, buf[:n]...)
 
-			tryFlushing(w)
+		end := bytes.LastIndexByte(partial, '\n') + 1
+		if end == 0 {
+			continue
 		}
+		chunk := partial[:end]
+		partial = append([]byte(nil), partial[end:]...)
 
-		// store in buffer
-		lastLogs.Write(bytesRead)
+		var lines [][]byte
+		for len(chunk) > 0 {
+			i := bytes.IndexByte(chunk, '\n')
+			lines = append(lines, chunk[:i+1])
+			chunk = chunk[i+1:]
+		}
+
+		ch <- lines
 	}
 }
 
-func pruneNils(l1 []io.Writer) []io.Writer {
-	var l2 []io.Writer
+// writeLines writes lines to w, numbered from seq.
+func writeLines(w LineWriter, seq uint64, lines [][]byte) error {
+	for i, line := range lines {
+		if err := w.WriteLine(seq+uint64(i), line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *LogHandler) setWriters(ws []LineWriter) {
+	live := 0
+	for _, w := range ws {
+		if w != nil {
+			live++
+		}
+	}
+	atomic.StoreInt64(&l.writers, int64(live))
+}
+
+// Writers returns how many writers logs go to, as of the last write. This
+// includes the recorder, if any.
+func (l *LogHandler) Writers() int {
+	return int(atomic.LoadInt64(&l.writers))
+}
+
+func pruneNils(l1 []LineWriter) []LineWriter {
+	var l2 []LineWriter
 	for _, w := range l1 {
 		if w != nil {
 			l2 = append(l2, w)
@@ -107,8 +417,8 @@ func pruneNils(l1 []io.Writer) []io.Writer {
 	return l2
 }
 
-func DrainWriterCh(wch <-chan io.Writer) []io.Writer {
-	var ws []io.Writer
+func DrainWriterCh(wch <-chan newWriter) []newWriter {
+	var ws []newWriter
 	for {
 		select {
 		case w := <-wch:
@@ -119,16 +429,60 @@ func DrainWriterCh(wch <-chan io.Writer) []io.Writer {
 	}
 }
 
+// AddWriter adds a writer the logs go to, as they are, until writing to
+// it fails. It is caught up with the buffered logs first.
 func (l *LogHandler) AddWriter(w io.Writer) {
-	l.wch <- w
+	l.wch <- newWriter{w: rawWriter{w}}
+}
+
+// rawWriter writes the lines as they are.
+type rawWriter struct {
+	w io.Writer
+}
+
+func (r rawWriter) WriteLine(seq uint64, line []byte) error {
+	_, err := r.w.Write(line)
+	return err
+}
+
+func (r rawWriter) Flush() {
+	tryFlushing(r.w)
+}
+
+// sseWriter writes each line as an event, with the line's seq as its id.
+type sseWriter struct {
+	w io.Writer
+}
+
+func (s sseWriter) WriteLine(seq uint64, line []byte) error {
+	buf := make([]byte, 0, len(line)+32)
+	buf = append(buf, "id: "...)
+	buf = strconv.AppendUint(buf, seq, 10)
+	buf = append(buf, "\ndata: "...)
+	buf = append(buf, bytes.TrimRight(line, "\r\n")...)
+	buf = append(buf, "\n\n"...)
+	_, err := s.w.Write(buf)
+	return err
+}
+
+func (s sseWriter) Flush() {
+	tryFlushing(s.w)
+}
+
+// wsWriter writes each line as a text message.
+type wsWriter struct {
+	c *websocket.Conn
+}
+
+func (w wsWriter) WriteLine(seq uint64, line []byte) error {
+	return w.c.WriteMessage(websocket.TextMessage, bytes.TrimRight(line, "\r\n"))
 }
 
 type Flusher interface {
-	io.Writer
 	Flush()
 }
 
-func tryFlushing(w io.Writer) {
+func tryFlushing(w interface{}) {
 	if w == nil {
 		return
 	}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogHandlerFakeNetwork(t *testing.T) {
+	args := argDefaults
+	args.Backend = "fake"
+	args.NetArgs.BlockTime = 100 * time.Millisecond
+	args.NetArgs.ActionTime = 50 * time.Millisecond
+
+	i, err := SetupInstance(args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go i.Run(ctx)
+
+	lh := NewLogHandler(ctx, i.L, DefaultWindow)
+	s := httptest.NewServer(http.HandlerFunc(lh.HandleHttp))
+	defer s.Close()
+	defer cancel() // before s.Close, which waits for the handler.
+
+	res, err := http.Get(s.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	seen := make(chan string)
+	go func() {
+		d := json.NewDecoder(res.Body)
+		for {
+			var m map[string]interface{}
+			if err := d.Decode(&m); err != nil {
+				return
+			}
+			typ, _ := m["type"].(string)
+			select {
+			case seen <- typ:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	want := map[string]bool{"MinerJoins": true, "ClientJoins": true, "NewBlockMined": true}
+	timeout := time.After(10 * time.Second)
+	for len(want) > 0 {
+		select {
+		case typ := <-seen:
+			delete(want, typ)
+		case <-timeout:
+			assert.Empty(t, want, "timed out waiting for events")
+			return
+		}
+	}
+}
+
+// logsServer serves a LogHandler reading lines written to the returned pipe.
+func logsServer(t *testing.T, ctx context.Context) (*LogHandler, *io.PipeWriter, *httptest.Server) {
+	pr, pw := io.Pipe()
+	lh := NewLogHandler(ctx, pr, DefaultWindow)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logs", lh.HandleHttp)
+	mux.HandleFunc("/logs/sse", lh.HandleSSE)
+	mux.HandleFunc("/logs/ws", lh.HandleWS)
+	return lh, pw, httptest.NewServer(mux)
+}
+
+// readSSE reads one event from r.
+func readSSE(t *testing.T, r *bufio.Reader) (id, data string) {
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return id, data
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestLogHandlerSSE(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lh, pw, s := logsServer(t, ctx)
+	defer s.Close()
+	defer cancel()
+
+	get := func(lastID string) *http.Response {
+		req, err := http.NewRequest("GET", s.URL+"/logs/sse", nil)
+		require.NoError(t, err)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := get("")
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	r := bufio.NewReader(res.Body)
+
+	// a line split across writes is sent whole.
+	go func() {
+		pw.Write([]byte(`{"seq":1}` + "\n" + `{"seq"`))
+		pw.Write([]byte(`:2}` + "\n" + `{"seq":3}` + "\n"))
+	}()
+	for i := 1; i <= 3; i++ {
+		id, data := readSSE(t, r)
+		assert.Equal(t, strconv.Itoa(i), id)
+		assert.Equal(t, fmt.Sprintf(`{"seq":%d}`, i), data)
+	}
+
+	// a reconnecting client resumes after its last id.
+	res2 := get("2")
+	defer res2.Body.Close()
+	r2 := bufio.NewReader(res2.Body)
+	go pw.Write([]byte(`{"seq":4}` + "\n"))
+	id, _ := readSSE(t, r2)
+	assert.Equal(t, "3", id)
+	id, _ = readSSE(t, r2)
+	assert.Equal(t, "4", id)
+	id, _ = readSSE(t, r)
+	assert.Equal(t, "4", id)
+
+	// the writer of a client that went away is removed.
+	require.Eventually(t, func() bool { return lh.Writers() == 2 }, time.Second, 10*time.Millisecond)
+	res.Body.Close()
+	require.Eventually(t, func() bool {
+		pw.Write([]byte(`{}` + "\n"))
+		return lh.Writers() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 400, get("nope").StatusCode)
+}
+
+func TestLogHandlerWS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lh, pw, s := logsServer(t, ctx)
+	defer s.Close()
+	defer cancel()
+
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/logs/ws", nil)
+	require.NoError(t, err)
+
+	go pw.Write([]byte(`{"seq":1}` + "\n" + `{"seq":2}` + "\n"))
+	for i := 1; i <= 2; i++ {
+		typ, msg, err := c.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, websocket.TextMessage, typ)
+		assert.Equal(t, fmt.Sprintf(`{"seq":%d}`, i), string(msg))
+	}
+
+	// a client can start after a seq.
+	c2, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/logs/ws?since=1", nil)
+	require.NoError(t, err)
+	defer c2.Close()
+	go pw.Write([]byte(`{"seq":3}` + "\n"))
+	for i := 2; i <= 3; i++ {
+		_, msg, err := c2.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"seq":%d}`, i), string(msg))
+	}
+
+	require.Eventually(t, func() bool { return lh.Writers() == 2 }, time.Second, 10*time.Millisecond)
+	c.Close()
+	require.Eventually(t, func() bool {
+		pw.Write([]byte(`{}` + "\n"))
+		return lh.Writers() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	res, err := http.Get(s.URL + "/logs/ws?since=soon")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 400, res.StatusCode)
+}
+
+func TestLogHandlerFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	_, pw, s := logsServer(t, ctx)
+	defer s.Close()
+	defer cancel()
+
+	res, err := http.Get(s.URL + "/logs?type=NewBlockMined&fields=seq,type")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	go pw.Write([]byte(`{"seq":1,"type":"HeartBeat","from":"a"}` + "\n" +
+		`{"seq":2,"type":"NewBlockMined","from":"a"}` + "\n" +
+		`{"seq":3,"type":"SawBlock","from":"b"}` + "\n" +
+		`{"seq":4,"type":"NewBlockMined","from":"b"}` + "\n"))
+
+	r := bufio.NewReader(res.Body)
+	for _, want := range []string{`{"seq":2,"type":"NewBlockMined"}`, `{"seq":4,"type":"NewBlockMined"}`} {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, want+"\n", line)
+	}
+
+	// node filters need nodes.
+	res2, err := http.Get(s.URL + "/logs/sse?node=node0")
+	require.NoError(t, err)
+	res2.Body.Close()
+	assert.Equal(t, 400, res2.StatusCode)
+}
+
+func TestLogHandlerSlowClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	lh := NewLogHandler(ctx, pr, DefaultWindow)
+	lh.QueueSize = 2
+
+	fr, fw := io.Pipe()
+	lh.AddWriter(fw)
+	fast := make(chan string)
+	go func() {
+		s := bufio.NewScanner(fr)
+		for s.Scan() {
+			fast <- s.Text()
+		}
+	}()
+
+	stuck := &gatedWriter{gate: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		lh.serveClient(ctx, "stuck", "test", stuck, nil, 0, nil)
+		close(done)
+	}()
+
+	// the fast writer gets every line, though the stuck client takes none.
+	go func() {
+		for i := 1; i <= 50; i++ {
+			fmt.Fprintf(pw, `{"seq":%d}`+"\n", i)
+		}
+	}()
+	for i := 1; i <= 50; i++ {
+		select {
+		case line := <-fast:
+			assert.Equal(t, fmt.Sprintf(`{"seq":%d}`, i), line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("logs stalled by a stuck client")
+		}
+	}
+
+	require.Len(t, lh.Clients(), 1)
+	assert.True(t, lh.Clients()[0].Dropped > 0)
+	assert.Equal(t, lh.Clients()[0].Dropped, lh.Dropped())
+
+	close(stuck.gate)
+	cancel()
+	<-done
+	assert.Empty(t, lh.Clients())
+	assert.True(t, lh.Dropped() > 0)
+}
+
+func TestLogHandlerStuckClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	lh := NewLogHandler(ctx, pr, DefaultWindow)
+	lh.QueueSize = 2
+	lh.SlowPolicy = SlowDisconnect
+
+	// the client blocks in its first write, until its connection closes.
+	stuck := &gatedWriter{gate: make(chan struct{})}
+	var once sync.Once
+	aborted := make(chan struct{})
+	abort := func() {
+		once.Do(func() {
+			close(aborted)
+			close(stuck.gate)
+		})
+	}
+	writing := make(chan struct{})
+	w := lineWriterFunc(func(seq uint64, line []byte) error {
+		if seq == 1 {
+			close(writing)
+		}
+		return stuck.WriteLine(seq, line)
+	})
+	done := make(chan struct{})
+	go func() {
+		lh.serveClient(ctx, "stuck", "test", w, abort, 0, nil)
+		close(done)
+	}()
+
+	// once the client is writing the first line, it falls behind.
+	fmt.Fprintf(pw, `{"seq":1}`+"\n")
+	select {
+	case <-writing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client got no lines")
+	}
+	go func() {
+		for i := 2; i <= 50; i++ {
+			fmt.Fprintf(pw, `{"seq":%d}`+"\n", i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stuck client was not disconnected")
+	}
+	select {
+	case <-aborted:
+	default:
+		t.Fatal("stuck client's connection was not closed")
+	}
+	assert.Empty(t, lh.Clients())
+}
+
+type lineWriterFunc func(seq uint64, line []byte) error
+
+func (f lineWriterFunc) WriteLine(seq uint64, line []byte) error { return f(seq, line) }
+
+func TestLogHandlerStuckConn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	lh := NewLogHandler(ctx, pr, DefaultWindow)
+	lh.QueueSize = 2
+	lh.SlowPolicy = SlowDisconnect
+	s := httptest.NewUnstartedServer(http.HandlerFunc(lh.HandleHttp))
+	s.Config.ConnContext = WithConn
+	s.Start()
+	defer s.Close()
+
+	// a client that never reads its response.
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /logs HTTP/1.1\r\nHost: sim\r\n\r\n")
+	require.Eventually(t, func() bool { return len(lh.Clients()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// lines big enough to fill the socket buffers, and block the write.
+	pad := strings.Repeat("x", 64<<10)
+	go func() {
+		for i := 1; i <= 200; i++ {
+			fmt.Fprintf(pw, `{"seq":%d,"pad":"%s"}`+"\n", i, pad)
+		}
+	}()
+	require.Eventually(t, func() bool { return len(lh.Clients()) == 0 }, 10*time.Second, 10*time.Millisecond)
+
+	// the server closed the connection: reading it ends.
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_, err = io.Copy(ioutil.Discard, conn)
+	if ne, ok := err.(net.Error); ok {
+		assert.False(t, ne.Timeout(), "connection still open")
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to read while the pipeline writes it.
+type syncBuffer struct {
+	lk  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return b.buf.String()
+}
+
+func TestLogHandlerNoViewers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	sink := &syncBuffer{}
+	lh := NewLogHandler(ctx, pr, DefaultWindow, sink)
+	s := httptest.NewServer(http.HandlerFunc(lh.HandleHttp))
+	defer s.Close()
+
+	// the logs flow into the sink, though no one is watching.
+	var want strings.Builder
+	written := make(chan struct{})
+	go func() {
+		for i := 1; i <= 50; i++ {
+			fmt.Fprintf(pw, `{"seq":%d}`+"\n", i)
+		}
+		close(written)
+	}()
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&want, `{"seq":%d}`+"\n", i)
+	}
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logs stalled with no viewers")
+	}
+	require.Eventually(t, func() bool { return sink.String() == want.String() }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, lh.Writers()) // just the sink
+
+	// a late viewer gets the whole history, without waiting for new lines.
+	res, err := http.Get(s.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	sc := bufio.NewScanner(res.Body)
+	for i := 1; i <= 50; i++ {
+		require.True(t, sc.Scan())
+		assert.Equal(t, fmt.Sprintf(`{"seq":%d}`, i), sc.Text())
+	}
+}
+
+func TestLogHandlerDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	sink := &syncBuffer{}
+	lh := NewLogHandler(ctx, pr, DefaultWindow, sink)
+
+	// once ctx is done, the logs still go to the sinks, until they end.
+	cancel()
+	go func() {
+		for i := 1; i <= 50; i++ {
+			fmt.Fprintf(pw, `{"seq":%d}`+"\n", i)
+		}
+		pw.Close()
+	}()
+
+	waited := make(chan struct{})
+	go func() {
+		lh.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logs were not read to their end")
+	}
+
+	var want strings.Builder
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&want, `{"seq":%d}`+"\n", i)
+	}
+	assert.Equal(t, want.String(), sink.String())
+}
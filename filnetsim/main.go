@@ -9,10 +9,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"text/template"
 	"time"
 
+	linkproxy "github.com/filecoin-project/filecoin-network-sim/linkproxy"
+	logs "github.com/filecoin-project/filecoin-network-sim/logs"
 	network "github.com/filecoin-project/filecoin-network-sim/network"
+	report "github.com/filecoin-project/filecoin-network-sim/report"
+	scenario "github.com/filecoin-project/filecoin-network-sim/scenario"
 )
 
 const (
@@ -21,29 +27,64 @@ const (
 )
 
 type Args struct {
-	Debug   bool
-	Port    int
-	NetArgs network.Args
+	Debug     bool
+	Port      int
+	Backend   string
+	Scenario  string
+	Record    string
+	Report    string
+	Topology  string
+	LinkFile  string
+	Link      linkproxy.Link
+	Timeouts  network.Timeouts
+	SpawnPar  int
+	LogQueue  int
+	SlowCli   string
+	ReplayWin Window
+	NetArgs   network.Args
 }
 
 var argDefaults = Args{
-	Debug: false,
-	Port:  7002,
+	Debug:     false,
+	Port:      7002,
+	Backend:   "daemon",
+	Topology:  "mesh",
+	Timeouts:  network.DefaultTimeouts(),
+	SpawnPar:  network.DefaultSpawnParallelism,
+	LogQueue:  DefaultLogQueue,
+	SlowCli:   string(SlowDrop),
+	ReplayWin: DefaultWindow,
 	NetArgs: network.Args{
 		StartNodes:      3,
 		MaxNodes:        15,
+		MinNodes:        3,
 		JoinTime:        3 * time.Second * 4, // 4x the block time
+		LeaveTime:       0,
 		BlockTime:       3 * time.Second,
 		ActionTime:      300 * time.Millisecond,
+		PartitionTime:   0,
+		HealTime:        3 * time.Second * 10, // 10x the block time
+		CrashTime:       0,
+		FreezeTime:      0,
+		DownTime:        3 * time.Second * 10, // 10x the block time
 		ForkBranching:   1,
 		ForkProbability: 1.0,
 		TestfilesDir:    "testfiles",
+		Seed:            0,
 		Actions: network.ActionArgs{
-			Ask:     true,
-			Bid:     true,
-			Deal:    true,
-			Payment: true,
-			Mine:    true,
+			Ask:      true,
+			Bid:      true,
+			Deal:     true,
+			Payment:  true,
+			SendFile: false,
+			Mine:     true,
+			Weights: network.ActionWeights{
+				Ask:      1,
+				Bid:      1,
+				Deal:     1,
+				Payment:  1,
+				SendFile: 1,
+			},
 		},
 	},
 }
@@ -57,25 +98,55 @@ var Usage = `SYNOPSIS
 	The sim supports connecting to individual filecoin nodes to issue commands manually.
 	The sim consumes all eventlogs and transforms them into a input logs for a visualization
 	The sim serves webapp visualizations at an http server.
+	Instead of random actions, the sim can run a scripted scenario file (--scenario).
+	The sim can record the logs it serves (--record), and replay them later without any daemons.
+	The sim summarizes each run in a report (--report), at /api/report, or from a recording.
 	In the future, this simulator may run across many machines.
 
+	filnetsim replay <file> [--speed 2x] [--port port]
+	    serve a recording at /logs, with its original timing (see REPLAY)
+
+	filnetsim report <file> [--out prefix]
+	    print the report of a recording, or write it to prefix.json and prefix.md (see REPORT)
+
 ACTIONS
 	SendPayment   sends a payment message, from one node to another (miner and client)
 	StorageAsk    send a msg to add an Ask to the Storage Market (miner only)
 	StorageBid    send a msg to add a Bid to the Storage Market (client only)
 	Deal          matches one Ask and Bid, makes a Deal between their miner and client
-	SendFiles     send deal file from client to miner (storage), or client to miner (retrieval)
+	SendFiles     send deal file from client to miner (storage), or miner to client (retrieval)
 	MineBlock     advance an epoch: sample leaders, each mine a block & propagate it (miners only)
 
 OPTIONS
     NETWORK
 	--max-nodes int            maximum number of nodes to spawn (default: {{.NetArgs.MaxNodes}})
 	--start-nodes int          number of nodes to spawn at once in the beginning (default: {{.NetArgs.StartNodes}})
+	--min-nodes int            minimum number of nodes to keep when nodes leave (default: {{.NetArgs.MinNodes}})
+	--backend name             node backend: daemon (go-filecoin) or fake (in-process) (default: {{.Backend}})
+	--topology model           how nodes connect when they join (see TOPOLOGIES) (default: {{.Topology}})
+	--spawn-parallelism int    maximum number of nodes to start or shut down at once, 0 for no limit (default: {{.SpawnPar}})
+
+    LINKS
+	--link-latency duration    one-way latency of the links between nodes (default: {{.Link.Latency}})
+	--link-jitter duration     jitter of the latency (default: {{.Link.Jitter}})
+	--link-dist name           latency distribution: normal (stddev jitter) or uniform (latency ± jitter) (default: normal)
+	--link-bandwidth rate      bandwidth of each link, each way, per second, e.g. 1MB (default: {{.Link.Bandwidth}})
+	--link-loss float          probability a segment is lost, and retransmitted late (default: {{.Link.Loss}})
+	--topology-file file       YAML file with regions, and the links between them. the flags above set the default link
+	                           links only apply to the daemon backend, which connects through local proxies
 
     TIME
 	--t-join duration          how fast new nodes are spawned (default: {{.NetArgs.JoinTime}})
+	--t-leave duration         how fast nodes leave the network, 0 to never leave (default: {{.NetArgs.LeaveTime}})
 	--t-action duration        how fast to issue actions (default: {{.NetArgs.ActionTime}})
 	--t-block duration         automatic mining block time (default: {{.NetArgs.BlockTime}})
+	--t-partition duration     how often to split the network in two random groups, 0 to never (default: {{.NetArgs.PartitionTime}})
+	--t-heal duration          how long partitions last, before the network heals (default: {{.NetArgs.HealTime}})
+	--t-crash duration         how often to kill -9 a random node, 0 to never (default: {{.NetArgs.CrashTime}})
+	--t-freeze duration        how often to freeze (SIGSTOP) a random node, 0 to never (default: {{.NetArgs.FreezeTime}})
+	--t-down duration          how long crashed nodes stay down before restarting, and frozen nodes stay frozen (default: {{.NetArgs.DownTime}})
+	--timeout [op=]duration    how long a daemon command may run, before the sim gives up and kills it (see TIMEOUTS)
+	                           can be given several times, e.g. --timeout 30s --timeout deal=5m (default: {{.Timeouts.Default}})
 
     ACTIONS
 	--auto-asks bool           automatically issue StorageAsk action (default: {{.NetArgs.Actions.Ask}})
@@ -83,6 +154,13 @@ OPTIONS
 	--auto-deals bool          automatically issue StorageDeal action (default: {{.NetArgs.Actions.Deal}})
 	--auto-mining bool         automatically mine blocks (default: {{.NetArgs.Actions.Mine}})
 	--auto-payments bool       automatically issue StorageBid action (default: {{.NetArgs.Actions.Payment}})
+	--auto-retrievals bool     automatically retrieve and verify the file of a deal (SendFiles) (default: {{.NetArgs.Actions.SendFile}})
+	--weight-ask int           relative frequency of StorageAsk actions, 0 to disable (default: {{.NetArgs.Actions.Weights.Ask}})
+	--weight-bid int           relative frequency of StorageBid actions, 0 to disable (default: {{.NetArgs.Actions.Weights.Bid}})
+	--weight-deal int          relative frequency of Deal actions, 0 to disable (default: {{.NetArgs.Actions.Weights.Deal}})
+	--weight-payment int       relative frequency of SendPayment actions, 0 to disable (default: {{.NetArgs.Actions.Weights.Payment}})
+	--weight-retrieval int     relative frequency of retrieval (SendFiles) actions, 0 to disable (default: {{.NetArgs.Actions.Weights.SendFile}})
+	                           if all weights are 0, the enabled actions are picked equally often
 
     MINING
 	--fork-branching int       number of leaders (branches) to consider per consensus epoch (default: {{.NetArgs.ForkBranching}})
@@ -91,11 +169,68 @@ OPTIONS
     FILES
 	--test-files dir           directory with test files to use with SendFiles (default: {{.NetArgs.TestfilesDir}})
 
+    RANDOMNESS
+	--seed int                 seed for all random choices, to reproduce a run. 0 picks one (default: {{.NetArgs.Seed}})
+
+    SCENARIO
+	--scenario file            run the steps in a YAML (or .json) scenario file, instead of random actions
+
+    LOGS
+	--log-queue int            how many lines a /logs client may fall behind the sim (default: {{.LogQueue}})
+	--slow-clients policy      what to do with a client that falls further behind: drop lines, or disconnect (default: {{.SlowCli}})
+	                           dropped lines show as gaps in the seq of the events
+	--replay-window limits     how much of the logs new clients catch up with: lines (5000), size (50MB), age (10m),
+	                           or several, e.g. 10m,50MB. clients can ask for the lines after seq N with ?since=N (default: {{.ReplayWin}})
+
+    RECORDING
+	--record file              record the sim logs, with their timing, to file (ndjson)
+	--report prefix            on exit (ctrl-c), write the report of the run to prefix.json and prefix.md
+
     OTHER
 	-h, --help                 print this help text
 	--debug                    output verbose debugging logs
 	--port port                port at which to serve /logs and visualizations
 	--httptest.serve addr      if non-empty, httptest.NewServer serves on this address and blocks
+
+TOPOLOGIES
+	mesh                       every node connects to every other node
+	ring                       each node connects to the next one, in a ring
+	kregular:<k>               each node connects to k random nodes
+	er:<p>                     Erdős–Rényi: each pair of nodes connects with probability p
+	smallworld:<k>,<b>         Watts–Strogatz: a ring of k neighbours, each edge rewired with probability b
+	bootstrap:<h>[,<l>]        the first h nodes are hubs, every other node connects to l random hubs
+
+TIMEOUTS
+	Each daemon interaction has its own timeout, which defaults to the --timeout duration:
+	mine                       mining a block (the sim also mines when a node joins)
+	miner                      creating a miner identity
+	connect                    swarm connect and disconnect (default: 30s)
+	payment                    checking a balance and sending filecoin
+	ask, bid                   adding an ask or a bid
+	orderbook                  querying the orderbook
+	import                     importing a file into a client
+	deal                       proposing a deal (default: 2m)
+	retrieve                   fetching the data of a deal (default: 2m)
+	cli processes still running twice the longest timeout after they start are killed.
+
+KEYS
+	While the sim runs, type a key and press enter:
+	p                          pause the sim clock: no more mining, actions or churn
+	r                          resume the sim clock
+	s                          step the sim clock one epoch (e.g. while paused)
+
+REPLAY
+	--speed factor             replay speed, e.g. 2x or 0.5x (default: 1x)
+	--port port                port at which to serve /logs and visualizations (default: {{.Port}})
+
+REPORT
+	The report summarizes a run from its events, to compare runs, e.g. with different fork settings:
+	chain                      height over time, orphan rate, forks and their depth
+	miners                     blocks mined, and won (on the main chain), with their rewards
+	market                     asks, bids and deals, their volume, and the prices deals matched at
+	payments                   count, value and throughput
+	nodes                      when each node joined and left, its uptime, crashes and freezes
+	--out prefix               write prefix.json and prefix.md, instead of printing markdown
 `
 
 func parseArgs() Args {
@@ -112,31 +247,68 @@ func parseArgs() Args {
 
 	flag.BoolVar(&a.Debug, "debug", argDefaults.Debug, "")
 	flag.IntVar(&a.Port, "port", argDefaults.Port, "")
+	flag.StringVar(&a.Backend, "backend", argDefaults.Backend, "")
+	flag.StringVar(&a.Scenario, "scenario", argDefaults.Scenario, "")
+	flag.StringVar(&a.Record, "record", argDefaults.Record, "")
+	flag.StringVar(&a.Report, "report", argDefaults.Report, "")
+	flag.StringVar(&a.Topology, "topology", argDefaults.Topology, "")
+	flag.IntVar(&a.SpawnPar, "spawn-parallelism", argDefaults.SpawnPar, "")
+	flag.IntVar(&a.LogQueue, "log-queue", argDefaults.LogQueue, "")
+	flag.StringVar(&a.SlowCli, "slow-clients", argDefaults.SlowCli, "")
+	a.ReplayWin = DefaultWindow
+	flag.Var(&a.ReplayWin, "replay-window", "")
+	flag.StringVar(&a.LinkFile, "topology-file", argDefaults.LinkFile, "")
+	flag.DurationVar(&a.Link.Latency, "link-latency", argDefaults.Link.Latency, "")
+	flag.DurationVar(&a.Link.Jitter, "link-jitter", argDefaults.Link.Jitter, "")
+	flag.StringVar(&a.Link.Dist, "link-dist", argDefaults.Link.Dist, "")
+	flag.Var(&a.Link.Bandwidth, "link-bandwidth", "")
+	flag.Float64Var(&a.Link.Loss, "link-loss", argDefaults.Link.Loss, "")
+	a.Timeouts = network.DefaultTimeouts()
+	flag.Var(&a.Timeouts, "timeout", "")
 
 	flag.DurationVar(&a.NetArgs.BlockTime, "t-block", argDefaults.NetArgs.BlockTime, "")
 	flag.DurationVar(&a.NetArgs.ActionTime, "t-action", argDefaults.NetArgs.ActionTime, "")
 	flag.DurationVar(&a.NetArgs.JoinTime, "t-join", argDefaults.NetArgs.JoinTime, "")
+	flag.DurationVar(&a.NetArgs.LeaveTime, "t-leave", argDefaults.NetArgs.LeaveTime, "")
+	flag.DurationVar(&a.NetArgs.PartitionTime, "t-partition", argDefaults.NetArgs.PartitionTime, "")
+	flag.DurationVar(&a.NetArgs.HealTime, "t-heal", argDefaults.NetArgs.HealTime, "")
+	flag.DurationVar(&a.NetArgs.CrashTime, "t-crash", argDefaults.NetArgs.CrashTime, "")
+	flag.DurationVar(&a.NetArgs.FreezeTime, "t-freeze", argDefaults.NetArgs.FreezeTime, "")
+	flag.DurationVar(&a.NetArgs.DownTime, "t-down", argDefaults.NetArgs.DownTime, "")
 	flag.IntVar(&a.NetArgs.ForkBranching, "fork-branching", argDefaults.NetArgs.ForkBranching, "")
 	flag.Float64Var(&a.NetArgs.ForkProbability, "fork-probability", argDefaults.NetArgs.ForkProbability, "")
 	flag.IntVar(&a.NetArgs.MaxNodes, "max-nodes", argDefaults.NetArgs.MaxNodes, "")
 	flag.IntVar(&a.NetArgs.StartNodes, "start-nodes", argDefaults.NetArgs.StartNodes, "")
+	flag.IntVar(&a.NetArgs.MinNodes, "min-nodes", argDefaults.NetArgs.MinNodes, "")
 	flag.StringVar(&a.NetArgs.TestfilesDir, "test-files", argDefaults.NetArgs.TestfilesDir, "")
+	flag.Int64Var(&a.NetArgs.Seed, "seed", argDefaults.NetArgs.Seed, "")
 
 	flag.BoolVar(&a.NetArgs.Actions.Ask, "auto-asks", argDefaults.NetArgs.Actions.Ask, "")
 	flag.BoolVar(&a.NetArgs.Actions.Bid, "auto-bids", argDefaults.NetArgs.Actions.Bid, "")
 	flag.BoolVar(&a.NetArgs.Actions.Deal, "auto-deals", argDefaults.NetArgs.Actions.Deal, "")
 	flag.BoolVar(&a.NetArgs.Actions.Payment, "auto-payments", argDefaults.NetArgs.Actions.Payment, "")
+	flag.BoolVar(&a.NetArgs.Actions.SendFile, "auto-retrievals", argDefaults.NetArgs.Actions.SendFile, "")
 	flag.BoolVar(&a.NetArgs.Actions.Mine, "auto-mining", argDefaults.NetArgs.Actions.Mine, "")
 
+	flag.IntVar(&a.NetArgs.Actions.Weights.Ask, "weight-ask", argDefaults.NetArgs.Actions.Weights.Ask, "")
+	flag.IntVar(&a.NetArgs.Actions.Weights.Bid, "weight-bid", argDefaults.NetArgs.Actions.Weights.Bid, "")
+	flag.IntVar(&a.NetArgs.Actions.Weights.Deal, "weight-deal", argDefaults.NetArgs.Actions.Weights.Deal, "")
+	flag.IntVar(&a.NetArgs.Actions.Weights.Payment, "weight-payment", argDefaults.NetArgs.Actions.Weights.Payment, "")
+	flag.IntVar(&a.NetArgs.Actions.Weights.SendFile, "weight-retrieval", argDefaults.NetArgs.Actions.Weights.SendFile, "")
+
 	flag.Parse()
 
 	return a
 }
 
 type Instance struct {
-	N *network.Network
-	R *network.Randomizer
-	L io.Reader
+	N      *network.Network
+	R      *network.Randomizer
+	S      *scenario.Runner // runs instead of R, if set
+	L      io.Reader
+	Sup    *network.Supervisor
+	Stats  *logs.Stats     // counts the events read from L
+	Report *report.Builder // summarizes the events read from L
 }
 
 func SetupInstance(args Args) (*Instance, error) {
@@ -145,25 +317,131 @@ func SetupInstance(args Args) (*Instance, error) {
 		dir = "/tmp/filnetsim"
 	}
 
-	n, err := network.NewNetwork(dir)
+	topo, err := network.ParseTopology(args.Topology)
 	if err != nil {
 		return nil, err
 	}
 
+	n, err := newNetwork(args.Backend, dir)
+	if err != nil {
+		return nil, err
+	}
+	n.SetTopology(topo)
+	n.SetTimeouts(args.Timeouts)
+	n.SetSpawnParallelism(args.SpawnPar)
+
+	if args.LinkFile != "" || !args.Link.Zero() {
+		conf, err := linksConfig(args)
+		if err != nil {
+			return nil, err
+		}
+		if args.Backend != "daemon" {
+			fmt.Printf("links only apply to the daemon backend, not %s\n", args.Backend)
+		}
+		n.SetLinks(conf)
+	}
+
 	r := network.NewRandomizer(n, args.NetArgs)
-	l := n.Logs().Reader()
-	return &Instance{n, r, l}, nil
+	stats := logs.NewStats()
+	rb := report.NewBuilder()
+	l := io.TeeReader(n.Logs().Reader(), io.MultiWriter(stats, rb))
+	sup := network.NewSupervisor(2 * args.Timeouts.Max())
+	i := &Instance{N: n, R: r, L: l, Sup: sup, Stats: stats, Report: rb}
+
+	if args.Scenario != "" {
+		s, err := scenario.Load(args.Scenario)
+		if err != nil {
+			return nil, err
+		}
+		i.S = scenario.NewRunner(n, s, args.NetArgs.TestfilesDir, r.Args().Seed)
+	}
+	return i, nil
+}
+
+// NodeAddrs finds a node, for the node= filter. Its events are from or
+// to its wallet, and its miner, once it has one.
+func (i *Instance) NodeAddrs(id string) (func() []string, error) {
+	nd := i.N.GetNodeByID(id)
+	if nd == nil {
+		return nil, fmt.Errorf("no node %q", id)
+	}
+
+	return func() []string {
+		addrs := []string{nd.WalletAddr}
+		if m := nd.GetMinerIdentity(); m != "" {
+			addrs = append(addrs, m)
+		}
+		return addrs
+	}, nil
+}
+
+func linksConfig(args Args) (*linkproxy.Config, error) {
+	if err := args.Link.Validate(); err != nil {
+		return nil, err
+	}
+	if args.LinkFile == "" {
+		return &linkproxy.Config{Default: args.Link}, nil
+	}
+	return linkproxy.LoadConfig(args.LinkFile, args.Link)
+}
+
+func newNetwork(backend, dir string) (*network.Network, error) {
+	switch backend {
+	case "daemon":
+		return network.NewNetwork(dir)
+	case "fake":
+		return network.NewNetworkWithBackend(dir, network.NewFakeChain().NewBackend), nil
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", backend)
+	}
 }
 
+// superviseInterval is how often to look for hung cli processes.
+const superviseInterval = 10 * time.Second
+
 func (i *Instance) Run(ctx context.Context) {
 	defer i.N.ShutdownAll()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	i.R.Run(ctx)
+
+	go i.Sup.Run(ctx, superviseInterval)
+
+	if i.S != nil {
+		go func() {
+			if err := i.S.Run(ctx); err != nil {
+				log.Printf("[SCEN]\t %s\n", err)
+			}
+		}()
+	} else {
+		i.R.Run(ctx)
+	}
 	<-ctx.Done()
 }
 
 func runService(ctx context.Context, args Args) error {
+	slow, err := ParseSlowPolicy(args.SlowCli)
+	if err != nil {
+		return err
+	}
+	if args.LogQueue < 1 {
+		return fmt.Errorf("--log-queue must be at least 1: %d", args.LogQueue)
+	}
+	if err := args.NetArgs.Validate(); err != nil {
+		return err
+	}
+
+	var sinks []io.Writer
+	if args.Record != "" {
+		f, err := os.Create(args.Record)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		sinks = append(sinks, logs.NewRecorder(f))
+		fmt.Printf("Recording logs to %s\n", args.Record)
+	}
+
 	i, err := SetupInstance(args)
 	if err != nil {
 		return err
@@ -172,15 +450,56 @@ func runService(ctx context.Context, args Args) error {
 	// s.logs = i.L
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	go i.Run(ctx)
+	done := make(chan struct{})
+	go func() {
+		i.Run(ctx)
+		close(done)
+	}()
 
-	lh := NewLogHandler(ctx, i.L)
+	// logs flow from the start, into the sinks and the catch-up buffer,
+	// whether or not anyone is watching.
+	lh := NewLogHandler(ctx, i.L, args.ReplayWin, sinks...)
+	lh.NodeAddrs = i.NodeAddrs
+	lh.QueueSize = args.LogQueue
+	lh.SlowPolicy = slow
+
+	go readKeys(os.Stdin, os.Stdout, i.R)
+	fmt.Println(keysHelp)
+
+	err = serve(ctx, lh, NewAPI(i), &MetricsHandler{I: i, LH: lh}, args.Port)
+
+	// stop. lh keeps reading the logs while the nodes shut down, and then
+	// to their end, so the sinks and the report get all of them.
+	cancel()
+	fmt.Println("Shutting down nodes")
+	<-done
+	i.N.Logs().Close()
+	lh.Wait()
+
+	if args.Report != "" {
+		if err2 := writeReport(i.Report.Report(), args.Report); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
 
+// serve serves the visualizations, the logs from lh, and api and metrics
+// if not nil, until ctx is done.
+func serve(ctx context.Context, lh *LogHandler, api *API, metrics *MetricsHandler, port int) error {
 	muxA := http.NewServeMux()
 	muxB := http.NewServeMux()
 
 	muxA.Handle("/", http.FileServer(http.Dir(VizDir)))
 	muxA.HandleFunc("/logs", lh.HandleHttp)
+	muxA.HandleFunc("/logs/sse", lh.HandleSSE)
+	muxA.HandleFunc("/logs/ws", lh.HandleWS)
+	if api != nil {
+		muxA.Handle("/api/", api)
+	}
+	if metrics != nil {
+		muxA.Handle("/metrics", metrics)
+	}
 	muxB.Handle("/", http.FileServer(http.Dir(ExplorerDir)))
 
 	go func() {
@@ -188,11 +507,27 @@ func runService(ctx context.Context, args Args) error {
 	}()
 
 	// run http
-	addr := fmt.Sprintf("127.0.0.1:%d", args.Port)
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
 	fmt.Printf("Logs at http://%s/logs\n", addr)
+	fmt.Printf("Logs as Server-Sent Events at http://%s/logs/sse, and over a WebSocket at ws://%s/logs/ws\n", addr, addr)
 	fmt.Printf("Network Viz at http://%s/viz-circle\n", addr)
 	fmt.Printf("Chain Viz at http://%s/viz-blockchain\n", addr)
-	return http.ListenAndServe(addr, muxA)
+	if api != nil {
+		fmt.Printf("Control API at http://%s/api/\n", addr)
+	}
+	if metrics != nil {
+		fmt.Printf("Metrics at http://%s/metrics\n", addr)
+	}
+
+	srv := &http.Server{Addr: addr, Handler: muxA, ConnContext: WithConn}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
 func run(args Args) error {
@@ -204,15 +539,40 @@ func run(args Args) error {
 		log.SetOutput(ioutil.Discard)
 	}
 
-	// check we're being run from a dir with filecoin-network-viz
+	if err := checkVizDir(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return runService(ctx, args)
+}
+
+// checkVizDir checks we're being run from a dir with filecoin-network-viz
+func checkVizDir() error {
 	if _, err := os.Stat(VizDir); err != nil {
 		return fmt.Errorf("must be run from directory with %s\n", VizDir)
 	}
-
-	return runService(context.Background(), args)
+	return nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		if err := runReport(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := run(parseArgs()); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err)
 		os.Exit(1)
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	events "github.com/filecoin-project/filecoin-network-sim/logs/events"
+	metrics "github.com/filecoin-project/filecoin-network-sim/metrics"
+	network "github.com/filecoin-project/filecoin-network-sim/network"
+)
+
+// MetricsHandler serves the numbers of a running sim at /metrics, in the
+// Prometheus text exposition format.
+type MetricsHandler struct {
+	I  *Instance
+	LH *LogHandler
+}
+
+func (m *MetricsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	mw := metrics.NewWriter(w)
+	m.write(mw)
+	if err := mw.Err(); err != nil {
+		log.Printf("failed to write metrics: %s\n", err)
+	}
+}
+
+func (m *MetricsHandler) write(mw *metrics.Writer) {
+	n, r, st := m.I.N, m.I.R, m.I.Stats
+
+	mw.Header("filnetsim_nodes", "gauge", "Nodes in the network, by type.")
+	counts := n.GetNodeCounts()
+	for _, t := range []network.NodeType{network.MinerNodeType, network.ClientNodeType} {
+		mw.Sample("filnetsim_nodes", metrics.Labels{"type": string(t)}, float64(counts[t]))
+	}
+
+	actions := r.ActionCounts()
+	mw.Header("filnetsim_actions_attempted_total", "counter", "Random actions attempted.")
+	for _, a := range network.AllActions {
+		mw.Sample("filnetsim_actions_attempted_total", metrics.Labels{"action": a.String()}, float64(actions[a].Attempted))
+	}
+	mw.Header("filnetsim_actions_succeeded_total", "counter", "Random actions that succeeded.")
+	for _, a := range network.AllActions {
+		mw.Sample("filnetsim_actions_succeeded_total", metrics.Labels{"action": a.String()}, float64(actions[a].Succeeded()))
+	}
+	mw.Header("filnetsim_actions_failed_total", "counter", "Random actions that failed.")
+	for _, a := range network.AllActions {
+		mw.Sample("filnetsim_actions_failed_total", metrics.Labels{"action": a.String()}, float64(actions[a].Failed))
+	}
+
+	mw.Header("filnetsim_blocks_mined_total", "counter", "Blocks mined (NewBlockMined events).")
+	mw.Sample("filnetsim_blocks_mined_total", nil, float64(st.Count(events.TypeNewBlockMined)))
+	mw.Header("filnetsim_forks_total", "counter", "Heights at which more than one block was mined.")
+	mw.Sample("filnetsim_forks_total", nil, float64(st.Forks()))
+	mw.Header("filnetsim_deals_proposed_total", "counter", "Deals proposed (MakeDeal events).")
+	mw.Sample("filnetsim_deals_proposed_total", nil, float64(st.Count(events.TypeMakeDeal)))
+	mw.Header("filnetsim_deals_finished_total", "counter", "Deals finished (FinishDeal events).")
+	mw.Sample("filnetsim_deals_finished_total", nil, float64(st.Count(events.TypeFinishDeal)))
+	mw.Header("filnetsim_payments_total", "counter", "Payments sent (SendPayment events).")
+	mw.Sample("filnetsim_payments_total", nil, float64(st.Count(events.TypeSendPayment)))
+
+	latencies := n.Latencies()
+	var ops []string
+	for op := range latencies {
+		ops = append(ops, string(op))
+	}
+	sort.Strings(ops)
+	mw.Header("filnetsim_cli_call_duration_seconds", "histogram", "How long daemon cli calls took, by op.")
+	for _, op := range ops {
+		mw.Histogram("filnetsim_cli_call_duration_seconds", metrics.Labels{"op": op}, latencies[network.Op(op)])
+	}
+
+	timeouts := n.TimeoutCounts()
+	mw.Header("filnetsim_cli_timeouts_total", "counter", "Daemon cli calls that timed out, by op.")
+	for _, op := range network.Ops {
+		mw.Sample("filnetsim_cli_timeouts_total", metrics.Labels{"op": string(op)}, float64(timeouts[op]))
+	}
+	mw.Header("filnetsim_cli_reaped_total", "counter", "Hung cli processes killed by the supervisor.")
+	mw.Sample("filnetsim_cli_reaped_total", nil, float64(m.I.Sup.Killed()))
+
+	mw.Header("filnetsim_log_writers", "gauge", "Writers the sim logs go to: /logs clients, and the recorder.")
+	mw.Sample("filnetsim_log_writers", nil, float64(m.LH.Writers()))
+	mw.Header("filnetsim_log_dropped_total", "counter", "Log lines dropped for clients that fell too far behind.")
+	mw.Sample("filnetsim_log_dropped_total", nil, float64(m.LH.Dropped()))
+
+	clients := m.LH.Clients()
+	mw.Header("filnetsim_log_client_queued", "gauge", "Log lines waiting to be written to each client.")
+	for _, c := range clients {
+		mw.Sample("filnetsim_log_client_queued", metrics.Labels{"client": c.Addr, "transport": c.Transport}, float64(c.Queued))
+	}
+	mw.Header("filnetsim_log_client_dropped_total", "counter", "Log lines dropped for each client, for falling too far behind.")
+	for _, c := range clients {
+		mw.Sample("filnetsim_log_client_dropped_total", metrics.Labels{"client": c.Addr, "transport": c.Transport}, float64(c.Dropped))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	network "github.com/filecoin-project/filecoin-network-sim/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	args := argDefaults
+	args.Backend = "fake"
+
+	i, err := SetupInstance(args)
+	require.NoError(t, err)
+	defer i.N.ShutdownAll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lh := NewLogHandler(ctx, i.L, DefaultWindow)
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	lh.AddWriter(pw)
+	go io.Copy(ioutil.Discard, pr)
+
+	_, err = i.N.AddNode(network.MinerNodeType)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return lh.Writers() == 1 }, time.Second, 10*time.Millisecond)
+
+	s := httptest.NewServer(&MetricsHandler{I: i, LH: lh})
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	m := string(body)
+	assert.Contains(t, m, "# TYPE filnetsim_nodes gauge\n")
+	assert.Contains(t, m, "filnetsim_nodes{type=\"Miner\"} 1\n")
+	assert.Contains(t, m, "filnetsim_actions_attempted_total{action=\"Ask\"} 0\n")
+	assert.Contains(t, m, "filnetsim_cli_call_duration_seconds_count{op=\"mine\"} 1\n")
+	assert.Contains(t, m, "filnetsim_cli_timeouts_total{op=\"deal\"} 0\n")
+	assert.Contains(t, m, "filnetsim_forks_total 0\n")
+	assert.Contains(t, m, "filnetsim_log_writers 1\n")
+	assert.Contains(t, m, "filnetsim_log_dropped_total 0\n")
+}
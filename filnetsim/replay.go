@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	logs "github.com/filecoin-project/filecoin-network-sim/logs"
+)
+
+type ReplayArgs struct {
+	File  string
+	Speed Speed
+	Port  int
+	Debug bool
+}
+
+// Speed is a replay speed factor, written like "2x", "0.5x" or "2".
+type Speed float64
+
+func (s *Speed) String() string {
+	return strconv.FormatFloat(float64(*s), 'g', -1, 64) + "x"
+}
+
+func (s *Speed) Set(v string) error {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(v, "x"), 64)
+	if err != nil {
+		return fmt.Errorf("invalid speed: %q", v)
+	}
+	if f <= 0 {
+		return fmt.Errorf("speed must be positive: %q", v)
+	}
+	*s = Speed(f)
+	return nil
+}
+
+// parseReplayArgs parses the args after "replay". Flags may come before
+// or after the file.
+func parseReplayArgs(args []string) (ReplayArgs, error) {
+	a := ReplayArgs{Speed: 1, Port: argDefaults.Port}
+
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(&a.Speed, "speed", "")
+	fs.IntVar(&a.Port, "port", a.Port, "")
+	fs.BoolVar(&a.Debug, "debug", a.Debug, "")
+
+	var files []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return a, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(files) != 1 {
+		return a, fmt.Errorf("usage: filnetsim replay <file> [--speed 2x] [--port port]")
+	}
+	a.File = files[0]
+	return a, nil
+}
+
+// runReplay serves a recording made with --record, without running a network.
+func runReplay(argv []string) error {
+	args, err := parseReplayArgs(argv)
+	if err != nil {
+		return err
+	}
+
+	if args.Debug {
+		log.SetOutput(os.Stderr)
+	} else {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	if err := checkVizDir(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(args.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	go func() {
+		err := logs.Replay(ctx, f, pw, float64(args.Speed))
+		if err == nil {
+			fmt.Println("Replay finished")
+		}
+		pw.CloseWithError(err)
+	}()
+
+	fmt.Printf("Replaying %s at %s\n", args.File, &args.Speed)
+	return serve(ctx, NewLogHandler(ctx, pr, DefaultWindow), nil, nil, args.Port)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReplayArgs(t *testing.T) {
+	a, err := parseReplayArgs([]string{"out.ndjson", "--speed", "2x"})
+	require.NoError(t, err)
+	assert.Equal(t, "out.ndjson", a.File)
+	assert.Equal(t, Speed(2), a.Speed)
+	assert.Equal(t, argDefaults.Port, a.Port)
+
+	a, err = parseReplayArgs([]string{"--port", "8000", "--speed=0.5", "out.ndjson"})
+	require.NoError(t, err)
+	assert.Equal(t, "out.ndjson", a.File)
+	assert.Equal(t, Speed(0.5), a.Speed)
+	assert.Equal(t, 8000, a.Port)
+
+	_, err = parseReplayArgs([]string{"out.ndjson", "--speed", "fast"})
+	assert.Error(t, err)
+	_, err = parseReplayArgs([]string{"--speed", "-1x", "out.ndjson"})
+	assert.Error(t, err)
+	_, err = parseReplayArgs([]string{})
+	assert.Error(t, err)
+	_, err = parseReplayArgs([]string{"a.ndjson", "b.ndjson"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	logs "github.com/filecoin-project/filecoin-network-sim/logs"
+	report "github.com/filecoin-project/filecoin-network-sim/report"
+)
+
+type ReportArgs struct {
+	File string
+	Out  string // file prefix, or "" for markdown on stdout
+}
+
+// parseReportArgs parses the args after "report". Flags may come before
+// or after the file.
+func parseReportArgs(args []string) (ReportArgs, error) {
+	a := ReportArgs{}
+
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.StringVar(&a.Out, "out", a.Out, "")
+
+	var files []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return a, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(files) != 1 {
+		return a, fmt.Errorf("usage: filnetsim report <file> [--out prefix]")
+	}
+	a.File = files[0]
+	return a, nil
+}
+
+// runReport writes the report of a recording made with --record.
+func runReport(argv []string) error {
+	args, err := parseReportArgs(argv)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b := report.NewBuilder()
+	if err := logs.CopyEvents(f, b); err != nil {
+		return err
+	}
+
+	if args.Out == "" {
+		return b.Report().WriteMarkdown(os.Stdout)
+	}
+	return writeReport(b.Report(), args.Out)
+}
+
+// writeReport writes r to prefix.json and prefix.md.
+func writeReport(r *report.Report, prefix string) error {
+	jf, err := os.Create(prefix + ".json")
+	if err != nil {
+		return err
+	}
+	defer jf.Close()
+	if err := r.WriteJSON(jf); err != nil {
+		return err
+	}
+
+	mf, err := os.Create(prefix + ".md")
+	if err != nil {
+		return err
+	}
+	defer mf.Close()
+	if err := r.WriteMarkdown(mf); err != nil {
+		return err
+	}
+
+	fmt.Printf("Report written to %s.json and %s.md\n", prefix, prefix)
+	return nil
+}
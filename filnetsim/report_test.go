@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	report "github.com/filecoin-project/filecoin-network-sim/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReport(t *testing.T) {
+	a, err := parseReportArgs([]string{"--out", "run1", "out.ndjson"})
+	require.NoError(t, err)
+	assert.Equal(t, ReportArgs{File: "out.ndjson", Out: "run1"}, a)
+	_, err = parseReportArgs([]string{})
+	assert.Error(t, err)
+
+	dir, err := ioutil.TempDir("", "filnetsim-report")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	rec := filepath.Join(dir, "out.ndjson")
+	require.NoError(t, ioutil.WriteFile(rec, []byte(
+		`{"at":0,"event":{"type":"MinerJoins","from":"m1","time":"2018-01-01T00:00:00Z"}}`+"\n"+
+			`{"at":1000000000,"event":{"type":"NewBlockMined","from":"m1","time":"2018-01-01T00:00:01Z","block":"b1","height":1,"reward":"20"}}`+"\n"), 0644))
+
+	prefix := filepath.Join(dir, "run1")
+	require.NoError(t, runReport([]string{rec, "--out", prefix}))
+
+	buf, err := ioutil.ReadFile(prefix + ".json")
+	require.NoError(t, err)
+	var r report.Report
+	require.NoError(t, json.Unmarshal(buf, &r))
+	assert.Equal(t, 2, r.Events)
+	assert.Equal(t, uint64(1), r.Chain.Height)
+	require.Len(t, r.Miners, 1)
+	assert.Equal(t, report.Miner{Addr: "m1", Blocks: 1, Won: 1, Rewards: 20}, r.Miners[0])
+
+	md, err := ioutil.ReadFile(prefix + ".md")
+	require.NoError(t, err)
+	assert.Contains(t, string(md), "| m1 | 1 | 1 | 20 |")
+
+	assert.Error(t, runReport([]string{filepath.Join(dir, "missing.ndjson")}))
+}
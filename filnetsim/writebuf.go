@@ -1,55 +1,171 @@
 package main
 
 import (
-	"container/ring"
-	"io"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-type RingWriter struct {
-	ring *ring.Ring
+// Window is how much of the logs to keep for new writers to catch up
+// with. It is written as limits, separated by commas: a number of lines
+// ("5000"), a size ("50MB") or an age ("10m"). Lines go once they are past
+// any limit. A zero limit is no limit.
+type Window struct {
+	Lines int
+	Bytes int64
+	Age   time.Duration
 }
 
-func NewRingWriter(size int) *RingWriter {
-	return &RingWriter{ring.New(size)}
-}
+var DefaultWindow = Window{Lines: LogBufferSize}
 
-func (b *RingWriter) Write(buf []byte) (int, error) {
-	// copy it because we cant keep buf
-	buf2 := make([]byte, len(buf))
-	copy(buf2, buf)
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1e9},
+	{"MB", 1e6},
+	{"KB", 1e3},
+	{"B", 1},
+}
 
-	b.ring.Value = buf2
-	b.ring = b.ring.Next() // advance the ring. points to the oldest (or unused) entry
-	return len(buf2), nil
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if err := w.setLimit(part); err != nil {
+			return Window{}, fmt.Errorf("invalid window %q: %s", s, err)
+		}
+	}
+	if w == (Window{}) {
+		return Window{}, fmt.Errorf("invalid window %q: it needs a limit", s)
+	}
+	return w, nil
 }
 
-func (b *RingWriter) WriteTo(w io.Writer) (int, error) {
-	total := 0
-	hasFailed := false
-	var outErr error
+func (w *Window) setLimit(part string) error {
+	upper := strings.ToUpper(part)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(upper, u.suffix) {
+			f, err := strconv.ParseFloat(strings.TrimSpace(part[:len(part)-len(u.suffix)]), 64)
+			if err != nil || f < 0 {
+				return fmt.Errorf("bad size %q", part)
+			}
+			w.Bytes = int64(f * float64(u.size))
+			return nil
+		}
+	}
 
-	// printing the ring (from the handle we keep) starts from the oldest entry.
-	b.ring.Do(func(v interface{}) {
-		if hasFailed {
-			return
+	if n, err := strconv.Atoi(part); err == nil {
+		if n < 0 {
+			return fmt.Errorf("bad number of lines %q", part)
 		}
+		w.Lines = n
+		return nil
+	}
+
+	d, err := time.ParseDuration(part)
+	if err != nil || d < 0 {
+		return fmt.Errorf("%q is not a number of lines, size or age", part)
+	}
+	w.Age = d
+	return nil
+}
 
-		if v == nil {
-			return
+func (w Window) String() string {
+	var parts []string
+	if w.Lines > 0 {
+		parts = append(parts, strconv.Itoa(w.Lines))
+	}
+	if w.Bytes > 0 {
+		parts = append(parts, formatBytes(w.Bytes))
+	}
+	if w.Age > 0 {
+		parts = append(parts, w.Age.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set makes *Window a flag.Value.
+func (w *Window) Set(s string) error {
+	v, err := ParseWindow(s)
+	if err != nil {
+		return err
+	}
+	*w = v
+	return nil
+}
+
+func formatBytes(b int64) string {
+	for _, u := range byteUnits {
+		if b >= u.size && b%u.size == 0 {
+			return strconv.FormatInt(b/u.size, 10) + u.suffix
 		}
+	}
+	return strconv.FormatInt(b, 10) + "B"
+}
 
-		buf := v.([]byte)
-		if len(buf) < 1 {
-			return
+type bufLine struct {
+	seq  uint64
+	line []byte
+	at   time.Time
+}
+
+// LineBuffer keeps the last lines of the logs, within a Window, with
+// their sequence numbers.
+type LineBuffer struct {
+	win   Window
+	lines []bufLine // oldest first
+	bytes int64
+
+	now func() time.Time
+}
+
+func NewLineBuffer(win Window) *LineBuffer {
+	return &LineBuffer{win: win, now: time.Now}
+}
+
+// Add keeps line, numbered seq, and lets go of the lines now out of the
+// window. Lines must be added in seq order.
+func (b *LineBuffer) Add(seq uint64, line []byte) {
+	// copy it because we cant keep line
+	b.lines = append(b.lines, bufLine{seq, append([]byte(nil), line...), b.now()})
+	b.bytes += int64(len(line))
+	b.trim()
+}
+
+func (b *LineBuffer) trim() {
+	now := b.now()
+	i := 0
+	for ; i < len(b.lines); i++ {
+		l := b.lines[i]
+		over := (b.win.Lines > 0 && len(b.lines)-i > b.win.Lines) ||
+			(b.win.Bytes > 0 && b.bytes > b.win.Bytes) ||
+			(b.win.Age > 0 && now.Sub(l.at) > b.win.Age)
+		if !over {
+			break
 		}
+		b.bytes -= int64(len(l.line))
+		b.lines[i] = bufLine{} // let go of it
+	}
+	b.lines = b.lines[i:]
+}
 
-		n, err := w.Write(buf)
-		total += n
-		if err != nil {
-			outErr = err
-			hasFailed = true // short circuit from now on.
+// Since calls f with each line kept after seq, oldest first, until f
+// fails.
+func (b *LineBuffer) Since(seq uint64, f func(seq uint64, line []byte) error) error {
+	b.trim()
+	i := sort.Search(len(b.lines), func(i int) bool { return b.lines[i].seq > seq })
+	for _, l := range b.lines[i:] {
+		if err := f(l.seq, l.line); err != nil {
+			return err
 		}
-	})
+	}
+	return nil
+}
 
-	return total, outErr
+// Len returns how many lines are kept, and their size.
+func (b *LineBuffer) Len() (lines int, bytes int64) {
+	return len(b.lines), b.bytes
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindow(t *testing.T) {
+	cases := map[string]Window{
+		"5000":          {Lines: 5000},
+		"50MB":          {Bytes: 50e6},
+		"10m":           {Age: 10 * time.Minute},
+		"10m, 1.5kb, 7": {Lines: 7, Bytes: 1500, Age: 10 * time.Minute},
+	}
+	for s, want := range cases {
+		w, err := ParseWindow(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, w, s)
+	}
+	assert.Equal(t, "7,1500B,10m0s", cases["10m, 1.5kb, 7"].String())
+	assert.Equal(t, "50MB", cases["50MB"].String())
+
+	for _, s := range []string{"", "0", "soon", "-1", "-5MB", "10m,"} {
+		_, err := ParseWindow(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLineBuffer(t *testing.T) {
+	now := time.Now()
+	b := NewLineBuffer(Window{Lines: 3, Bytes: 10, Age: time.Minute})
+	b.now = func() time.Time { return now }
+
+	since := func(seq uint64) []string {
+		var got []string
+		require.NoError(t, b.Since(seq, func(seq uint64, line []byte) error {
+			got = append(got, fmt.Sprintf("%d:%s", seq, line))
+			return nil
+		}))
+		return got
+	}
+
+	// by count.
+	for seq := uint64(1); seq <= 4; seq++ {
+		b.Add(seq, []byte("a\n"))
+	}
+	assert.Equal(t, []string{"2:a\n", "3:a\n", "4:a\n"}, since(0))
+	assert.Equal(t, []string{"4:a\n"}, since(3))
+	assert.Empty(t, since(4))
+
+	// by size.
+	b.Add(5, []byte("bbbbbb\n"))
+	assert.Equal(t, []string{"4:a\n", "5:bbbbbb\n"}, since(0))
+	lines, bytes := b.Len()
+	assert.Equal(t, 2, lines)
+	assert.Equal(t, int64(9), bytes)
+
+	// by age.
+	now = now.Add(30 * time.Second)
+	b.Add(6, []byte("c\n"))
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, []string{"6:c\n"}, since(0))
+
+	assert.Equal(t, assert.AnError, b.Since(0, func(uint64, []byte) error { return assert.AnError }))
+}
@@ -0,0 +1,201 @@
+package linkproxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config sets the links between nodes. Nodes are placed in Regions, and
+// the link between two nodes is the one Between their regions, or Default.
+//
+//	default:
+//	  latency: 10ms
+//	  jitter: 2ms
+//	regions:
+//	  - name: us
+//	    weight: 2
+//	  - name: eu
+//	links:
+//	  - between: [us, eu]
+//	    latency: 80ms
+//	    jitter: 10ms
+//	    dist: uniform
+//	    bandwidth: 1MB
+//	    loss: 0.01
+type Config struct {
+	Default Link         `yaml:"default"`
+	Regions []Region     `yaml:"regions"`
+	Links   []RegionLink `yaml:"links"`
+}
+
+// Region is a group of nodes, like a geographic region. Weight is how
+// many nodes it gets, relative to other regions. 0 means 1.
+type Region struct {
+	Name   string `yaml:"name"`
+	Weight int    `yaml:"weight"`
+}
+
+// RegionLink is the link between nodes in two regions, or within one, if
+// both are the same.
+type RegionLink struct {
+	Between [2]string
+	Link    Link
+
+	y linkYAML // as written, to apply over the default
+}
+
+// LoadConfig reads a config file, in YAML. The fields of its links it
+// does not set are taken from def.
+func LoadConfig(path string, def Link) (*Config, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(buf, def)
+}
+
+func ParseConfig(buf []byte, def Link) (*Config, error) {
+	c := &Config{Default: def}
+	if err := yaml.Unmarshal(buf, c); err != nil {
+		return nil, err
+	}
+
+	// region links set fields over the default.
+	for i := range c.Links {
+		l := &c.Links[i]
+		l.Link = c.Default
+		if err := l.y.apply(&l.Link); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, c.validate()
+}
+
+func (c *Config) validate() error {
+	if err := c.Default.Validate(); err != nil {
+		return fmt.Errorf("default: %s", err)
+	}
+
+	regions := map[string]bool{}
+	for _, r := range c.Regions {
+		if r.Name == "" || regions[r.Name] {
+			return fmt.Errorf("regions need unique names: %q", r.Name)
+		}
+		if r.Weight < 0 {
+			return fmt.Errorf("region %s: weight must not be negative", r.Name)
+		}
+		regions[r.Name] = true
+	}
+
+	for _, l := range c.Links {
+		name := fmt.Sprintf("link between %s and %s", l.Between[0], l.Between[1])
+		if !regions[l.Between[0]] || !regions[l.Between[1]] {
+			return fmt.Errorf("%s: unknown region", name)
+		}
+		if err := l.Link.Validate(); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Link returns the link between nodes in regions a and b.
+func (c *Config) Link(a, b string) Link {
+	for _, l := range c.Links {
+		if (l.Between[0] == a && l.Between[1] == b) || (l.Between[0] == b && l.Between[1] == a) {
+			return l.Link
+		}
+	}
+	return c.Default
+}
+
+// PickRegion picks the region of a new node, by the regions' weights. It
+// returns "" if there are no regions.
+func (c *Config) PickRegion(rng *rand.Rand) string {
+	total := 0
+	for _, r := range c.Regions {
+		total += r.weight()
+	}
+	if total == 0 {
+		return ""
+	}
+
+	i := rng.Intn(total)
+	for _, r := range c.Regions {
+		if i < r.weight() {
+			return r.Name
+		}
+		i -= r.weight()
+	}
+	panic("unreachable")
+}
+
+func (r Region) weight() int {
+	if r.Weight == 0 {
+		return 1
+	}
+	return r.Weight
+}
+
+// linkYAML is a Link as written in a config. Fields it does not set keep
+// their value.
+type linkYAML struct {
+	Latency   *string  `yaml:"latency"`
+	Jitter    *string  `yaml:"jitter"`
+	Dist      *string  `yaml:"dist"`
+	Bandwidth *string  `yaml:"bandwidth"`
+	Loss      *float64 `yaml:"loss"`
+}
+
+func (y linkYAML) apply(l *Link) error {
+	var err error
+	if y.Latency != nil {
+		if l.Latency, err = time.ParseDuration(*y.Latency); err != nil {
+			return err
+		}
+	}
+	if y.Jitter != nil {
+		if l.Jitter, err = time.ParseDuration(*y.Jitter); err != nil {
+			return err
+		}
+	}
+	if y.Dist != nil {
+		l.Dist = *y.Dist
+	}
+	if y.Bandwidth != nil {
+		if l.Bandwidth, err = ParseBandwidth(*y.Bandwidth); err != nil {
+			return err
+		}
+	}
+	if y.Loss != nil {
+		l.Loss = *y.Loss
+	}
+	return nil
+}
+
+func (l *Link) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var y linkYAML
+	if err := unmarshal(&y); err != nil {
+		return err
+	}
+	return y.apply(l)
+}
+
+func (l *RegionLink) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var b struct {
+		Between []string `yaml:"between"`
+	}
+	if err := unmarshal(&b); err != nil {
+		return err
+	}
+	if len(b.Between) != 2 {
+		return fmt.Errorf("links need two regions, between: [a, b]")
+	}
+	copy(l.Between[:], b.Between)
+	return unmarshal(&l.y)
+}
@@ -0,0 +1,151 @@
+// Package linkproxy simulates network links between nodes on one machine:
+// a Proxy forwards TCP connections to a node through a Link, with its
+// latency, bandwidth and loss.
+package linkproxy
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retransmitTimeout is how long TCP waits before resending a lost
+// segment, at least. It is Linux's minimum RTO.
+const retransmitTimeout = 200 * time.Millisecond
+
+// Link describes one direction of a link between two nodes. Proxies apply
+// it to each direction of a connection.
+type Link struct {
+	Latency   time.Duration // one way
+	Jitter    time.Duration
+	Dist      string    // distribution of latency: "normal" (the default), with stddev Jitter, or "uniform", in Latency ± Jitter
+	Bandwidth Bandwidth // 0 means unlimited
+	Loss      float64   // probability a segment is lost
+}
+
+// Zero returns whether the link changes nothing.
+func (l Link) Zero() bool {
+	return l.Latency == 0 && l.Jitter == 0 && l.Bandwidth == 0 && l.Loss == 0
+}
+
+func (l Link) Validate() error {
+	if l.Latency < 0 || l.Jitter < 0 {
+		return fmt.Errorf("link latency and jitter must not be negative")
+	}
+	if l.Bandwidth < 0 {
+		return fmt.Errorf("link bandwidth must not be negative")
+	}
+	if l.Loss < 0 || l.Loss > 1 {
+		return fmt.Errorf("link loss must be in [0, 1]: %f", l.Loss)
+	}
+	switch l.Dist {
+	case "", "normal", "uniform":
+	default:
+		return fmt.Errorf("unknown latency distribution: %q", l.Dist)
+	}
+	return nil
+}
+
+func (l Link) String() string {
+	return fmt.Sprintf("latency %s ± %s (%s), bandwidth %s, loss %g", l.Latency, l.Jitter, l.dist(), l.Bandwidth, l.Loss)
+}
+
+func (l Link) dist() string {
+	if l.Dist == "" {
+		return "normal"
+	}
+	return l.Dist
+}
+
+// delay returns how long one segment takes to arrive, after it was sent.
+// TCP does not lose data, so a lost segment arrives late instead, after
+// it is retransmitted.
+func (l Link) delay(rng *rand.Rand) time.Duration {
+	d := l.Latency
+	if l.Jitter > 0 {
+		switch l.dist() {
+		case "uniform":
+			d += time.Duration((rng.Float64()*2 - 1) * float64(l.Jitter))
+		default:
+			d += time.Duration(rng.NormFloat64() * float64(l.Jitter))
+		}
+	}
+	if d < 0 {
+		d = 0
+	}
+
+	for l.Loss > 0 && rng.Float64() < l.Loss {
+		d += retransmitTimeout + 2*l.Latency
+		if l.Loss >= 1 {
+			break // lost once, not forever.
+		}
+	}
+	return d
+}
+
+// transmit returns how long sending n bytes takes, at the link's bandwidth.
+func (l Link) transmit(n int) time.Duration {
+	if l.Bandwidth <= 0 {
+		return 0
+	}
+	return time.Duration(float64(n) / float64(l.Bandwidth) * float64(time.Second))
+}
+
+// Bandwidth is a rate in bytes per second, written like "1MB", "500KB" or
+// "2000". Units are powers of 1000.
+type Bandwidth int64
+
+var units = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1e9},
+	{"MB", 1e6},
+	{"KB", 1e3},
+	{"B", 1},
+}
+
+func ParseBandwidth(s string) (Bandwidth, error) {
+	if s == "unlimited" {
+		return 0, nil
+	}
+
+	num, size := strings.TrimSpace(s), int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(num), u.suffix) {
+			num, size = strings.TrimSpace(num[:len(num)-len(u.suffix)]), u.size
+			break
+		}
+	}
+
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid bandwidth: %q", s)
+	}
+	return Bandwidth(f * float64(size)), nil
+}
+
+func (b Bandwidth) String() string {
+	if b == 0 {
+		return "unlimited"
+	}
+	for _, u := range units {
+		if int64(b) >= u.size && int64(b)%u.size == 0 {
+			return strconv.FormatInt(int64(b)/u.size, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+// Set makes *Bandwidth a flag.Value.
+func (b *Bandwidth) Set(s string) error {
+	v, err := ParseBandwidth(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
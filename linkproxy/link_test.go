@@ -0,0 +1,90 @@
+package linkproxy
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	cases := map[string]Bandwidth{
+		"2000":      2000,
+		"1MB":       1e6,
+		"500KB":     500e3,
+		"1.5 mb":    1.5e6,
+		"unlimited": 0,
+	}
+	for s, want := range cases {
+		b, err := ParseBandwidth(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, b, s)
+	}
+
+	assert.Equal(t, "1MB", Bandwidth(1e6).String())
+	assert.Equal(t, "1500KB", Bandwidth(1.5e6).String())
+
+	for _, s := range []string{"", "fast", "-1MB", "1TB"} {
+		_, err := ParseBandwidth(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLinkDelay(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	l := Link{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond, Dist: "uniform"}
+	for i := 0; i < 100; i++ {
+		d := l.delay(rng)
+		assert.True(t, d >= 40*time.Millisecond && d <= 60*time.Millisecond, d)
+	}
+
+	l = Link{Latency: 50 * time.Millisecond, Loss: 1}
+	assert.Equal(t, 50*time.Millisecond+retransmitTimeout+100*time.Millisecond, l.delay(rng))
+
+	assert.Equal(t, 500*time.Millisecond, Link{Bandwidth: 1000}.transmit(500))
+	assert.Equal(t, time.Duration(0), Link{}.transmit(500))
+}
+
+func TestParseConfig(t *testing.T) {
+	def := Link{Latency: 5 * time.Millisecond, Bandwidth: 1e6}
+	c, err := ParseConfig([]byte(`
+default:
+  jitter: 1ms
+regions:
+  - name: us
+    weight: 2
+  - name: eu
+links:
+  - between: [us, eu]
+    latency: 80ms
+    loss: 0.01
+`), def)
+	require.NoError(t, err)
+
+	assert.Equal(t, Link{Latency: 5 * time.Millisecond, Jitter: time.Millisecond, Bandwidth: 1e6}, c.Default)
+	assert.Equal(t, c.Default, c.Link("us", "us"))
+	assert.Equal(t, Link{Latency: 80 * time.Millisecond, Jitter: time.Millisecond, Bandwidth: 1e6, Loss: 0.01}, c.Link("eu", "us"))
+
+	counts := map[string]int{}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 3000; i++ {
+		counts[c.PickRegion(rng)]++
+	}
+	assert.InDelta(t, 2000, counts["us"], 150)
+	assert.InDelta(t, 1000, counts["eu"], 150)
+
+	for _, bad := range []string{
+		"default: {loss: 2}",
+		"default: {latency: soon}",
+		"regions: [{name: us}, {name: us}]",
+		"links: [{between: [us, eu]}]",
+		"regions: [{name: us}]\nlinks: [{between: [us]}]",
+		"regions: [{name: us}]\nlinks: [{between: [us, us], dist: pareto}]",
+	} {
+		_, err := ParseConfig([]byte(bad), Link{})
+		assert.Error(t, err, bad)
+	}
+}
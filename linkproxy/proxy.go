@@ -0,0 +1,183 @@
+package linkproxy
+
+import (
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	segmentSize = 16 << 10 // most bytes forwarded at once
+	queueSize   = 64       // segments in flight, each way
+)
+
+// Proxy listens on a local port, and forwards the connections it accepts
+// to Target, through Link.
+type Proxy struct {
+	Link   Link
+	Target string // host:port
+
+	ln net.Listener
+
+	lk     sync.Mutex // guards rng and conns
+	rng    *rand.Rand
+	conns  map[net.Conn]bool
+	closed bool
+}
+
+// Listen starts a proxy to target on a free local port. seed seeds its
+// random latencies and losses.
+func Listen(target string, l Link, seed int64) (*Proxy, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		Link:   l,
+		Target: target,
+		ln:     ln,
+		rng:    rand.New(rand.NewSource(seed)),
+		conns:  make(map[net.Conn]bool),
+	}
+	go p.accept()
+	return p, nil
+}
+
+// Addr returns the address the proxy listens on.
+func (p *Proxy) Addr() *net.TCPAddr {
+	return p.ln.Addr().(*net.TCPAddr)
+}
+
+// Close stops the proxy, and closes all its connections.
+func (p *Proxy) Close() error {
+	p.lk.Lock()
+	p.closed = true
+	for c := range p.conns {
+		c.Close()
+	}
+	p.lk.Unlock()
+
+	return p.ln.Close()
+}
+
+func (p *Proxy) accept() {
+	for {
+		c, err := p.ln.Accept()
+		if err != nil {
+			return // closed.
+		}
+		go p.serve(c)
+	}
+}
+
+func (p *Proxy) serve(c net.Conn) {
+	t, err := net.Dial("tcp", p.Target)
+	if err != nil {
+		log.Printf("[LINK]\t failed to dial %s: %s\n", p.Target, err)
+		c.Close()
+		return
+	}
+
+	if !p.track(c, t) {
+		c.Close()
+		t.Close()
+		return
+	}
+	defer p.untrack(c, t)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.forward(t, c)
+	}()
+	go func() {
+		defer wg.Done()
+		p.forward(c, t)
+	}()
+	wg.Wait()
+
+	c.Close()
+	t.Close()
+}
+
+func (p *Proxy) track(conns ...net.Conn) bool {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if p.closed {
+		return false
+	}
+	for _, c := range conns {
+		p.conns[c] = true
+	}
+	return true
+}
+
+func (p *Proxy) untrack(conns ...net.Conn) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	for _, c := range conns {
+		delete(p.conns, c)
+	}
+}
+
+func (p *Proxy) delay() time.Duration {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.Link.delay(p.rng)
+}
+
+type segment struct {
+	buf []byte
+	at  time.Time // when it arrives
+}
+
+// forward copies src to dst, through the link. Segments queue to be sent
+// at the link's bandwidth, and then arrive after the link's delay, in
+// order, like TCP delivers them.
+func (p *Proxy) forward(dst, src net.Conn) {
+	segs := make(chan segment, queueSize)
+	go func() {
+		defer close(segs)
+
+		var free time.Time // when the link can send the next segment
+		for {
+			buf := make([]byte, segmentSize)
+			n, err := src.Read(buf)
+			if n > 0 {
+				now := time.Now()
+				if free.Before(now) {
+					free = now
+				}
+				free = free.Add(p.Link.transmit(n))
+				segs <- segment{buf[:n], free.Add(p.delay())}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for s := range segs {
+		time.Sleep(time.Until(s.at))
+		if _, err := dst.Write(s.buf); err != nil {
+			// unblock the reader, and let it finish.
+			src.Close()
+			for range segs {
+			}
+			return
+		}
+	}
+
+	// src is done sending.
+	if tc, ok := dst.(*net.TCPConn); ok {
+		tc.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
@@ -0,0 +1,94 @@
+package linkproxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer echoes everything back, on every connection.
+func echoServer(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	return ln
+}
+
+// roundTrip sends buf through the proxy, and reads it back.
+func roundTrip(t *testing.T, p *Proxy, buf []byte) time.Duration {
+	c, err := net.Dial("tcp", p.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	start := time.Now()
+	go c.Write(buf)
+	out := make([]byte, len(buf))
+	_, err = io.ReadFull(c, out)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(buf, out))
+	return time.Since(start)
+}
+
+func TestProxyLatency(t *testing.T) {
+	ln := echoServer(t)
+	defer ln.Close()
+
+	p, err := Listen(ln.Addr().String(), Link{Latency: 50 * time.Millisecond}, 1)
+	require.NoError(t, err)
+	defer p.Close()
+
+	// there and back again.
+	d := roundTrip(t, p, []byte("hello"))
+	assert.True(t, d >= 100*time.Millisecond, d)
+	assert.True(t, d < 500*time.Millisecond, d)
+}
+
+func TestProxyBandwidth(t *testing.T) {
+	ln := echoServer(t)
+	defer ln.Close()
+
+	p, err := Listen(ln.Addr().String(), Link{Bandwidth: 200e3}, 1)
+	require.NoError(t, err)
+	defer p.Close()
+
+	// 50KB at 200KB/s takes 250ms each way, overlapping.
+	d := roundTrip(t, p, make([]byte, 50e3))
+	assert.True(t, d >= 250*time.Millisecond, d)
+	assert.True(t, d < 2*time.Second, d)
+}
+
+func TestProxyClose(t *testing.T) {
+	ln := echoServer(t)
+	defer ln.Close()
+
+	p, err := Listen(ln.Addr().String(), Link{}, 1)
+	require.NoError(t, err)
+
+	c, err := net.Dial("tcp", p.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	roundTrip(t, p, []byte("hi"))
+
+	// closing the proxy cuts its connections.
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, p.Close())
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = c.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
@@ -2,20 +2,29 @@ package logs
 
 import (
 	"bufio"
+	"bytes"
 	"io"
+	"strconv"
+	"sync"
 )
 
 // LineAggregator mixes in multile readers into one,
 // line by line, ensuring interleaved writes dont break up
 // lines. Uses goroutines to read from and write out.
+//
+// Lines that are JSON objects get a "seq" field, numbering them in the
+// order they are written out, starting at 1.
 type LineAggregator struct {
 	pr *io.PipeReader
 	pw *io.PipeWriter
+
+	lk  sync.Mutex // makes seq order the output order
+	seq uint64
 }
 
 func NewLineAggregator() *LineAggregator {
 	pr, pw := io.Pipe()
-	return &LineAggregator{pr, pw}
+	return &LineAggregator{pr: pr, pw: pw}
 }
 
 func (a *LineAggregator) Reader() io.Reader {
@@ -37,11 +46,29 @@ func (a *LineAggregator) mixScanner(s *bufio.Reader) {
 			return // bail out.
 		}
 
-		// pipe gates sequentially.
-		// without pipe, may need a lock to ensure no interleaving.
-		_, err = a.pw.Write(l)
+		// pipe gates sequentially, but the lock keeps
+		// lines in seq order.
+		a.lk.Lock()
+		a.seq++
+		_, err = a.pw.Write(withSeq(l, a.seq))
+		a.lk.Unlock()
 		if err != nil {
 			return // bail out.
 		}
 	}
 }
+
+// withSeq adds "seq" as the first field of line, if it is a JSON object.
+func withSeq(line []byte, seq uint64) []byte {
+	if len(line) == 0 || line[0] != '{' {
+		return line
+	}
+
+	out := make([]byte, 0, len(line)+32)
+	out = append(out, `{"seq":`...)
+	out = strconv.AppendUint(out, seq, 10)
+	if !bytes.HasPrefix(bytes.TrimSpace(line[1:]), []byte("}")) {
+		out = append(out, ',')
+	}
+	return append(out, line[1:]...)
+}
@@ -3,6 +3,8 @@ package logs
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"math/rand"
 	"testing"
@@ -74,6 +76,47 @@ func TestAggregatorThree(t *testing.T) {
 	}
 }
 
+func TestAggregatorSeq(t *testing.T) {
+	l := NewLineAggregator()
+
+	writers, lines := 5, 20
+	for i := 0; i < writers; i++ {
+		r, w := io.Pipe()
+		l.MixReader(r)
+		go func(i int) {
+			for j := 0; j < lines; j++ {
+				fmt.Fprintf(w, "{\"writer\": %d, \"line\": %d}\n", i, j)
+			}
+			w.Write([]byte("{}\n"))
+			w.Write([]byte("not json\n"))
+			w.Close()
+		}(i)
+	}
+
+	s := bufio.NewReader(l.Reader())
+	seq := uint64(0)
+	last := map[float64]float64{}
+	for n := 0; n < writers*(lines+2); n++ {
+		line, err := s.ReadBytes('\n')
+		assert.NoError(t, err)
+		seq++
+
+		if string(line) == "not json\n" {
+			continue
+		}
+
+		var m map[string]interface{}
+		assert.NoError(t, json.Unmarshal(line, &m), string(line))
+		assert.Equal(t, float64(seq), m["seq"])
+
+		// each writer's lines stay in order.
+		if w, ok := m["writer"].(float64); ok {
+			assert.Equal(t, last[w], m["line"])
+			last[w]++
+		}
+	}
+}
+
 func TestAggregatorStress(t *testing.T) {
 	t.Skip()
 
@@ -0,0 +1,331 @@
+// Package events defines the sim events filnetsim serves at /logs, as
+// typed structs. Every event is one JSON object per line, and starts
+// with an Envelope:
+//
+//	{"seq": 42, "type": "NewBlockMined", "from": "<addr>", "to": "all", "time": "<RFC3339>", "duration": <ns>, "version": 1, ...}
+//
+// Fields are only ever added within a SchemaVersion. Renaming or removing
+// one bumps it.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the version of the events in this package.
+const SchemaVersion = 1
+
+// Event types.
+const (
+	TypeNewBlockMined  = "NewBlockMined"
+	TypeBroadcastBlock = "BroadcastBlock"
+	TypeSawBlock       = "SawBlock"
+	TypePickedChain    = "PickedChain"
+	TypeAddAsk         = "AddAsk"
+	TypeAddBid         = "AddBid"
+	TypeMakeDeal       = "MakeDeal"
+	TypeSendFile       = "SendFile"
+	TypeSendPayment    = "SendPayment"
+	TypeConnected      = "Connected"
+	TypeHeartBeat      = "HeartBeat"
+	TypeCreateMiner    = "CreateMiner"
+	TypeFinishDeal     = "FinishDeal"
+	TypeSendPieces     = "SendPieces"
+	TypeAddDeal        = "AddDeal"
+
+	// from the sim itself, not from node eventlogs.
+	TypeMinerJoins    = "MinerJoins"
+	TypeMinerLeaves   = "MinerLeaves"
+	TypeClientJoins   = "ClientJoins"
+	TypeClientLeaves  = "ClientLeaves"
+	TypeRetrieveFile  = "RetrieveFile"
+	TypeScenarioStep  = "ScenarioStep"
+	TypePartitioned   = "Partitioned"
+	TypeHealed        = "Healed"
+	TypeNodeCrashed   = "NodeCrashed"
+	TypeNodeFrozen    = "NodeFrozen"
+	TypeNodeThawed    = "NodeThawed"
+	TypeNodeRestarted = "NodeRestarted"
+)
+
+// Envelope is the part all events share.
+//
+// Time and Duration are the start and duration of the eventlog the event
+// came from, or when the sim made it. Seq numbers all events served at
+// /logs, in order; it is set by the logs.LineAggregator, and gaps in it
+// mean lines were dropped.
+type Envelope struct {
+	Seq      uint64        `json:"seq,omitempty"`
+	Type     string        `json:"type"`
+	From     string        `json:"from"`
+	To       string        `json:"to,omitempty"` // "all" for broadcasts
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"` // nanoseconds
+	Version  int           `json:"version"`
+}
+
+// NewEnvelope returns an Envelope of the current SchemaVersion.
+func NewEnvelope(typ, from, to string, t time.Time) Envelope {
+	return Envelope{Type: typ, From: from, To: to, Time: t, Version: SchemaVersion}
+}
+
+// Header returns the envelope, so every event type is an Event.
+func (e *Envelope) Header() *Envelope {
+	return e
+}
+
+// Event is any of the event types in this package.
+type Event interface {
+	Header() *Envelope
+}
+
+// Block is a block, as events describe it.
+type Block struct {
+	Cid          string   `json:"cid"`
+	Parents      []string `json:"parents"`
+	Miner        string   `json:"miner"`
+	Height       uint64   `json:"height"`
+	MessageCount int      `json:"messageCount"`
+	StateRoot    string   `json:"stateRoot"`
+}
+
+// Ask is a storage market ask. Prices and sizes are numbers, as the
+// daemons log them, though numbers in strings are read too.
+type Ask struct {
+	ID    uint64      `json:"id"`
+	Owner string      `json:"owner"`
+	Price json.Number `json:"price"`
+	Size  json.Number `json:"size"`
+}
+
+// Bid is a storage market bid.
+type Bid struct {
+	ID         uint64      `json:"id"`
+	Owner      string      `json:"owner"`
+	Price      json.Number `json:"price"`
+	Size       json.Number `json:"size"`
+	Collateral json.Number `json:"collateral,omitempty"`
+	Used       bool        `json:"used"`
+}
+
+// Deal is a storage market deal, between an ask and a bid.
+type Deal struct {
+	Ask     uint64 `json:"ask"`
+	Bid     uint64 `json:"bid"`
+	DataRef Link   `json:"dataRef"`
+}
+
+// Link is a cid, written as {"/": "<cid>"}.
+type Link struct {
+	Cid string `json:"/"`
+}
+
+// NewBlockMined: From mined Block, To "all".
+type NewBlockMined struct {
+	Envelope
+	Block   string   `json:"block"`
+	Parents []string `json:"parents"`
+	Height  uint64   `json:"height"`
+	Reward  string   `json:"reward"`
+}
+
+// BroadcastBlock: From sent Block, To "all".
+type BroadcastBlock struct {
+	Envelope
+	Block string `json:"block"`
+}
+
+// SawBlock: Receiver got a block mined by Miner. From and To are the
+// same as Miner and Receiver.
+type SawBlock struct {
+	Envelope
+	Block    Block  `json:"block"`
+	Miner    string `json:"miner"`
+	Receiver string `json:"receiver"`
+}
+
+// PickedChain: Node took Block as its new best block.
+type PickedChain struct {
+	Envelope
+	Node  string `json:"node"`
+	Block Block  `json:"block"`
+}
+
+type AddAsk struct {
+	Envelope
+	Ask Ask `json:"ask"`
+}
+
+type AddBid struct {
+	Envelope
+	Bid Bid `json:"bid"`
+}
+
+// MakeDeal: a client (From) proposed a deal to a miner (To), to store Data.
+type MakeDeal struct {
+	Envelope
+	Data  string      `json:"data"`
+	Price json.Number `json:"price"`
+	Size  json.Number `json:"size"`
+	Ask   Ask         `json:"ask"`
+	Bid   Bid         `json:"bid"`
+	Deal  Deal        `json:"deal"`
+}
+
+// SendFile: a client (From) sent Data to a miner (To), for a deal.
+type SendFile struct {
+	Envelope
+	Data string `json:"data"`
+}
+
+type SendPayment struct {
+	Envelope
+	Value string `json:"value"`
+}
+
+// Connected: the sim connected From to To.
+type Connected struct {
+	Envelope
+}
+
+// HeartBeat is a node's periodic report of its state. The fields are
+// passed through as the node reports them.
+type HeartBeat struct {
+	Envelope
+	PeerID      interface{} `json:"peer-id"`
+	Peers       interface{} `json:"peers"`
+	Asks        interface{} `json:"asks"`
+	Bids        interface{} `json:"bids"`
+	Deals       interface{} `json:"deals"`
+	BestBlock   interface{} `json:"best-block"`
+	Pending     interface{} `json:"pending"`
+	WalletAddrs interface{} `json:"wallet-addrs"`
+}
+
+// CreateMiner: From created the miner MinerAddr.
+type CreateMiner struct {
+	Envelope
+	Pledge     string `json:"pledge"`
+	Collateral string `json:"collateral"`
+	MinerAddr  string `json:"miner-addr"`
+}
+
+// FinishDeal: a miner (From) finished storing the data of Deal.
+type FinishDeal struct {
+	Envelope
+	Deal Deal   `json:"deal"`
+	TxID string `json:"txid"`
+}
+
+// SendPieces: a miner fetched Data from a client.
+type SendPieces struct {
+	Envelope
+	Data string `json:"data"`
+}
+
+// AddDeal is the message adding a deal to the storage market.
+type AddDeal struct {
+	Envelope
+	AskID string `json:"askID"`
+	BidID string `json:"bidID"`
+	Sig   string `json:"sig"`
+	Data  string `json:"data"`
+}
+
+// NetworkChurn is a node joining or leaving the network: one of the
+// MinerJoins, MinerLeaves, ClientJoins or ClientLeaves types.
+type NetworkChurn struct {
+	Envelope
+	CmdAddr string `json:"cmdAddr,omitempty"`
+}
+
+// RetrieveFile: a client (To) fetched Data from a miner (From).
+type RetrieveFile struct {
+	Envelope
+	Data    string  `json:"data"`
+	Size    int     `json:"size"`    // bytes
+	Latency float64 `json:"latency"` // milliseconds
+}
+
+// ScenarioStep: a scenario ran step Step.
+type ScenarioStep struct {
+	Envelope
+	Step   int    `json:"step"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Partitioned: the network was split into Groups of node addresses, which
+// cannot reach each other until it is Healed. Nodes in no group are
+// together, in one more group.
+type Partitioned struct {
+	Envelope
+	Groups [][]string `json:"groups"`
+}
+
+// Healed: the network reconnected the edges cut when it was Partitioned.
+type Healed struct {
+	Envelope
+}
+
+// NodeFault is a fault injected into a node (From): one of the
+// NodeCrashed, NodeFrozen, NodeThawed or NodeRestarted types. A restarted
+// node listens on a new CmdAddr.
+type NodeFault struct {
+	Envelope
+	CmdAddr string `json:"cmdAddr,omitempty"`
+}
+
+var types = map[string]func() Event{
+	TypeNewBlockMined:  func() Event { return &NewBlockMined{} },
+	TypeBroadcastBlock: func() Event { return &BroadcastBlock{} },
+	TypeSawBlock:       func() Event { return &SawBlock{} },
+	TypePickedChain:    func() Event { return &PickedChain{} },
+	TypeAddAsk:         func() Event { return &AddAsk{} },
+	TypeAddBid:         func() Event { return &AddBid{} },
+	TypeMakeDeal:       func() Event { return &MakeDeal{} },
+	TypeSendFile:       func() Event { return &SendFile{} },
+	TypeSendPayment:    func() Event { return &SendPayment{} },
+	TypeConnected:      func() Event { return &Connected{} },
+	TypeHeartBeat:      func() Event { return &HeartBeat{} },
+	TypeCreateMiner:    func() Event { return &CreateMiner{} },
+	TypeFinishDeal:     func() Event { return &FinishDeal{} },
+	TypeSendPieces:     func() Event { return &SendPieces{} },
+	TypeAddDeal:        func() Event { return &AddDeal{} },
+	TypeMinerJoins:     func() Event { return &NetworkChurn{} },
+	TypeMinerLeaves:    func() Event { return &NetworkChurn{} },
+	TypeClientJoins:    func() Event { return &NetworkChurn{} },
+	TypeClientLeaves:   func() Event { return &NetworkChurn{} },
+	TypeRetrieveFile:   func() Event { return &RetrieveFile{} },
+	TypeScenarioStep:   func() Event { return &ScenarioStep{} },
+	TypePartitioned:    func() Event { return &Partitioned{} },
+	TypeHealed:         func() Event { return &Healed{} },
+	TypeNodeCrashed:    func() Event { return &NodeFault{} },
+	TypeNodeFrozen:     func() Event { return &NodeFault{} },
+	TypeNodeThawed:     func() Event { return &NodeFault{} },
+	TypeNodeRestarted:  func() Event { return &NodeFault{} },
+}
+
+// Decode parses one event into its type in this package.
+func Decode(buf []byte) (Event, error) {
+	var env Envelope
+	if err := json.Unmarshal(buf, &env); err != nil {
+		return nil, err
+	}
+	if env.Version > SchemaVersion {
+		return nil, fmt.Errorf("event schema version %d is newer than %d", env.Version, SchemaVersion)
+	}
+
+	newEvent, ok := types[env.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type: %q", env.Type)
+	}
+
+	e := newEvent()
+	if err := json.Unmarshal(buf, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
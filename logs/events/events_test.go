@@ -0,0 +1,72 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	now := time.Date(2018, 4, 20, 19, 33, 38, 0, time.UTC)
+
+	evts := []Event{
+		&NewBlockMined{Envelope: NewEnvelope(TypeNewBlockMined, "m1", "all", now), Block: "zBlock", Reward: "20000"},
+		&SawBlock{
+			Envelope: NewEnvelope(TypeSawBlock, "m1", "n2", now),
+			Block:    Block{Cid: "zBlock", Parents: []string{"zParent"}, Miner: "m1", Height: 3},
+			Miner:    "m1",
+			Receiver: "n2",
+		},
+		&MakeDeal{
+			Envelope: NewEnvelope(TypeMakeDeal, "c1", "m1", now),
+			Data:     "zData",
+			Price:    "5",
+			Size:     "10",
+			Ask:      Ask{ID: 1, Owner: "m1", Price: "5", Size: "1000"},
+			Bid:      Bid{ID: 2, Owner: "c1", Price: "10", Size: "10"},
+			Deal:     Deal{Ask: 1, Bid: 2, DataRef: Link{"zData"}},
+		},
+		&NetworkChurn{Envelope: NewEnvelope(TypeClientLeaves, "c1", "", now)},
+		&RetrieveFile{Envelope: NewEnvelope(TypeRetrieveFile, "m1", "c1", now), Data: "zData", Size: 10, Latency: 1.5},
+	}
+
+	for _, e := range evts {
+		buf, err := json.Marshal(e)
+		require.NoError(t, err)
+
+		d, err := Decode(buf)
+		require.NoError(t, err)
+		assert.Equal(t, e, d)
+		assert.Equal(t, SchemaVersion, d.Header().Version)
+	}
+}
+
+func TestDecodeWireFormat(t *testing.T) {
+	line := `{"type":"MakeDeal","from":"c1","to":"m1","time":"2018-04-20T19:33:38Z","version":1,` +
+		`"data":"zData","price":"5","size":"10","ask":{"id":1,"owner":"m1","price":"5","size":"1000"},` +
+		`"bid":{"id":2,"owner":"c1","price":"10","size":"10","used":true},"deal":{"ask":1,"bid":2,"dataRef":{"/":"zData"}}}`
+
+	e, err := Decode([]byte(line))
+	require.NoError(t, err)
+
+	md, ok := e.(*MakeDeal)
+	require.True(t, ok)
+	assert.Equal(t, "c1", md.From)
+	assert.Equal(t, "m1", md.To)
+	assert.Equal(t, "zData", md.Deal.DataRef.Cid)
+	assert.True(t, md.Bid.Used)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode([]byte(`{"type":"NoSuchEvent","version":1}`))
+	assert.Error(t, err)
+
+	_, err = Decode([]byte(`{"type":"Connected","version":2}`))
+	assert.Error(t, err)
+
+	_, err = Decode([]byte(`not json`))
+	assert.Error(t, err)
+}
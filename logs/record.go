@@ -0,0 +1,148 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Record is one line of a recording: a sim event, and when it was
+// written, relative to the start of the recording. Lines that are not
+// JSON are kept as they were, in Line.
+//
+//	{"at": <ns>, "event": {"type": "NewBlockMined", ...}}
+//	{"at": <ns>, "line": "not an event"}
+type Record struct {
+	At    time.Duration   `json:"at"`
+	Event json.RawMessage `json:"event,omitempty"`
+	Line  string          `json:"line,omitempty"`
+}
+
+// line returns the log line recorded, without its newline.
+func (rec Record) line() []byte {
+	if rec.Event == nil {
+		return []byte(rec.Line)
+	}
+	return rec.Event
+}
+
+// Recorder is an io.Writer that records the sim log lines written to
+// it, with their timing, as ndjson Records.
+type Recorder struct {
+	lk    sync.Mutex
+	w     io.Writer
+	start time.Time
+	line  []byte // partial line, until its newline is written
+}
+
+// NewRecorder returns a Recorder writing to w. Times are relative to now.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w, start: time.Now()}
+}
+
+func (r *Recorder) Write(buf []byte) (int, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	at := time.Since(r.start)
+	r.line = append(r.line, buf...)
+	for {
+		i := bytes.IndexByte(r.line, '\n')
+		if i < 0 {
+			return len(buf), nil
+		}
+
+		line := bytes.TrimSpace(r.line[:i])
+		r.line = r.line[i+1:]
+		if len(line) == 0 {
+			continue
+		}
+
+		if err := r.writeRecord(at, line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (r *Recorder) writeRecord(at time.Duration, line []byte) error {
+	rc := Record{At: at, Event: json.RawMessage(line)}
+	if !json.Valid(line) {
+		rc = Record{At: at, Line: string(line)}
+	}
+
+	rec, err := json.Marshal(rc)
+	if err != nil {
+		return err
+	}
+	_, err = r.w.Write(append(rec, '\n'))
+	return err
+}
+
+// Replay writes the events recorded in r to w, one per line, with their
+// original delays divided by speed. The clock starts once the first event
+// is written, so a replay into a pipe waits for its first reader.
+func Replay(ctx context.Context, r io.Reader, w io.Writer, speed float64) error {
+	if speed <= 0 {
+		return fmt.Errorf("replay speed must be positive: %f", speed)
+	}
+
+	var start time.Time
+	var first time.Duration
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<24) // events can be long lines.
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return fmt.Errorf("bad record: %s", err)
+		}
+
+		if start.IsZero() {
+			first = rec.At
+		} else {
+			wait := time.Duration(float64(rec.At-first)/speed) - time.Since(start)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		if _, err := w.Write(append(rec.line(), '\n')); err != nil {
+			return err
+		}
+		if start.IsZero() {
+			start = time.Now()
+		}
+	}
+	return s.Err()
+}
+
+// CopyEvents writes the events recorded in r to w, one per line, at once,
+// without their timing.
+func CopyEvents(r io.Reader, w io.Writer) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<24)
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return fmt.Errorf("bad record: %s", err)
+		}
+		if _, err := w.Write(append(rec.line(), '\n')); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,69 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	rec := bytes.NewBuffer(nil)
+	r := NewRecorder(rec)
+
+	// lines split across writes, and several lines in one write.
+	r.Write([]byte(`{"seq":1,"type":"MinerJoins"}` + "\n" + `{"seq":2,`))
+	time.Sleep(100 * time.Millisecond)
+	r.Write([]byte(`"type":"NewBlockMined"}` + "\n\n"))
+	time.Sleep(100 * time.Millisecond)
+	r.Write([]byte("not json\n"))
+
+	var recs []Record
+	s := bufio.NewScanner(bytes.NewReader(rec.Bytes()))
+	for s.Scan() {
+		var rc Record
+		require.NoError(t, json.Unmarshal(s.Bytes(), &rc))
+		recs = append(recs, rc)
+	}
+	require.Len(t, recs, 3)
+	assert.JSONEq(t, `{"seq":2,"type":"NewBlockMined"}`, string(recs[1].Event))
+	assert.Nil(t, recs[2].Event)
+	assert.Equal(t, "not json", recs[2].Line)
+	assert.True(t, recs[1].At-recs[0].At >= 100*time.Millisecond)
+	assert.True(t, recs[2].At-recs[1].At >= 100*time.Millisecond)
+
+	// at 2x, the 200ms recording takes about 100ms.
+	out := bytes.NewBuffer(nil)
+	start := time.Now()
+	require.NoError(t, Replay(context.Background(), bytes.NewReader(rec.Bytes()), out, 2))
+	took := time.Since(start)
+	assert.True(t, took >= 100*time.Millisecond, "took %s", took)
+	assert.True(t, took < 190*time.Millisecond, "took %s", took)
+
+	assert.Equal(t, `{"seq":1,"type":"MinerJoins"}`+"\n"+`{"seq":2,"type":"NewBlockMined"}`+"\n"+"not json\n", out.String())
+}
+
+func TestReplayCancel(t *testing.T) {
+	recs := `{"at":0,"event":{"type":"a"}}` + "\n" + `{"at":10000000000,"event":{"type":"b"}}` + "\n"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	out := bytes.NewBuffer(nil)
+	err := Replay(ctx, bytes.NewReader([]byte(recs)), out, 1)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, `{"type":"a"}`+"\n", out.String())
+
+	assert.Error(t, Replay(context.Background(), bytes.NewReader([]byte(recs)), out, 0))
+
+	// CopyEvents does not wait.
+	out.Reset()
+	require.NoError(t, CopyEvents(bytes.NewReader([]byte(recs)), out))
+	assert.Equal(t, `{"type":"a"}`+"\n"+`{"type":"b"}`+"\n", out.String())
+	assert.Error(t, CopyEvents(bytes.NewReader([]byte("nope\n")), out))
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"time"
+
+	events "github.com/filecoin-project/filecoin-network-sim/logs/events"
 
 	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -26,6 +29,13 @@ func NewSimLogger(nodeid string, eventlogs io.Reader) *SimLogger {
 	return sl
 }
 
+// NewEventLogger returns a SimLogger without eventlogs to transform, for
+// sim events that do not come from a node.
+func NewEventLogger(id string) *SimLogger {
+	pr, pw := io.Pipe()
+	return &SimLogger{id, pr, pw, make(chan map[string]string, 0)}
+}
+
 func (l *SimLogger) Logf(format string, a ...interface{}) {
 	log.Printf("[SIM]\t %s", fmt.Sprintf(format, a...))
 }
@@ -39,23 +49,70 @@ func (l *SimLogger) Close() error {
 	return nil
 }
 
-// {"type": "NetworkChurn", "from": "mineraddr1", "role": "[Miner|Client]", "change": "[join|leave]"}
+// WriteEvent writes one sim event, e.g. from NetworkChurnEvent.
+func (l *SimLogger) WriteEvent(e events.Event) error {
+	return json.NewEncoder(l.pw).Encode(e)
+}
+
 // {"type": "MinerJoins", "from": "mineraddr1"}
 // {"type": "MinerLeaves", "from": "mineraddr1"}
 // {"type": "ClientJoins", "from": "mineraddr1"}
 // {"type": "ClientLeaves", "from": "mineraddr1"}
-func (l *SimLogger) WriteEvent(e map[string]interface{}) error {
-	return json.NewEncoder(l.pw).Encode(e)
+func NetworkChurnEvent(id, role string, joins bool) *events.NetworkChurn {
+	typ := role + "Leaves"
+	if joins {
+		typ = role + "Joins"
+	}
+	return &events.NetworkChurn{Envelope: events.NewEnvelope(typ, id, "", time.Now())}
 }
 
-func NetworkChurnEvent(id, role string, joins bool) map[string]interface{} {
-	m := newSimEvent(id)
-	if joins {
-		m["type"] = role + "Joins"
-	} else {
-		m["type"] = role + "Leaves"
+// {"type": "Connected", "from": "addr1", "to": "addr2"}
+func ConnectedEvent(from, to string) *events.Connected {
+	return &events.Connected{Envelope: events.NewEnvelope(events.TypeConnected, from, to, time.Now())}
+}
+
+// {"type": "RetrieveFile", "from": "mineraddr1", "to": "clientaddr1", "data": "<cid>", "size": <sizeInBytes>, "latency": <ms>}
+func RetrieveFileEvent(from, to, data string, size int, latency time.Duration) *events.RetrieveFile {
+	return &events.RetrieveFile{
+		Envelope: events.NewEnvelope(events.TypeRetrieveFile, from, to, time.Now()),
+		Data:     data,
+		Size:     size,
+		Latency:  latency.Seconds() * 1000,
+	}
+}
+
+// {"type": "ScenarioStep", "from": "scenario", "step": 3, "action": "deal", "error": "..."}
+func ScenarioStepEvent(id string, step int, action string, err error) *events.ScenarioStep {
+	e := &events.ScenarioStep{
+		Envelope: events.NewEnvelope(events.TypeScenarioStep, id, "", time.Now()),
+		Step:     step,
+		Action:   action,
+	}
+	if err != nil {
+		e.Error = err.Error()
 	}
-	return m
+	return e
+}
+
+// {"type": "Partitioned", "from": "network", "groups": [["addr1", "addr2"], ["addr3"]]}
+func PartitionedEvent(id string, groups [][]string) *events.Partitioned {
+	return &events.Partitioned{
+		Envelope: events.NewEnvelope(events.TypePartitioned, id, "", time.Now()),
+		Groups:   groups,
+	}
+}
+
+// {"type": "Healed", "from": "network"}
+func HealedEvent(id string) *events.Healed {
+	return &events.Healed{Envelope: events.NewEnvelope(events.TypeHealed, id, "", time.Now())}
+}
+
+// {"type": "NodeCrashed", "from": "addr1"}
+// {"type": "NodeFrozen", "from": "addr1"}
+// {"type": "NodeThawed", "from": "addr1"}
+// {"type": "NodeRestarted", "from": "addr1", "cmdAddr": "/ip4/127.0.0.1/tcp/3453"}
+func NodeFaultEvent(id, typ string) *events.NodeFault {
+	return &events.NodeFault{Envelope: events.NewEnvelope(typ, id, "", time.Now())}
 }
 
 func (l *SimLogger) transformEventLogs(r io.Reader) {
@@ -70,7 +127,7 @@ func (l *SimLogger) transformEventLogs(r io.Reader) {
 		}
 
 		for _, om := range l.convertEL2SL(im) {
-			if err := e.Encode(&om); err != nil {
+			if err := e.Encode(om); err != nil {
 				l.pw.CloseWithError(err)
 				return // bail out. failed.
 			}
@@ -80,15 +137,9 @@ func (l *SimLogger) transformEventLogs(r io.Reader) {
 	}
 }
 
-// {"type": "NewBlockMined", "from": "mineraddr1", "to": "all", "block": "<blockCID>"}
-// {"type": "BroadcastBlock", "from": "mineraddr1", "to": "all", "block": "<blockCID>"}
-// {"type": "AddAsk", "from": "mineraddr1", "to": "all", "tx": "<askTxCID>", "price": "<priceInFIL>", "size": "<sizeInBytes>"}
-// {"type": "AddBid", "from": "mineraddr1", "to": "all", "tx": "<bidTxCID>", "price": "<priceInFIL>", "size": "<sizeInBytes>"}
-// {"type": "MakeDeal", "from": "mineraddr1", "to": "mineraddr2", "tx": "<dealTxCID>", "price": "<priceInFIL>", "size": "<sizeInBytes>"}
-// {"type": "SendFile", "from": "mineraddr1", "to": "mineraddr2", "size": "<sizeInBytes>"}
-// {"type": "SendPayment", "from": "mineraddr1", "to": "mineraddr2", "tx": "<txCID>", "value": "<valueInFIL>"}
-// {"type": "Connected", "from": "mineraddr1", "to": "mineraddr2"}
-func (l *SimLogger) convertEL2SL(el map[string]interface{}) []map[string]interface{} {
+// convertEL2SL converts one eventlog into the sim events it stands for,
+// if any. See the events package for what each looks like.
+func (l *SimLogger) convertEL2SL(el map[string]interface{}) []events.Event {
 
 	op, ok := el["Operation"].(string)
 	if !ok {
@@ -106,18 +157,30 @@ func (l *SimLogger) convertEL2SL(el map[string]interface{}) []map[string]interfa
 		return nil
 	}
 
+	// sim events happen when their eventlog started.
+	t, dur := eventlogTime(el)
+	env := func(typ, from, to string) events.Envelope {
+		e := events.NewEnvelope(typ, from, to, t)
+		e.Duration = dur
+		return e
+	}
+
 	switch op {
 
 	case "sm.AddBid":
-		e := newSimEvent(l.id)
-		e["type"] = "AddBid"
-		e["bid"] = tags["bid"]
+		e := &events.AddBid{Envelope: env(events.TypeAddBid, l.id, "")}
+		if err := getFromTags(tags, "bid", &e.Bid); err != nil {
+			l.Logf("failed to get bid: %v", err)
+			return nil
+		}
 		return joinSimEvent(e)
 
 	case "sm.AddAsk":
-		e := newSimEvent(l.id)
-		e["type"] = "AddAsk"
-		e["ask"] = tags["ask"]
+		e := &events.AddAsk{Envelope: env(events.TypeAddAsk, l.id, "")}
+		if err := getFromTags(tags, "ask", &e.Ask); err != nil {
+			l.Logf("failed to get ask: %v", err)
+			return nil
+		}
 		return joinSimEvent(e)
 
 	case "AddNewBlock": // NewBlockMined, BroadcastBlock
@@ -127,19 +190,17 @@ func (l *SimLogger) convertEL2SL(el map[string]interface{}) []map[string]interfa
 			return nil
 		}
 
-		e1 := newSimEvent(l.id)
-		e1["type"] = "NewBlockMined"
-		e1["to"] = "all"
-		e1["reward"] = "20000"
-		e1["block"] = block.Cid().String()
-		e1["from"] = block.Miner.String()
-
-		e2 := newSimEvent(l.id)
-		e2["type"] = "BroadcastBlock"
-		e2["to"] = "all"
-		e2["block"] = block.Cid().String()
-		e2["from"] = block.Miner.String()
-
+		e1 := &events.NewBlockMined{
+			Envelope: env(events.TypeNewBlockMined, block.Miner.String(), "all"),
+			Block:    block.Cid().String(),
+			Parents:  cidSetToStrings(block.Parents),
+			Height:   uint64(block.Height),
+			Reward:   "20000",
+		}
+		e2 := &events.BroadcastBlock{
+			Envelope: env(events.TypeBroadcastBlock, block.Miner.String(), "all"),
+			Block:    block.Cid().String(),
+		}
 		return joinSimEvent(e1, e2)
 
 	case "ProcessNewBlock": //SawBlock
@@ -149,19 +210,14 @@ func (l *SimLogger) convertEL2SL(el map[string]interface{}) []map[string]interfa
 			return nil
 		}
 
-		e := newSimEvent(l.id)
-		e["type"] = "SawBlock"
-		e["block"] = blockForSimEvent(block)
-
-		// TODO: remove these next two lines, they're legacy.
-		e["from"] = block.Miner.String()
-		e["to"] = l.id
-
-		// this is the right way to do it:
-		// and "miner" should be in the block itself.
-		e["miner"] = block.Miner.String()
-		e["receiver"] = l.id
-
+		// TODO: from and to are legacy. miner and receiver are the right
+		// way to do it, and "miner" should be in the block itself.
+		e := &events.SawBlock{
+			Envelope: env(events.TypeSawBlock, block.Miner.String(), l.id),
+			Block:    blockForSimEvent(block),
+			Miner:    block.Miner.String(),
+			Receiver: l.id,
+		}
 		return joinSimEvent(e)
 
 	case "acceptNewBestBlock": //PickedChain
@@ -171,109 +227,74 @@ func (l *SimLogger) convertEL2SL(el map[string]interface{}) []map[string]interfa
 			return nil
 		}
 
-		e := newSimEvent(l.id)
-		e["type"] = "PickedChain"
-		e["node"] = l.id
-		e["block"] = blockForSimEvent(block)
-
+		e := &events.PickedChain{
+			Envelope: env(events.TypePickedChain, l.id, ""),
+			Node:     l.id,
+			Block:    blockForSimEvent(block),
+		}
 		return joinSimEvent(e)
 
 	case "minerCreateCmd":
-		e := newSimEvent(getStrSafe(tags, "from-address"))
-		e["pledge"] = tags["pledge"]
-		e["collateral"] = tags["collateral"]
-		e["miner-addr"] = tags["addr"]
-		e["type"] = "CreateMiner"
-		e["to"] = "all"
+		e := &events.CreateMiner{
+			Envelope:   env(events.TypeCreateMiner, getStrSafe(tags, "from-address"), "all"),
+			Pledge:     getStrSafe(tags, "pledge"),
+			Collateral: getStrSafe(tags, "collateral"),
+			MinerAddr:  getStrSafe(tags, "addr"),
+		}
 		return joinSimEvent(e)
 
 	case "finishDeal": //MakeDeal
-		e := newSimEvent(l.id)
-		e["type"] = "FinishDeal"
-		e["from"] = tags["miner"]
-		e["deal"] = tags["deal"]
-		e["txid"] = tags["msgCid"]
+		e := &events.FinishDeal{
+			Envelope: env(events.TypeFinishDeal, getStrSafe(tags, "miner"), ""),
+			TxID:     getStrSafe(tags, "msgCid"),
+		}
+		if err := getFromTags(tags, "deal", &e.Deal); err != nil {
+			l.Logf("failed to get deal: %v", err)
+			return nil
+		}
 		return joinSimEvent(e)
 
 	case "fetchData": //SendPieces
-		e := newSimEvent(l.id)
-		e["type"] = "SendPieces"
-		e["data"] = tags["data"]
+		e := &events.SendPieces{
+			Envelope: env(events.TypeSendPieces, l.id, ""),
+			Data:     getStrSafe(tags, "data"),
+		}
 		return joinSimEvent(e)
 
-		/*
-			case "minerAddAskCmd": // AddAsk
-				message := getMsgFromTags(tags)
-				msgID, err := message.Cid()
-				if err != nil {
-					panic(err) // developer error
-				}
-
-				e := newSimEvent(l.id)
-				e["type"] = "AddAsk"
-				e["to"] = "all"
-				e["price"] = getStrSafe(tags, "price")
-				e["size"] = getStrSafe(tags, "size")
-
-				e["from"] = message.From.String()
-				e["txid"] = msgID.String()
-				return joinSimEvent(e)
-
-			case "clientAddBidCmd": // AddBid
-				message := getMsgFromTags(tags)
-				msgID, err := message.Cid()
-				if err != nil {
-					panic(err)
-				}
-
-				e := newSimEvent(l.id)
-				e["type"] = "AddBid"
-				e["to"] = "all"
-				e["price"] = getStrSafe(tags, "price")
-				e["size"] = getStrSafe(tags, "size")
-				e["from"] = message.From.String()
-				e["txid"] = msgID.String()
-				return joinSimEvent(e)
-		*/
-
 	case "ProposeDeal":
-		ask, ok1 := tags["ask"].(map[string]interface{})
-		bid, ok2 := tags["bid"].(map[string]interface{})
-		deal, ok3 := tags["deal"].(map[string]interface{})
-		if !(ok1 && ok2 && ok3) {
+		var ask events.Ask
+		var bid events.Bid
+		var deal events.Deal
+		err1 := getFromTags(tags, "ask", &ask)
+		err2 := getFromTags(tags, "bid", &bid)
+		err3 := getFromTags(tags, "deal", &deal)
+		if err1 != nil || err2 != nil || err3 != nil {
 			return nil // broken.
 		}
-		dataRef, ok4 := deal["dataRef"].(map[string]interface{})
-		if !ok4 {
-			return nil // broken
-		}
 
-		miner := getStrSafe(ask, "owner")
-		client := getStrSafe(bid, "owner")
-		data := getStrSafe(dataRef, "/")
-
-		e1 := newSimEvent(client) // MakeDeal
-		e1["type"] = "MakeDeal"
-		// TODO this address is wrong in the browser console
-		e1["to"] = tags["miner-owner"]
-		e1["data"] = data
-		e1["price"] = ask["price"]
-		e1["size"] = bid["size"]
-		e1["ask"] = ask
-		e1["bid"] = bid
-		e1["deal"] = deal
-
-		e2 := newSimEvent(client) // SendFile
-		e2["type"] = "SendFile"
-		e2["to"] = miner
-		e2["data"] = data
+		client := bid.Owner
+		data := deal.DataRef.Cid
+
+		e1 := &events.MakeDeal{
+			// TODO this address is wrong in the browser console
+			Envelope: env(events.TypeMakeDeal, client, getStrSafe(tags, "miner-owner")),
+			Data:     data,
+			Price:    ask.Price,
+			Size:     bid.Size,
+			Ask:      ask,
+			Bid:      bid,
+			Deal:     deal,
+		}
+		e2 := &events.SendFile{
+			Envelope: env(events.TypeSendFile, client, ask.Owner),
+			Data:     data,
+		}
 		return joinSimEvent(e1, e2)
 
-	case "swarmConnectCmdTo": // Connected
-		e := newSimEvent(l.id)
-		e["type"] = "Connected"
-		e["to"] = getStrSafe(tags, "peer")
-		return joinSimEvent(e)
+	case "swarmConnectCmdTo":
+		// the Network announces the edges it forms, with the nodes'
+		// addresses, as Connected.
+		return nil
 
 	case "AddNewMessage":
 		message, err := getMsgFromTags(tags, "message")
@@ -283,99 +304,57 @@ func (l *SimLogger) convertEL2SL(el map[string]interface{}) []map[string]interfa
 		}
 		switch message.Method {
 
-		/*
-			case "addAsk":
-				// WOW this actually works holy shit
-				t := []abi.Type{abi.BytesAmount, abi.BytesAmount}
-				v, err := abi.DecodeValues(message.Params, t)
-				if err != nil {
-					panic(err)
-				}
-				price := v[0].String()
-				size := v[1].String()
-
-				e := newSimEvent(getStrSafe(tags, "from"))
-				e["type"] = "AddAsk"
-				e["to"] = message.To.String()
-				e["from"] = message.From.String()
-				e["value"] = message.Value.String()
-				e["size"] = size
-				e["price"] = price
-				e["txid"] = cid.String()
-				return joinSimEvent(e)
-
-			case "addBid":
-				t := []abi.Type{abi.BytesAmount, abi.BytesAmount}
-				v, err := abi.DecodeValues(message.Params, t)
-				if err != nil {
-					panic(err)
-				}
-				price := v[0].String()
-				size := v[1].String()
-
-				e := newSimEvent(getStrSafe(tags, "from"))
-				e["type"] = "AddBid"
-				e["to"] = message.To.String()
-				e["from"] = message.From.String()
-				e["value"] = message.Value.String()
-				e["size"] = size
-				e["price"] = price
-				e["txid"] = cid.String()
-				return joinSimEvent(e)
-		*/
-
 		case "addDeal":
 			//              askID       bidID          sig       data
 			t := []abi.Type{abi.Integer, abi.Integer, abi.Bytes, abi.Bytes}
 			v, err := abi.DecodeValues(message.Params, t)
 			if err != nil {
 				l.Logf("failed to decode deal params: %v", err)
+				return nil
 			}
-			askID := v[0].String() // askID
-			bidID := v[1].String() // bidID
 
 			sig, err := v[2].Serialize() // sig
 			if err != nil {
 				l.Logf("failed to decode deal sig: %v", err)
 			}
 
-			data, err := v[2].Serialize() // data
+			data, err := v[3].Serialize() // data
 			if err != nil {
 				l.Logf("failed to decode deal data: %v", err)
 			}
 
-			e := newSimEvent(l.id)
-			e["type"] = "AddDeal"
-			e["to"] = "all" // message.To is StorageMarketAddress
-			e["from"] = message.From.String()
-			e["askID"] = askID
-			e["bidID"] = bidID
-			e["sig"] = string(sig)   // probs empty
-			e["data"] = string(data) //cid
+			e := &events.AddDeal{
+				// to is StorageMarketAddress
+				Envelope: env(events.TypeAddDeal, message.From.String(), "all"),
+				AskID:    v[0].String(),
+				BidID:    v[1].String(),
+				Sig:      string(sig),  // probs empty
+				Data:     string(data), //cid
+			}
 			return joinSimEvent(e)
 
 		case "": // no method.
-			e := newSimEvent(getStrSafe(tags, "from"))
-			e["type"] = "SendPayment"
-			e["to"] = message.To.String()
-			e["from"] = message.From.String()
-			e["value"] = message.Value.String()
+			e := &events.SendPayment{
+				Envelope: env(events.TypeSendPayment, message.From.String(), message.To.String()),
+				Value:    message.Value.String(),
+			}
 			return joinSimEvent(e)
 
 		default:
 			return nil // unused
 		}
 	case "HeartBeat":
-		e := newSimEvent(l.id)
-		e["type"] = "HeartBeat"
-		e["peer-id"] = tags["peer-id"]
-		e["peers"] = tags["peers"]
-		e["asks"] = tags["ask-list"]
-		e["bids"] = tags["bid-list"]
-		e["deals"] = tags["deal-list"]
-		e["best-block"] = tags["best-block"]
-		e["pending"] = tags["pending-messages"]
-		e["wallet-addrs"] = tags["wallet-address"]
+		e := &events.HeartBeat{
+			Envelope:    env(events.TypeHeartBeat, l.id, ""),
+			PeerID:      tags["peer-id"],
+			Peers:       tags["peers"],
+			Asks:        tags["ask-list"],
+			Bids:        tags["bid-list"],
+			Deals:       tags["deal-list"],
+			BestBlock:   tags["best-block"],
+			Pending:     tags["pending-messages"],
+			WalletAddrs: tags["wallet-address"],
+		}
 		return joinSimEvent(e)
 
 	default:
@@ -383,28 +362,38 @@ func (l *SimLogger) convertEL2SL(el map[string]interface{}) []map[string]interfa
 	}
 }
 
-func getBlockFromTags(tags map[string]interface{}, key string) (types.Block, error) {
-	var block types.Block
-	blk, err := json.Marshal(tags[key])
+// eventlogTime returns when the eventlog started (or now, if it does not
+// say), and how long it took.
+func eventlogTime(el map[string]interface{}) (time.Time, time.Duration) {
+	s, _ := el["Start"].(string)
+	t, err := time.Parse(time.RFC3339Nano, s)
 	if err != nil {
-		return types.Block{}, err
+		t = time.Now()
 	}
-	if err = json.Unmarshal(blk, &block); err != nil {
-		return types.Block{}, err
+
+	d, _ := el["Duration"].(float64) // nanoseconds
+	return t, time.Duration(d)
+}
+
+// getFromTags decodes tags[key] into v, by round tripping it through json.
+func getFromTags(tags map[string]interface{}, key string, v interface{}) error {
+	buf, err := json.Marshal(tags[key])
+	if err != nil {
+		return err
 	}
-	return block, nil
+	return json.Unmarshal(buf, v)
+}
+
+func getBlockFromTags(tags map[string]interface{}, key string) (types.Block, error) {
+	var block types.Block
+	err := getFromTags(tags, key, &block)
+	return block, err
 }
 
 func getMsgFromTags(tags map[string]interface{}, key string) (types.Message, error) {
 	var message types.Message
-	msg, err := json.Marshal(tags[key])
-	if err != nil {
-		return types.Message{}, err
-	}
-	if err = json.Unmarshal(msg, &message); err != nil {
-		return types.Message{}, err
-	}
-	return message, nil
+	err := getFromTags(tags, key, &message)
+	return message, err
 }
 
 func cidSetToStrings(set types.SortedCidSet) []string {
@@ -415,37 +404,33 @@ func cidSetToStrings(set types.SortedCidSet) []string {
 	return s
 }
 
-func blockForSimEvent(b types.Block) map[string]interface{} {
-	return map[string]interface{}{
-		"cid":          b.Cid().String(),
-		"parents":      cidSetToStrings(b.Parents),
-		"miner":        b.Miner.String(),
-		"height":       b.Height,
-		"messageCount": len(b.Messages),
-		"stateRoot":    b.StateRoot.String(),
+func blockForSimEvent(b types.Block) events.Block {
+	return events.Block{
+		Cid:          b.Cid().String(),
+		Parents:      cidSetToStrings(b.Parents),
+		Miner:        b.Miner.String(),
+		Height:       uint64(b.Height),
+		MessageCount: len(b.Messages),
+		StateRoot:    b.StateRoot.String(),
 	}
 }
 
-// NONE OF THIS IS SAFE OMG
-
+// getStrSafe returns m[k] as a string. Cids ({"/": "<cid>"}) become the
+// cid, and other non-strings are formatted with fmt.
 func getStrSafe(m map[string]interface{}, k string) string {
-	v, _ := m[k].(string)
-	return v
-}
-
-func getIntSafe(m map[string]interface{}, k string) int {
-	v, _ := m[k].(int)
-	return v
-}
-
-func newSimEvent(id string) map[string]interface{} {
-	return map[string]interface{}{"from": id}
+	switch v := m[k].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}:
+		if c, ok := v["/"].(string); ok {
+			return c
+		}
+	}
+	return fmt.Sprint(m[k])
 }
 
-func joinSimEvent(e ...map[string]interface{}) []map[string]interface{} {
-	l := make([]map[string]interface{}, len(e))
-	for i, m := range e {
-		l[i] = m
-	}
-	return l
+func joinSimEvent(e ...events.Event) []events.Event {
+	return e
 }
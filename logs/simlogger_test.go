@@ -2,13 +2,18 @@ package logs
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	events "github.com/filecoin-project/filecoin-network-sim/logs/events"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSimLoggerFiles(t *testing.T) {
@@ -30,3 +35,49 @@ func TestSimLoggerFiles(t *testing.T) {
 	_ = fmt.Printf
 	// assert.Exactly(t, buf.Bytes(), f2)
 }
+
+func TestSimLoggerTypedEvents(t *testing.T) {
+	eventlogs := strings.Join([]string{
+		// prices and sizes are numbers, as in eventlogs.ndjson.
+		`{"Operation":"sm.AddAsk","Start":"2018-04-20T19:33:38.8Z","Duration":141575,"Tags":{"ask":{"id":0,"owner":"m1","price":5,"size":1000}}}`,
+		`{"Operation":"ProposeDeal","Start":"2018-04-20T19:33:39Z","Tags":{"ask":{"id":0,"owner":"m1","price":5,"size":1000},` +
+			`"bid":{"id":3,"owner":"c1","price":10,"size":10,"collateral":null},"deal":{"ask":0,"bid":3,"dataRef":{"/":"zData"}},"miner-owner":"w1"}}`,
+		`{"Operation":"finishDeal","Start":"2018-04-20T19:33:40Z","Tags":{"miner":"m1","msgCid":{"/":"zMsg"},"deal":{"ask":0,"bid":3,"dataRef":{"/":"zData"}}}}`,
+		`{"Operation":"swarmConnectCmdTo","Start":"2018-04-20T19:33:41Z","Tags":{"peer":"QmPeer"}}`,
+		`{"Operation":"sm.AddBid","Start":"2018-04-20T19:33:42Z","Tags":{"error":"failed"}}`,
+	}, "\n")
+
+	l := NewSimLogger("n1", strings.NewReader(eventlogs))
+	buf := bytes.NewBuffer(nil)
+	io.Copy(buf, l.Reader())
+
+	var evts []events.Event
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		e, err := events.Decode([]byte(line))
+		require.NoError(t, err, line)
+		evts = append(evts, e)
+	}
+	require.Len(t, evts, 4) // swarmConnectCmdTo is dropped
+	assert.Contains(t, buf.String(), `"price":5,"size":1000`)
+
+	ask := evts[0].(*events.AddAsk)
+	assert.Equal(t, "n1", ask.From)
+	assert.Equal(t, json.Number("1000"), ask.Ask.Size)
+	assert.Equal(t, time.Date(2018, 4, 20, 19, 33, 38, 8e8, time.UTC), ask.Time)
+	assert.Equal(t, 141575*time.Nanosecond, ask.Duration)
+
+	deal := evts[1].(*events.MakeDeal)
+	assert.Equal(t, "c1", deal.From)
+	assert.Equal(t, "w1", deal.To)
+	assert.Equal(t, json.Number("5"), deal.Price)
+	assert.Equal(t, json.Number("10"), deal.Size)
+	assert.Equal(t, "zData", deal.Data)
+
+	file := evts[2].(*events.SendFile)
+	assert.Equal(t, "m1", file.To)
+
+	finish := evts[3].(*events.FinishDeal)
+	assert.Equal(t, "m1", finish.From)
+	assert.Equal(t, "zMsg", finish.TxID)
+	assert.Equal(t, uint64(3), finish.Deal.Bid)
+}
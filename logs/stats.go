@@ -0,0 +1,76 @@
+package logs
+
+import (
+	"bytes"
+	"sync"
+
+	events "github.com/filecoin-project/filecoin-network-sim/logs/events"
+)
+
+// Stats is an io.Writer that counts the sim events written to it, one
+// per line. Lines that are not events are ignored.
+type Stats struct {
+	lk   sync.Mutex
+	line []byte // partial line, until its newline is written
+
+	counts  map[string]uint64          // events by type
+	heights map[uint64]map[string]bool // blocks mined at each height
+	forks   uint64                     // heights with more than one block
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		counts:  make(map[string]uint64),
+		heights: make(map[uint64]map[string]bool),
+	}
+}
+
+func (s *Stats) Write(buf []byte) (int, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.line = append(s.line, buf...)
+	for {
+		i := bytes.IndexByte(s.line, '\n')
+		if i < 0 {
+			return len(buf), nil
+		}
+		line := s.line[:i]
+		s.line = s.line[i+1:]
+
+		if e, err := events.Decode(line); err == nil {
+			s.count(e)
+		}
+	}
+}
+
+// count should be called with the lock held.
+func (s *Stats) count(e events.Event) {
+	s.counts[e.Header().Type]++
+
+	if b, ok := e.(*events.NewBlockMined); ok {
+		blocks := s.heights[b.Height]
+		if blocks == nil {
+			blocks = make(map[string]bool)
+			s.heights[b.Height] = blocks
+		}
+		blocks[b.Block] = true
+		if len(blocks) == 2 {
+			s.forks++
+		}
+	}
+}
+
+// Count returns how many events of type typ were written.
+func (s *Stats) Count(typ string) uint64 {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.counts[typ]
+}
+
+// Forks returns how many heights more than one block was mined at.
+func (s *Stats) Forks() uint64 {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.forks
+}
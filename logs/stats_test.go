@@ -0,0 +1,27 @@
+package logs
+
+import (
+	"testing"
+
+	events "github.com/filecoin-project/filecoin-network-sim/logs/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	s := NewStats()
+
+	// lines split across writes, and several lines in one write.
+	s.Write([]byte(`{"type":"NewBlockMined","block":"zA","height":1}` + "\n" + `{"type":"NewBlock`))
+	s.Write([]byte(`Mined","block":"zB","height":1}` + "\n"))
+	s.Write([]byte(`{"type":"NewBlockMined","block":"zC","height":1}` + "\n"))
+	s.Write([]byte(`{"type":"NewBlockMined","block":"zD","height":2}` + "\n"))
+	s.Write([]byte(`{"type":"NewBlockMined","block":"zD","height":2}` + "\n"))
+	s.Write([]byte(`{"type":"MakeDeal"}` + "\n" + `{"type":"SendPayment"}` + "\n"))
+	s.Write([]byte("not json\n" + `{"type":"NoSuchEvent"}` + "\n"))
+
+	assert.Equal(t, uint64(5), s.Count(events.TypeNewBlockMined))
+	assert.Equal(t, uint64(1), s.Count(events.TypeMakeDeal))
+	assert.Equal(t, uint64(1), s.Count(events.TypeSendPayment))
+	assert.Equal(t, uint64(0), s.Count(events.TypeFinishDeal))
+	assert.Equal(t, uint64(1), s.Forks())
+}
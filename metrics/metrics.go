@@ -0,0 +1,162 @@
+// Package metrics keeps the sim's numbers, and writes them in the
+// Prometheus text exposition format, so any Prometheus compatible scraper
+// (or curl) can read them.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the buckets of a
+// latency histogram. Daemon cli calls take from milliseconds to minutes.
+var LatencyBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120}
+
+// Histogram counts observations in buckets, like a Prometheus histogram.
+type Histogram struct {
+	lk     sync.Mutex
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram returns a histogram with buckets up to bounds, which must
+// be sorted. There is always one more bucket, up to +Inf.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// ObserveDuration observes d in seconds.
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Snapshot returns the histogram as it is now.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	s := HistogramSnapshot{
+		Bounds:     h.bounds,
+		Cumulative: make([]uint64, len(h.counts)),
+		Sum:        h.sum,
+		Count:      h.count,
+	}
+	var c uint64
+	for i, n := range h.counts {
+		c += n
+		s.Cumulative[i] = c
+	}
+	return s
+}
+
+// HistogramSnapshot is a histogram at one point in time. Cumulative[i]
+// is the number of observations <= Bounds[i], and the last one is the
+// number of all observations.
+type HistogramSnapshot struct {
+	Bounds     []float64
+	Cumulative []uint64
+	Sum        float64
+	Count      uint64
+}
+
+// Labels are the labels of a sample, like {"op": "mine"}.
+type Labels map[string]string
+
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", k, l[k])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (l Labels) with(k, v string) Labels {
+	l2 := Labels{k: v}
+	for k, v := range l {
+		l2[k] = v
+	}
+	return l2
+}
+
+// Writer writes metrics in the text exposition format. It keeps the
+// first error, and skips writing after it.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Err returns the first error writing.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) printf(format string, a ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, a...)
+	}
+}
+
+// Header starts a metric. typ is counter, gauge or histogram.
+func (w *Writer) Header(name, typ, help string) {
+	w.printf("# HELP %s %s\n", name, help)
+	w.printf("# TYPE %s %s\n", name, typ)
+}
+
+func (w *Writer) Sample(name string, labels Labels, v float64) {
+	w.printf("%s%s %s\n", name, labels, formatFloat(v))
+}
+
+// Histogram writes the samples of a histogram: its buckets, sum and count.
+func (w *Writer) Histogram(name string, labels Labels, h HistogramSnapshot) {
+	for i, c := range h.Cumulative {
+		le := math.Inf(1)
+		if i < len(h.Bounds) {
+			le = h.Bounds[i]
+		}
+		w.Sample(name+"_bucket", labels.with("le", formatFloat(le)), float64(c))
+	}
+	w.Sample(name+"_sum", labels, h.Sum)
+	w.Sample(name+"_count", labels, float64(h.Count))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.ObserveDuration(500 * time.Millisecond)
+	h.Observe(3)
+
+	s := h.Snapshot()
+	assert.Equal(t, []uint64{2, 3, 4}, s.Cumulative)
+	assert.Equal(t, uint64(4), s.Count)
+	assert.InDelta(t, 3.65, s.Sum, 1e-9)
+}
+
+func TestWriter(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.5)
+
+	buf := bytes.NewBuffer(nil)
+	w := NewWriter(buf)
+	w.Header("sim_nodes", "gauge", "Nodes, by type.")
+	w.Sample("sim_nodes", Labels{"type": "Miner"}, 3)
+	w.Sample("sim_nodes", nil, 1.5)
+	w.Header("sim_call_seconds", "histogram", "Call latencies.")
+	w.Histogram("sim_call_seconds", Labels{"op": "mine"}, h.Snapshot())
+	assert.NoError(t, w.Err())
+
+	assert.Equal(t, `# HELP sim_nodes Nodes, by type.
+# TYPE sim_nodes gauge
+sim_nodes{type="Miner"} 3
+sim_nodes 1.5
+# HELP sim_call_seconds Call latencies.
+# TYPE sim_call_seconds histogram
+sim_call_seconds_bucket{le="0.1",op="mine"} 0
+sim_call_seconds_bucket{le="1",op="mine"} 1
+sim_call_seconds_bucket{le="+Inf",op="mine"} 1
+sim_call_seconds_sum{op="mine"} 0.5
+sim_call_seconds_count{op="mine"} 1
+`, buf.String())
+}
@@ -0,0 +1,417 @@
+package network
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	logs "github.com/filecoin-project/filecoin-network-sim/logs"
+
+	sm "github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
+)
+
+// MineOnce has nd mine a block.
+func (n *Network) MineOnce(ctx context.Context, nd *Node) error {
+	return n.do(ctx, OpMine, nd, nd.MiningOnce)
+}
+
+// MinerIdentity returns nd's miner address, creating its miner if needed.
+func (n *Network) MinerIdentity(ctx context.Context, nd *Node) (string, error) {
+	var addr string
+	err := n.do(ctx, OpMiner, nd, func(ctx context.Context) error {
+		var err error
+		addr, err = nd.CreateOrGetMinerIdentity(ctx)
+		return err
+	})
+	return addr, err
+}
+
+// Payment sends amt filecoin from one node's main wallet to another's.
+func (n *Network) Payment(ctx context.Context, from, to *Node, amt int) error {
+	a1, a2 := from.WalletAddr, to.WalletAddr
+	if a1 == "" || a2 == "" {
+		return fmt.Errorf("could not get wallet addresses: %q %q", a1, a2)
+	}
+
+	return n.do(ctx, OpPayment, from, func(ctx context.Context) error {
+		// ensure source has balance first. if doesn't, it wont work.
+		bal, err := from.WalletBalance(ctx, a1)
+		if err != nil {
+			return fmt.Errorf("could not get balance for address %s: %s", a1, err)
+		}
+		if bal < amt {
+			return fmt.Errorf("not enough money in address: %s %d", a1, bal)
+		}
+
+		return from.SendFilecoin(ctx, a1, a2, amt)
+	})
+}
+
+// Ask adds a storage market ask from nd, creating its miner if needed.
+func (n *Network) Ask(ctx context.Context, nd *Node, size, price int) error {
+	// ensure they have a miner addrss associated with them.
+	from, err := n.MinerIdentity(ctx, nd)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("adding ask: %s %d %d", from, size, price)
+	return n.do(ctx, OpAsk, nd, func(ctx context.Context) error {
+		return nd.MinerAddAsk(ctx, from, size, price)
+	})
+}
+
+// Bid adds a storage market bid from nd's main wallet.
+func (n *Network) Bid(ctx context.Context, nd *Node, size, price int) error {
+	from := nd.WalletAddr
+	log.Printf("adding bid: %s %d %d", from, size, price)
+	return n.do(ctx, OpBid, nd, func(ctx context.Context) error {
+		return nd.ClientAddBid(ctx, from, size, price)
+	})
+}
+
+// FindDeal finds the best ask for one of client's unused bids. If miner
+// is not nil, only its asks are considered.
+func (n *Network) FindDeal(ctx context.Context, client, miner *Node) (sm.Ask, sm.Bid, error) {
+	var out string
+	err := n.do(ctx, OpOrderbook, client, func(ctx context.Context) error {
+		var err error
+		out, err = client.OrderbookGetAsks(ctx)
+		return err
+	})
+	if err != nil {
+		return sm.Ask{}, sm.Bid{}, err
+	}
+	asks, err := extractAsks(out)
+	if err != nil {
+		return sm.Ask{}, sm.Bid{}, err
+	}
+
+	if miner != nil {
+		asks = filterAsks(asks, miner.GetMinerIdentity())
+	}
+
+	err = n.do(ctx, OpOrderbook, client, func(ctx context.Context) error {
+		var err error
+		out, err = client.OrderbookGetBids(ctx)
+		return err
+	})
+	if err != nil {
+		return sm.Ask{}, sm.Bid{}, err
+	}
+	bids, err := extractUnusedBids(out)
+	if err != nil {
+		return sm.Ask{}, sm.Bid{}, err
+	}
+
+	wallet := client.WalletAddr
+	log.Printf("Wallet Address: %s\n", wallet)
+
+	ask, bid, err := getBestDealPair(asks, bids, wallet)
+	if err != nil {
+		return sm.Ask{}, sm.Bid{}, err
+	}
+
+	log.Printf("[RAND] deal found ask and bid\n")
+	log.Printf("[RAND] ask %d %s %s\n", ask.ID, ask.Price.String(), ask.Size.String())
+	log.Printf("[RAND] bid %d %s %s\n", bid.ID, bid.Price.String(), bid.Size.String())
+	return ask, bid, nil
+}
+
+// Deal is a deal a client made through the Network, and a miner
+// accepted.
+type Deal struct {
+	Client *Node
+	Miner  *Node // nil if the ask's miner is not in the network
+	Ask    sm.Ask
+	Bid    sm.Bid
+	File   string   // path of the file that was stored
+	Cid    string   // cid of the file, once imported
+	Hash   [32]byte // sha256 of the file, when it was proposed
+	Size   int
+}
+
+// MaxDeals is how many deals a Network keeps for retrievals. Older deals
+// are forgotten.
+const MaxDeals = 1000
+
+// ProposeDeal imports file into client, and proposes a deal to store it
+// with ask and bid. It fails if the miner does not accept the deal.
+func (n *Network) ProposeDeal(ctx context.Context, client *Node, ask sm.Ask, bid sm.Bid, file string) (*Deal, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file to store: %s", err)
+	}
+
+	var cid, out string
+	err = n.do(ctx, OpImport, client, func(ctx context.Context) error {
+		var err error
+		cid, err = client.ClientImport(ctx, file)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = n.do(ctx, OpDeal, client, func(ctx context.Context) error {
+		var err error
+		out, err = client.ProposeDeal(ctx, ask.ID, bid.ID, cid)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[RAND] deal proposal: %s\n", out)
+	state, msg, err := parseDealResponse(out)
+	if err != nil {
+		return nil, err
+	}
+	if !dealAccepted(state) {
+		return nil, fmt.Errorf("deal for %s was %s: %s", cid, state, msg)
+	}
+
+	d := &Deal{
+		Client: client,
+		Miner:  n.getNodeByMinerAddr(ask.Owner.String()),
+		Ask:    ask,
+		Bid:    bid,
+		File:   file,
+		Cid:    cid,
+		Hash:   sha256.Sum256(data),
+		Size:   len(data),
+	}
+
+	n.lk.Lock()
+	n.deals = append(n.deals, d)
+	if len(n.deals) > MaxDeals {
+		n.deals = append([]*Deal(nil), n.deals[len(n.deals)-MaxDeals:]...)
+	}
+	n.lk.Unlock()
+	return d, nil
+}
+
+// dealStates are the states of a deal, as go-filecoin numbers them.
+var dealStates = []string{"unknown", "rejected", "accepted", "started", "failed", "posted", "complete"}
+
+// dealAccepted returns whether a deal in state was accepted by its miner,
+// whether or not it is done yet.
+func dealAccepted(state string) bool {
+	switch state {
+	case "accepted", "started", "posted", "complete":
+		return true
+	}
+	return false
+}
+
+// parseDealResponse returns the state of a deal, and its message, from
+// the response to its proposal: either text, like "Status: accepted", or
+// the JSON of a deal response, like {"State":2,"Message":""}.
+func parseDealResponse(out string) (state, msg string, err error) {
+	out = strings.TrimSpace(out)
+	if strings.HasPrefix(out, "{") {
+		var resp struct {
+			State   int
+			Message string
+		}
+		if err := json.Unmarshal([]byte(out), &resp); err != nil {
+			return "", "", fmt.Errorf("could not read deal response %q: %s", out, err)
+		}
+		if resp.State < 0 || resp.State >= len(dealStates) {
+			return "", "", fmt.Errorf("unknown deal state %d in %q", resp.State, out)
+		}
+		return dealStates[resp.State], resp.Message, nil
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.TrimSpace(kv[1])
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "status", "state":
+			state = strings.ToLower(v)
+		case "message":
+			msg = v
+		}
+	}
+	for _, s := range dealStates {
+		if s == state {
+			return state, msg, nil
+		}
+	}
+	return "", "", fmt.Errorf("no deal state in deal response %q", out)
+}
+
+// Deals returns the deals accepted so far, oldest first, up to MaxDeals.
+func (n *Network) Deals() []*Deal {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return append([]*Deal(nil), n.deals...)
+}
+
+// Retrieve has client fetch the data stored in deal d, and checks it
+// against the file stored. It logs a RetrieveFile event on success.
+func (n *Network) Retrieve(ctx context.Context, client *Node, d *Deal) error {
+	start := time.Now()
+	var data []byte
+	err := n.do(ctx, OpRetrieve, client, func(ctx context.Context) error {
+		var err error
+		data, err = client.ClientCat(ctx, d.Cid)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	latency := time.Since(start)
+
+	if sha256.Sum256(data) != d.Hash {
+		return fmt.Errorf("retrieved data for %s does not match %s (%d bytes, %d stored)", d.Cid, d.File, len(data), d.Size)
+	}
+
+	from := d.Ask.Owner.String()
+	if d.Miner != nil {
+		from = d.Miner.WalletAddr
+	}
+
+	log.Printf("[RAND] retrieved %s: %d bytes in %s\n", d.Cid, len(data), latency)
+	return client.Logs().WriteEvent(logs.RetrieveFileEvent(from, client.WalletAddr, d.Cid, len(data), latency))
+}
+
+func (n *Network) getNodeByMinerAddr(addr string) *Node {
+	for _, nd := range n.GetNodesOfType(MinerNodeType) {
+		if nd.GetMinerIdentity() == addr {
+			return nd
+		}
+	}
+	return nil
+}
+
+func filterAsks(asks []sm.Ask, owner string) []sm.Ask {
+	var out []sm.Ask
+	for _, a := range asks {
+		if a.Owner.String() == owner {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func getBestDealPair(asks []sm.Ask, bids []sm.Bid, wallet string) (sm.Ask, sm.Bid, error) {
+	// Sort bids by ID, FIFO
+	sort.Slice(bids[:], func(i, j int) bool {
+		return bids[i].ID < bids[j].ID
+	})
+
+	// Sort asks by Price, as we will always want the best price
+	sort.Slice(asks[:], func(i, j int) bool {
+		return asks[i].Price.LessThan(asks[j].Price)
+	})
+
+	// All bids for the given wallet
+	var walletBids []sm.Bid
+
+	// Find all bids for the provided wallet
+	for _, b := range bids {
+		if b.Owner.String() == wallet {
+			log.Printf("[RAND] getBestDealPair found bid for wallet %s id, %d, price %s, size, %s\n", wallet, b.ID, b.Price.String(), b.Size.String())
+			walletBids = append(walletBids, b)
+		}
+	}
+
+	if len(walletBids) != 0 {
+		for _, b := range walletBids {
+			// Check to see if the bid fits within an ask
+			for _, a := range asks {
+				if b.Size.LessEqual(a.Size) && b.Price.GreaterEqual(a.Price) {
+					// Valid bid for ask
+					return a, b, nil
+				}
+			}
+		}
+	} else {
+		log.Printf("Could not find any bids for wallet %s\n", wallet)
+	}
+
+	err := fmt.Errorf("Could not find matching ask / bid for wallet %s", wallet)
+	return sm.Ask{}, sm.Bid{}, err
+
+}
+
+func extractAsks(input string) ([]sm.Ask, error) {
+
+	// remove last new line
+	o := strings.Trim(input, "\n")
+	// separate ndjson on new lines
+	as := strings.Split(o, "\n")
+	log.Printf("[RAND] extractAsks: asks of length %d: %v\n", len(as), as)
+	if o == "" {
+		return nil, fmt.Errorf("No Asks yet")
+	}
+
+	var asks []sm.Ask
+	for _, a := range as {
+		var ask sm.Ask
+		log.Printf("[RAND] extractAsks: ask %v\n", a)
+		err := json.Unmarshal([]byte(a), &ask)
+		if err != nil {
+			panic(err)
+		}
+		asks = append(asks, ask)
+	}
+	return asks, nil
+}
+
+func extractUnusedBids(input string) ([]sm.Bid, error) {
+	// remove last new line
+	o := strings.Trim(input, "\n")
+	// separate ndjson on new lines
+	bs := strings.Split(o, "\n")
+	log.Printf("[RAND] extractUnusedBids: bids of length %d: %v\n", len(bs), bs)
+	if o == "" {
+		return nil, fmt.Errorf("No Bids yet")
+	}
+
+	var bids []sm.Bid
+	for _, b := range bs {
+		var bid sm.Bid
+		log.Printf("[RAND] extractUnusedBids: bid %v\n", b)
+		err := json.Unmarshal([]byte(b), &bid)
+		if err != nil {
+			panic(err)
+		}
+		if bid.Used {
+			continue
+		}
+		bids = append(bids, bid)
+	}
+	return bids, nil
+}
+
+func extractDeals(input string) []sm.Deal {
+
+	// remove last new line
+	o := strings.Trim(input, "\n")
+	// separate ndjson on new lines
+	ds := strings.Split(o, "\n")
+	log.Printf("[RAND] extractDeals: deals of length %d: %v\n", len(ds), ds)
+
+	var deals []sm.Deal
+	for _, d := range ds {
+		var deal sm.Deal
+		log.Printf("[RAND] extractDeals: deal %v\n", d)
+		err := json.Unmarshal([]byte(d), &deal)
+		if err != nil {
+			panic(err)
+		}
+		deals = append(deals, deal)
+	}
+	return deals
+}
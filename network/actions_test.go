@@ -0,0 +1,97 @@
+package network
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkRetrieve(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	net := NewTestNetwork(t)
+	defer net.ShutdownAll()
+
+	types := ReadLogTypes(net.Logs().Reader())
+
+	miner, err := net.AddNode(MinerNodeType)
+	require.NoError(err)
+	client, err := net.AddNode(ClientNodeType)
+	require.NoError(err)
+	other, err := net.AddNode(ClientNodeType)
+	require.NoError(err)
+
+	require.NoError(net.Ask(ctx, miner, 1000, 5))
+	require.NoError(net.Bid(ctx, client, 10, 10))
+	ask, bid, err := net.FindDeal(ctx, client, miner)
+	require.NoError(err)
+
+	fp := filepath.Join(client.RepoDir(), "data")
+	require.NoError(ioutil.WriteFile(fp, []byte("some data to store"), 0644))
+
+	d, err := net.ProposeDeal(ctx, client, ask, bid, fp)
+	require.NoError(err)
+	require.True(miner == d.Miner)
+	require.Equal([]*Deal{d}, net.Deals())
+
+	// the client that stored it, and another that must fetch it.
+	require.NoError(net.Retrieve(ctx, client, d))
+	require.NoError(net.Retrieve(ctx, other, d))
+
+	// the data is checked against the file as it was stored.
+	require.NoError(ioutil.WriteFile(fp, []byte("other data"), 0644))
+	require.NoError(net.Retrieve(ctx, other, d))
+	bad := *d
+	bad.Hash = sha256.Sum256([]byte("other data"))
+	require.Error(net.Retrieve(ctx, other, &bad))
+
+	n := 0
+	timeout := time.After(5 * time.Second)
+	for n < 3 {
+		select {
+		case typ := <-types:
+			if typ == "RetrieveFile" {
+				n++
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for RetrieveFile")
+		}
+	}
+
+	// random retrievals skip clients that are down.
+	r := NewRandomizer(net, Args{Seed: 1})
+	require.NoError(net.FreezeNode(other))
+	require.Equal(errSkipped, r.doActionSendFile(ctx, NewRand(1)))
+	require.NoError(net.ThawNode(other))
+	require.NoError(r.doActionSendFile(ctx, NewRand(1)))
+}
+
+func TestParseDealResponse(t *testing.T) {
+	for _, c := range []struct {
+		out, state, msg string
+	}{
+		{"Status: accepted\nMessage: \nDealID: 4c4d\n", "accepted", ""},
+		{"status: rejected\nmessage: no space\n", "rejected", "no space"},
+		{`{"State":2,"Message":"","MsgCid":null}`, "accepted", ""},
+		{`{"State":6,"Message":"done"}`, "complete", "done"},
+	} {
+		state, msg, err := parseDealResponse(c.out)
+		require.NoError(t, err, c.out)
+		require.Equal(t, c.state, state, c.out)
+		require.Equal(t, c.msg, msg, c.out)
+	}
+
+	require.True(t, dealAccepted("posted"))
+	require.False(t, dealAccepted("failed"))
+
+	for _, out := range []string{"", "deal proposed", `{"State":9}`, "Status: lost"} {
+		_, _, err := parseDealResponse(out)
+		require.Error(t, err, out)
+	}
+}
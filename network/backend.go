@@ -0,0 +1,58 @@
+package network
+
+import (
+	"context"
+	"io"
+)
+
+// NodeBackend is a single filecoin node, as driven by the Network and the
+// Randomizer. The go-filecoin daemon (DaemonBackend) is one implementation.
+type NodeBackend interface {
+	Start() error
+	Shutdown() error
+
+	// Kill stops the node abruptly, like kill -9. Restart starts it again
+	// from its repo, after Kill.
+	Kill() error
+	Restart() error
+
+	// Freeze pauses the node, like SIGSTOP, until Thaw.
+	Freeze() error
+	Thaw() error
+
+	GetID() (string, error)
+	GetAddress() (string, error) // swarm address
+	GetMainWalletAddress() (string, error)
+	CmdAddr() string
+	RepoDir() string
+
+	// EventLogStream returns the node's eventlogs, as ndjson.
+	EventLogStream() io.Reader
+
+	// The calls below talk to the running node. They give up, and return
+	// ctx's error, once ctx is done.
+	Connect(ctx context.Context, remote NodeBackend) error
+	Disconnect(ctx context.Context, remote NodeBackend) error
+	MiningOnce(ctx context.Context) error
+	CreateMinerAddr(ctx context.Context) (string, error)
+	WalletBalance(ctx context.Context, addr string) (int, error)
+	SendFilecoin(ctx context.Context, from, to string, amt int) error
+	MinerAddAsk(ctx context.Context, from string, size, price int) error
+	ClientAddBid(ctx context.Context, from string, size, price int) error
+
+	// OrderbookGetAsks and OrderbookGetBids return the orderbook as ndjson.
+	OrderbookGetAsks(ctx context.Context) (string, error)
+	OrderbookGetBids(ctx context.Context) (string, error)
+
+	// ClientImport imports the file at path, and returns its cid.
+	ClientImport(ctx context.Context, path string) (string, error)
+	ProposeDeal(ctx context.Context, askID, bidID uint64, cid string) (string, error)
+
+	// ClientCat fetches the data for cid, from the network if it is not
+	// stored locally.
+	ClientCat(ctx context.Context, cid string) ([]byte, error)
+}
+
+// NewBackendFunc constructs a node backend (not yet started) that keeps
+// its repo in repoDir.
+type NewBackendFunc func(repoDir string) (NodeBackend, error)
@@ -0,0 +1,113 @@
+package network
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the sim clock periodic loops wait on. Sim time only passes
+// while the clock runs: it can be paused, resumed, and while paused,
+// stepped one tick at a time.
+type Clock struct {
+	lk      sync.Mutex
+	paused  bool
+	steps   uint64
+	changed chan struct{} // closed, and replaced, on every change
+}
+
+func NewClock() *Clock {
+	return &Clock{changed: make(chan struct{})}
+}
+
+// Pause stops sim time. Waits in progress keep the time they have left.
+func (c *Clock) Pause() {
+	c.update(func() { c.paused = true })
+}
+
+func (c *Clock) Resume() {
+	c.update(func() { c.paused = false })
+}
+
+// Step advances each loop one tick: it ends the loop's wait in progress,
+// or its next one, if it is busy.
+func (c *Clock) Step() {
+	c.update(func() { c.steps++ })
+}
+
+func (c *Clock) Paused() bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.paused
+}
+
+// Steps returns how many times the clock was stepped.
+func (c *Clock) Steps() uint64 {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.steps
+}
+
+func (c *Clock) update(f func()) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	f()
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *Clock) state() (bool, uint64, <-chan struct{}) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.paused, c.steps, c.changed
+}
+
+// Wait waits for d of sim time, or until the clock is stepped past seen,
+// the steps as of the last Wait of the caller. It returns the steps as of
+// now, for the next Wait: a loop that passes them on misses no step, even
+// one made while it was busy. It returns an error only if ctx is done
+// first.
+func (c *Clock) Wait(ctx context.Context, d time.Duration, seen uint64) (uint64, error) {
+	return c.wait(ctx, d, &seen)
+}
+
+// Sleep waits for d of sim time. Steps do not end it: they advance the
+// loops one tick, not sim time. It returns an error only if ctx is done
+// first.
+func (c *Clock) Sleep(ctx context.Context, d time.Duration) error {
+	_, err := c.wait(ctx, d, nil)
+	return err
+}
+
+// wait waits for d of sim time, or, if seen is not nil, until the clock
+// is stepped past it.
+func (c *Clock) wait(ctx context.Context, d time.Duration, seen *uint64) (uint64, error) {
+	for {
+		paused, steps, changed := c.state()
+		if seen != nil && steps != *seen {
+			return steps, nil
+		}
+
+		if paused {
+			select {
+			case <-ctx.Done():
+				return steps, ctx.Err()
+			case <-changed:
+			}
+			continue
+		}
+
+		start := time.Now()
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return steps, ctx.Err()
+		case <-t.C:
+			return steps, nil
+		case <-changed:
+			t.Stop()
+			d -= time.Since(start)
+		}
+	}
+}
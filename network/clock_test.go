@@ -0,0 +1,113 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func waitAsync(c *Clock, ctx context.Context, d time.Duration) <-chan error {
+	done := make(chan error, 1)
+	seen := c.Steps()
+	go func() {
+		_, err := c.Wait(ctx, d, seen)
+		done <- err
+	}()
+	return done
+}
+
+func TestClockWait(t *testing.T) {
+	c := NewClock()
+
+	start := time.Now()
+	_, err := c.Wait(context.Background(), 50*time.Millisecond, 0)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := waitAsync(c, ctx, time.Hour)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestClockPauseResume(t *testing.T) {
+	c := NewClock()
+	ctx := context.Background()
+
+	start := time.Now()
+	done := waitAsync(c, ctx, 100*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	c.Pause()
+	assert.True(t, c.Paused())
+
+	select {
+	case <-done:
+		t.Fatal("wait finished while paused")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// the remaining ~50ms pass after resuming.
+	c.Resume()
+	assert.NoError(t, <-done)
+	assert.True(t, time.Since(start) >= 250*time.Millisecond)
+}
+
+func TestClockStep(t *testing.T) {
+	c := NewClock()
+	ctx := context.Background()
+	c.Pause()
+
+	done1 := waitAsync(c, ctx, time.Hour)
+	done2 := waitAsync(c, ctx, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	select {
+	case <-done2:
+		t.Fatal("wait finished while paused")
+	default:
+	}
+
+	c.Step()
+	assert.NoError(t, <-done1)
+	assert.NoError(t, <-done2)
+	assert.Equal(t, uint64(1), c.Steps())
+	assert.True(t, c.Paused())
+}
+
+func TestClockStepWhileBusy(t *testing.T) {
+	c := NewClock()
+	c.Pause()
+
+	// a step made while the loop is not waiting ends its next wait.
+	c.Step()
+	steps, err := c.Wait(context.Background(), time.Hour, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), steps)
+
+	// and only that one.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.Wait(ctx, time.Hour, steps)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestClockSleep(t *testing.T) {
+	c := NewClock()
+	c.Pause()
+
+	// steps do not end a sleep: only sim time does.
+	done := make(chan error, 1)
+	go func() { done <- c.Sleep(context.Background(), 50*time.Millisecond) }()
+	time.Sleep(20 * time.Millisecond)
+	c.Step()
+	select {
+	case <-done:
+		t.Fatal("step ended a sleep")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	c.Resume()
+	assert.NoError(t, <-done)
+}
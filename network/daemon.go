@@ -0,0 +1,278 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	daemon "github.com/filecoin-project/go-filecoin/testhelpers"
+)
+
+// DaemonBackend runs a node as a go-filecoin daemon, and talks to it
+// through the go-filecoin cli.
+type DaemonBackend struct {
+	lk sync.Mutex // guards d, which Restart replaces
+	d  *daemon.Daemon
+}
+
+func NewDaemonBackend(repoDir string) (NodeBackend, error) {
+	d, err := daemon.NewDaemon(
+		daemon.RepoDir(repoDir),
+		daemon.ShouldInit(true),
+		daemon.InsecureApi(),
+		daemon.ShouldStartMining(false),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &DaemonBackend{d: d}, nil
+}
+
+// CheckDaemonBinary returns an error if there is no go-filecoin binary
+// to run daemons with.
+func CheckDaemonBinary() error {
+	_, err := daemon.GetFilecoinBinary()
+	return err
+}
+
+func (b *DaemonBackend) daemon() *daemon.Daemon {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return b.d
+}
+
+func (b *DaemonBackend) Start() error {
+	if _, err := b.daemon().Start(); err != nil {
+		return err
+	}
+
+	// frrist: we want realistic sim. lots of actions gated by 1-at-atime consesnus
+	b.daemon().SetWaitMining(false)
+	return nil
+}
+
+func (b *DaemonBackend) Shutdown() error {
+	return b.daemon().Shutdown()
+}
+
+func (b *DaemonBackend) Kill() error {
+	return b.signal(syscall.SIGKILL)
+}
+
+// Restart starts a new daemon on the repo of a killed one. It listens on
+// new addresses.
+func (b *DaemonBackend) Restart() error {
+	d, err := daemon.NewDaemon(
+		daemon.RepoDir(b.RepoDir()),
+		daemon.ShouldInit(false),
+		daemon.InsecureApi(),
+		daemon.ShouldStartMining(false),
+	)
+	if err != nil {
+		return err
+	}
+
+	b.lk.Lock()
+	b.d = d
+	b.lk.Unlock()
+	return b.Start()
+}
+
+func (b *DaemonBackend) Freeze() error {
+	return b.signal(syscall.SIGSTOP)
+}
+
+func (b *DaemonBackend) Thaw() error {
+	return b.signal(syscall.SIGCONT)
+}
+
+func (b *DaemonBackend) signal(sig syscall.Signal) error {
+	pid, err := findDaemonPid(b.RepoDir())
+	if err != nil {
+		return err
+	}
+	return syscall.Kill(pid, sig)
+}
+
+func (b *DaemonBackend) GetID() (string, error) {
+	return b.daemon().GetID()
+}
+
+func (b *DaemonBackend) GetAddress() (string, error) {
+	return b.daemon().GetAddress()
+}
+
+func (b *DaemonBackend) GetMainWalletAddress() (string, error) {
+	return b.daemon().GetMainWalletAddress()
+}
+
+func (b *DaemonBackend) CmdAddr() string {
+	return b.daemon().CmdAddr
+}
+
+func (b *DaemonBackend) RepoDir() string {
+	return b.daemon().RepoDir
+}
+
+func (b *DaemonBackend) EventLogStream() io.Reader {
+	return b.daemon().EventLogStream()
+}
+
+func (b *DaemonBackend) Connect(ctx context.Context, remote NodeBackend) error {
+	rb, ok := remote.(*DaemonBackend)
+	if !ok {
+		return fmt.Errorf("daemon cannot connect to a %T", remote)
+	}
+
+	addr, err := rb.GetAddress()
+	if err != nil {
+		return err
+	}
+	return b.ConnectAddr(ctx, addr)
+}
+
+// ConnectAddr connects to a peer at swarmAddr, which may be a link proxy.
+func (b *DaemonBackend) ConnectAddr(ctx context.Context, swarmAddr string) error {
+	_, err := b.run(ctx, "swarm", "connect", swarmAddr)
+	return err
+}
+
+func (b *DaemonBackend) Disconnect(ctx context.Context, remote NodeBackend) error {
+	rb, ok := remote.(*DaemonBackend)
+	if !ok {
+		return fmt.Errorf("daemon cannot disconnect from a %T", remote)
+	}
+
+	addr, err := rb.GetAddress()
+	if err != nil {
+		return err
+	}
+
+	_, err = b.run(ctx, "swarm", "disconnect", addr)
+	return err
+}
+
+func (b *DaemonBackend) MiningOnce(ctx context.Context) error {
+	_, err := b.run(ctx, "mining", "once")
+	return err
+}
+
+// CreateMinerAddr goes through the daemon helpers, which cannot be
+// cancelled: if ctx is done first, its cli process is left to the
+// Supervisor.
+func (b *DaemonBackend) CreateMinerAddr(ctx context.Context) (string, error) {
+	var addr string
+	err := wait(ctx, func() error {
+		a, err := b.daemon().CreateMinerAddr(true)
+		if err != nil {
+			return err
+		}
+		addr = a.String()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return addr, nil
+}
+
+func (b *DaemonBackend) WalletBalance(ctx context.Context, addr string) (int, error) {
+	out, err := b.run(ctx, "wallet", "balance", addr)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+func (b *DaemonBackend) SendFilecoin(ctx context.Context, from, to string, amt int) error {
+	return b.daemon().SendFilecoin(ctx, from, to, amt)
+}
+
+func (b *DaemonBackend) MinerAddAsk(ctx context.Context, from string, size, price int) error {
+	return b.daemon().MinerAddAsk(ctx, from, size, price)
+}
+
+func (b *DaemonBackend) ClientAddBid(ctx context.Context, from string, size, price int) error {
+	return b.daemon().ClientAddBid(ctx, from, size, price)
+}
+
+func (b *DaemonBackend) OrderbookGetAsks(ctx context.Context) (string, error) {
+	out, err := b.daemon().OrderbookGetAsks(ctx)
+	if err != nil {
+		return "", err
+	}
+	return out.ReadStdout(), nil
+}
+
+func (b *DaemonBackend) OrderbookGetBids(ctx context.Context) (string, error) {
+	out, err := b.daemon().OrderbookGetBids(ctx)
+	if err != nil {
+		return "", err
+	}
+	return out.ReadStdout(), nil
+}
+
+func (b *DaemonBackend) ClientImport(ctx context.Context, path string) (string, error) {
+	out, err := b.run(ctx, "client", "import", path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (b *DaemonBackend) ClientCat(ctx context.Context, cid string) ([]byte, error) {
+	return b.run(ctx, "client", "cat", cid)
+}
+
+func (b *DaemonBackend) ProposeDeal(ctx context.Context, askID, bidID uint64, cid string) (string, error) {
+	out, err := b.run(ctx, "client", "propose-deal",
+		fmt.Sprintf("--ask=%d", askID), fmt.Sprintf("--bid=%d", bidID), cid)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// run runs a cli command against the daemon, and returns its stdout. If
+// ctx is done first, it kills the command's process, and only that one.
+func (b *DaemonBackend) run(ctx context.Context, args ...string) ([]byte, error) {
+	bin, err := daemon.GetFilecoinBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, bin, append([]string{"--cmdapiaddr=" + b.daemon().CmdAddr}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %s", strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// wait waits for f, a call to the daemon helpers, until ctx is done. The
+// helpers cannot be cancelled: if ctx is done first, f keeps running until
+// its cli process exits, or the Supervisor kills it.
+func wait(ctx context.Context, f func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- f()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
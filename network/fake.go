@@ -0,0 +1,708 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	sm "github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+const fakeBlockReward = 20000
+
+// FakeChain is the shared, in-memory world of a network of FakeBackends:
+// a toy chain, wallet balances, and the storage market orderbook.
+// All of it is guarded by one lock, so FakeBackends are safe to use
+// concurrently, and behave deterministically given the same calls.
+type FakeChain struct {
+	lk       sync.Mutex
+	genesis  *types.Block
+	nodes    []*FakeBackend
+	nodeNum  int
+	balances map[string]int
+	asks     []sm.Ask
+	bids     []sm.Bid
+	deals    []fakeDeal
+}
+
+type fakeDeal struct {
+	Ask     uint64
+	Bid     uint64
+	DataRef string
+}
+
+func NewFakeChain() *FakeChain {
+	return &FakeChain{
+		genesis:  &types.Block{StateRoot: types.SomeCid()},
+		balances: make(map[string]int),
+	}
+}
+
+// NewBackend is a NewBackendFunc for nodes on this chain.
+func (c *FakeChain) NewBackend(repoDir string) (NodeBackend, error) {
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		return nil, err
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	num := c.nodeNum
+	c.nodeNum++
+
+	return &FakeBackend{
+		chain:   c,
+		num:     num,
+		repoDir: repoDir,
+		id:      fmt.Sprintf("QmFakeNode%d", num),
+		wallet:  types.MakeTestAddress(fmt.Sprintf("fake-wallet-%d", num)).String(),
+		peers:   make(map[*FakeBackend]bool),
+		head:    c.genesis,
+		blocks:  make(map[string][]byte),
+		el:      newFakeEventLog(),
+	}, nil
+}
+
+// FakeBackend is an in-process node on a FakeChain. It emits the same
+// eventlogs (Operation/Tags) a go-filecoin daemon would, for the
+// operations the simulation cares about.
+type FakeBackend struct {
+	chain   *FakeChain
+	num     int
+	repoDir string
+	id      string
+	wallet  string
+	miner   string
+	peers   map[*FakeBackend]bool
+	head    *types.Block
+	blocks  map[string][]byte // data this node stores, by cid
+	running bool
+	frozen  bool
+	el      *fakeEventLog
+}
+
+func (b *FakeBackend) Start() error {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if b.running {
+		return fmt.Errorf("fake node %s already running", b.id)
+	}
+	b.running = true
+	c.nodes = append(c.nodes, b)
+	return nil
+}
+
+func (b *FakeBackend) Shutdown() error {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	b.stop()
+	return nil
+}
+
+// Kill stops the node like Shutdown. The fake has no graceful shutdown
+// to skip.
+func (b *FakeBackend) Kill() error {
+	return b.Shutdown()
+}
+
+// Restart starts a killed node again. It keeps its chain head, wallet
+// and data, like a daemon restarted on its repo, and catches up once it
+// connects to peers.
+func (b *FakeBackend) Restart() error {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if b.running {
+		return fmt.Errorf("fake node %s already running", b.id)
+	}
+	b.running = true
+	b.frozen = false
+	b.el = newFakeEventLog()
+	c.nodes = append(c.nodes, b)
+	return nil
+}
+
+// Freeze makes the node stop responding, and stop relaying blocks.
+func (b *FakeBackend) Freeze() error {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return err
+	}
+	b.frozen = true
+	return nil
+}
+
+// Thaw makes a frozen node respond again. It catches up with its peers.
+func (b *FakeBackend) Thaw() error {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if !b.frozen {
+		return fmt.Errorf("fake node %s is not frozen", b.id)
+	}
+	b.frozen = false
+	syncBestChain(append(b.reachable(), b))
+	return nil
+}
+
+// stop should be called with the chain lock held.
+func (b *FakeBackend) stop() {
+	if !b.running {
+		return
+	}
+	b.running = false
+	b.frozen = false
+
+	for p := range b.peers {
+		delete(p.peers, b)
+	}
+	b.peers = make(map[*FakeBackend]bool)
+
+	c := b.chain
+	for i, n := range c.nodes {
+		if n == b {
+			c.nodes = append(c.nodes[:i], c.nodes[i+1:]...)
+			break
+		}
+	}
+
+	b.el.Close()
+}
+
+func (b *FakeBackend) GetID() (string, error) {
+	return b.id, nil
+}
+
+func (b *FakeBackend) GetAddress() (string, error) {
+	return fmt.Sprintf("/ip4/127.0.0.1/tcp/%d/ipfs/%s", 6000+b.num, b.id), nil
+}
+
+func (b *FakeBackend) GetMainWalletAddress() (string, error) {
+	return b.wallet, nil
+}
+
+func (b *FakeBackend) CmdAddr() string {
+	return fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", 3453+b.num)
+}
+
+func (b *FakeBackend) RepoDir() string {
+	return b.repoDir
+}
+
+func (b *FakeBackend) EventLogStream() io.Reader {
+	b.chain.lk.Lock()
+	defer b.chain.lk.Unlock()
+	return b.el
+}
+
+func (b *FakeBackend) Connect(ctx context.Context, remote NodeBackend) error {
+	rb, ok := remote.(*FakeBackend)
+	if !ok {
+		return fmt.Errorf("fake node cannot connect to a %T", remote)
+	}
+
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return err
+	}
+	if err := rb.checkRunning(); err != nil {
+		return err
+	}
+
+	b.peers[rb] = true
+	rb.peers[b] = true
+	b.emit("swarmConnectCmdTo", map[string]interface{}{"peer": rb.id})
+
+	// like the hello protocol, nodes now in touch sync to the best chain.
+	syncBestChain(append(b.reachable(), b))
+	return nil
+}
+
+// syncBestChain moves all nodes to the highest head among them. should be
+// called with the chain lock held.
+func syncBestChain(nodes []*FakeBackend) {
+	best := nodes[0].head
+	for _, p := range nodes {
+		if p.head.Height > best.Height {
+			best = p.head
+		}
+	}
+	for _, p := range nodes {
+		if p.head.Height < best.Height {
+			p.head = best
+			p.emit("acceptNewBestBlock", map[string]interface{}{"block": best})
+		}
+	}
+}
+
+func (b *FakeBackend) Disconnect(ctx context.Context, remote NodeBackend) error {
+	rb, ok := remote.(*FakeBackend)
+	if !ok {
+		return fmt.Errorf("fake node cannot disconnect from a %T", remote)
+	}
+
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return err
+	}
+
+	delete(b.peers, rb)
+	delete(rb.peers, b)
+	return nil
+}
+
+func (b *FakeBackend) MiningOnce(ctx context.Context) error {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return err
+	}
+
+	miner := b.miner
+	if miner == "" {
+		miner = b.wallet
+	}
+	ma, err := types.NewAddressFromString(miner)
+	if err != nil {
+		return err
+	}
+
+	blk := &types.Block{
+		Miner:     ma,
+		Parents:   types.NewSortedCidSet(b.head.Cid()),
+		Height:    b.head.Height + 1,
+		StateRoot: b.head.StateRoot,
+	}
+	b.head = blk
+	c.balances[b.wallet] += fakeBlockReward
+	b.emit("AddNewBlock", map[string]interface{}{"block": blk})
+
+	// gossip the block to every node we can reach.
+	for _, p := range b.reachable() {
+		p.emit("ProcessNewBlock", map[string]interface{}{"block": blk})
+		if blk.Height > p.head.Height {
+			p.head = blk
+			p.emit("acceptNewBestBlock", map[string]interface{}{"block": blk})
+		}
+	}
+	return nil
+}
+
+func (b *FakeBackend) CreateMinerAddr(ctx context.Context) (string, error) {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return "", err
+	}
+
+	if b.miner == "" {
+		b.miner = types.MakeTestAddress(fmt.Sprintf("fake-miner-%d", b.num)).String()
+		b.emit("minerCreateCmd", map[string]interface{}{
+			"from-address": b.wallet,
+			"pledge":       "10000",
+			"collateral":   "500",
+			"addr":         b.miner,
+		})
+	}
+	return b.miner, nil
+}
+
+func (b *FakeBackend) WalletBalance(ctx context.Context, addr string) (int, error) {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return 0, err
+	}
+	return c.balances[addr], nil
+}
+
+func (b *FakeBackend) SendFilecoin(ctx context.Context, from, to string, amt int) error {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return err
+	}
+	if c.balances[from] < amt {
+		return fmt.Errorf("not enough balance in %s: %d < %d", from, c.balances[from], amt)
+	}
+
+	fa, err := types.NewAddressFromString(from)
+	if err != nil {
+		return err
+	}
+	ta, err := types.NewAddressFromString(to)
+	if err != nil {
+		return err
+	}
+
+	c.balances[from] -= amt
+	c.balances[to] += amt
+
+	msg := &types.Message{From: fa, To: ta, Value: types.NewTokenAmount(uint64(amt))}
+	b.emit("AddNewMessage", map[string]interface{}{"message": msg, "from": b.id})
+	return nil
+}
+
+func (b *FakeBackend) MinerAddAsk(ctx context.Context, from string, size, price int) error {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return err
+	}
+
+	owner, err := types.NewAddressFromString(from)
+	if err != nil {
+		return err
+	}
+
+	ask := sm.Ask{
+		ID:    uint64(len(c.asks)),
+		Owner: owner,
+		Price: types.NewTokenAmount(uint64(price)),
+		Size:  types.NewBytesAmount(uint64(size)),
+	}
+	c.asks = append(c.asks, ask)
+	b.emit("sm.AddAsk", map[string]interface{}{"ask": ask})
+	return nil
+}
+
+func (b *FakeBackend) ClientAddBid(ctx context.Context, from string, size, price int) error {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return err
+	}
+
+	owner, err := types.NewAddressFromString(from)
+	if err != nil {
+		return err
+	}
+
+	bid := sm.Bid{
+		ID:    uint64(len(c.bids)),
+		Owner: owner,
+		Price: types.NewTokenAmount(uint64(price)),
+		Size:  types.NewBytesAmount(uint64(size)),
+	}
+	c.bids = append(c.bids, bid)
+	b.emit("sm.AddBid", map[string]interface{}{"bid": bid})
+	return nil
+}
+
+func (b *FakeBackend) OrderbookGetAsks(ctx context.Context) (string, error) {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return "", err
+	}
+	return encodeNDJSON(c.asks)
+}
+
+func (b *FakeBackend) OrderbookGetBids(ctx context.Context) (string, error) {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return "", err
+	}
+	return encodeNDJSON(c.bids)
+}
+
+func (b *FakeBackend) ClientImport(ctx context.Context, path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return "", err
+	}
+
+	h := sha256.Sum256(data)
+	cid := "zFake" + hex.EncodeToString(h[:])
+	b.blocks[cid] = data
+	return cid, nil
+}
+
+// ClientCat returns data stored locally, or fetches it from a reachable node.
+func (b *FakeBackend) ClientCat(ctx context.Context, cid string) ([]byte, error) {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return nil, err
+	}
+
+	if data, ok := b.blocks[cid]; ok {
+		return data, nil
+	}
+	for _, p := range b.reachable() {
+		if data, ok := p.blocks[cid]; ok {
+			b.blocks[cid] = data
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("fake node %s could not find %s", b.id, cid)
+}
+
+func (b *FakeBackend) ProposeDeal(ctx context.Context, askID, bidID uint64, cid string) (string, error) {
+	c := b.chain
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if err := b.checkRunning(); err != nil {
+		return "", err
+	}
+	if askID >= uint64(len(c.asks)) || bidID >= uint64(len(c.bids)) {
+		return "", fmt.Errorf("unknown ask %d or bid %d", askID, bidID)
+	}
+	if c.bids[bidID].Used {
+		return "", fmt.Errorf("bid %d already used", bidID)
+	}
+	data, ok := b.blocks[cid]
+	if !ok {
+		return "", fmt.Errorf("unknown data: %s", cid)
+	}
+
+	ask := c.asks[askID]
+	c.bids[bidID].Used = true
+	bid := c.bids[bidID]
+	deal := fakeDeal{Ask: askID, Bid: bidID, DataRef: cid}
+	c.deals = append(c.deals, deal)
+
+	askTag, err := toTag(ask)
+	if err != nil {
+		return "", err
+	}
+	bidTag, err := toTag(bid)
+	if err != nil {
+		return "", err
+	}
+	dealTag := map[string]interface{}{
+		"ask":     askID,
+		"bid":     bidID,
+		"dataRef": map[string]interface{}{"/": cid},
+	}
+
+	var miner *FakeBackend
+	for _, n := range c.nodes {
+		if n.miner != "" && n.miner == ask.Owner.String() {
+			miner = n
+		}
+	}
+
+	minerOwner := ""
+	if miner != nil {
+		minerOwner = miner.wallet
+	}
+
+	b.emit("ProposeDeal", map[string]interface{}{
+		"ask":         askTag,
+		"bid":         bidTag,
+		"deal":        dealTag,
+		"miner-owner": minerOwner,
+	})
+
+	if miner != nil {
+		miner.blocks[cid] = data
+		miner.emit("fetchData", map[string]interface{}{"data": cid})
+		miner.emit("finishDeal", map[string]interface{}{
+			"miner":  ask.Owner.String(),
+			"deal":   dealTag,
+			"msgCid": cid,
+		})
+	}
+
+	// like the text response of client propose-deal.
+	return fmt.Sprintf("Status: accepted\nMessage: ask %d, bid %d, data %s\n", askID, bidID, cid), nil
+}
+
+// reachable returns all running nodes reachable from b, excluding b.
+// should be called with the chain lock held.
+func (b *FakeBackend) reachable() []*FakeBackend {
+	seen := map[*FakeBackend]bool{b: true}
+	queue := []*FakeBackend{b}
+	var out []*FakeBackend
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, p := range n.sortedPeers() {
+			if seen[p] || !p.running || p.frozen {
+				continue
+			}
+			seen[p] = true
+			out = append(out, p)
+			queue = append(queue, p)
+		}
+	}
+	return out
+}
+
+// sortedPeers returns peers in creation order, so gossip is deterministic.
+func (b *FakeBackend) sortedPeers() []*FakeBackend {
+	var ps []*FakeBackend
+	for _, n := range b.chain.nodes {
+		if b.peers[n] {
+			ps = append(ps, n)
+		}
+	}
+	return ps
+}
+
+func (b *FakeBackend) checkRunning() error {
+	if !b.running {
+		return fmt.Errorf("fake node %s is not running", b.id)
+	}
+	if b.frozen {
+		return fmt.Errorf("fake node %s is not responding", b.id)
+	}
+	return nil
+}
+
+func (b *FakeBackend) emit(op string, tags map[string]interface{}) {
+	b.el.Write(fakeEventLogEntry{
+		Operation: op,
+		Start:     time.Now(),
+		Duration:  time.Millisecond,
+		Tags:      tags,
+		Logs:      []interface{}{},
+	})
+}
+
+func encodeNDJSON(vs interface{}) (string, error) {
+	buf := bytes.NewBuffer(nil)
+	e := json.NewEncoder(buf)
+
+	switch vs := vs.(type) {
+	case []sm.Ask:
+		for _, v := range vs {
+			if err := e.Encode(v); err != nil {
+				return "", err
+			}
+		}
+	case []sm.Bid:
+		for _, v := range vs {
+			if err := e.Encode(v); err != nil {
+				return "", err
+			}
+		}
+	default:
+		return "", fmt.Errorf("cannot encode %T", vs)
+	}
+	return buf.String(), nil
+}
+
+// toTag round trips v through json, to get the generic map shape
+// eventlog tags have once decoded.
+func toTag(v interface{}) (map[string]interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(buf, &m)
+	return m, err
+}
+
+type fakeEventLogEntry struct {
+	Operation string
+	Start     time.Time
+	Duration  time.Duration
+	Tags      map[string]interface{}
+	Logs      []interface{}
+}
+
+// fakeEventLog is an unbounded ndjson stream. Writes never block, so
+// nodes can emit before anyone reads their logs, as daemons do.
+type fakeEventLog struct {
+	lk     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	closed bool
+}
+
+func newFakeEventLog() *fakeEventLog {
+	el := &fakeEventLog{}
+	el.cond = sync.NewCond(&el.lk)
+	return el
+}
+
+func (el *fakeEventLog) Write(e fakeEventLogEntry) {
+	el.lk.Lock()
+	defer el.lk.Unlock()
+
+	if el.closed {
+		return
+	}
+	if err := json.NewEncoder(&el.buf).Encode(e); err != nil {
+		logErr(err)
+		return
+	}
+	el.cond.Broadcast()
+}
+
+func (el *fakeEventLog) Read(p []byte) (int, error) {
+	el.lk.Lock()
+	defer el.lk.Unlock()
+
+	for el.buf.Len() == 0 && !el.closed {
+		el.cond.Wait()
+	}
+	if el.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return el.buf.Read(p)
+}
+
+func (el *fakeEventLog) Close() error {
+	el.lk.Lock()
+	defer el.lk.Unlock()
+
+	el.closed = true
+	el.cond.Broadcast()
+	return nil
+}
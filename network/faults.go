@@ -0,0 +1,158 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	logs "github.com/filecoin-project/filecoin-network-sim/logs"
+	events "github.com/filecoin-project/filecoin-network-sim/logs/events"
+)
+
+// NodeState is whether a node is up, or down because of an injected fault.
+type NodeState string
+
+const (
+	NodeUp      NodeState = "up"
+	NodeCrashed NodeState = "crashed"
+	NodeFrozen  NodeState = "frozen"
+
+	nodeRestarting NodeState = "restarting"
+)
+
+func (n *Node) State() NodeState {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return n.state
+}
+
+// setState moves the node from state from to state to, or returns an
+// error if it is not in state from.
+func (n *Node) setState(from, to NodeState) error {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	if n.state != from {
+		return fmt.Errorf("[NET]\t node %s is %s, not %s", n.ID, n.state, from)
+	}
+	n.state = to
+	return nil
+}
+
+// upNodes returns the nodes that are up.
+func upNodes(nodes []*Node) []*Node {
+	var up []*Node
+	for _, n := range nodes {
+		if n.State() == NodeUp {
+			up = append(up, n)
+		}
+	}
+	return up
+}
+
+// CrashNode kills a node abruptly, like kill -9. It stays in the network,
+// down, until RestartNode.
+func (n *Network) CrashNode(node *Node) error {
+	if err := node.setState(NodeUp, NodeCrashed); err != nil {
+		return err
+	}
+	if err := node.Kill(); err != nil {
+		node.setState(NodeCrashed, NodeUp)
+		return err
+	}
+
+	// its connections died with it.
+	n.dropEdges(node)
+
+	n.Events().WriteEvent(logs.NodeFaultEvent(node.WalletAddr, events.TypeNodeCrashed))
+	log.Printf("[NET]\t crashed node: %s Address: %s\n", node.ID, node.WalletAddr)
+	return nil
+}
+
+// RestartNode starts a crashed node again, from its repo, and connects it
+// to the network per the topology. It has to sync the chain it missed.
+func (n *Network) RestartNode(node *Node) error {
+	n.lk.Lock()
+	known := false
+	for _, nd := range n.nodes {
+		known = known || nd == node
+	}
+	n.lk.Unlock()
+	if !known {
+		return fmt.Errorf("[NET]\t node %s is not in the network", node.ID)
+	}
+
+	if err := node.setState(NodeCrashed, nodeRestarting); err != nil {
+		return err
+	}
+	if err := node.Restart(); err != nil {
+		node.setState(nodeRestarting, NodeCrashed)
+		return err
+	}
+
+	// it listens on new addresses, and logs to a new stream.
+	saddr, err := node.GetAddress()
+	if err != nil {
+		node.setState(nodeRestarting, NodeCrashed)
+		return err
+	}
+	node.lk.Lock()
+	node.SwarmAddr = saddr
+	node.sl = nil
+	node.lk.Unlock()
+	n.logs.MixReader(node.Logs().Reader())
+
+	node.setState(nodeRestarting, NodeUp)
+
+	restarted := logs.NodeFaultEvent(node.WalletAddr, events.TypeNodeRestarted)
+	restarted.CmdAddr = node.CmdAddr()
+	n.Events().WriteEvent(restarted)
+	log.Printf("[NET]\t restarted node: %s Address: %s\n", node.ID, node.WalletAddr)
+
+	n.lk.Lock()
+	var others []*Node
+	for _, nd := range upNodes(n.nodes) {
+		if nd != node {
+			others = append(others, nd)
+		}
+	}
+	edges := n.topology.Edges(n.rand, others, []*Node{node})
+	n.lk.Unlock()
+
+	ctx := context.Background()
+	for _, e := range edges {
+		if err := n.Connect(ctx, e.A, e.B); err != nil {
+			logErr(err)
+		}
+	}
+	return nil
+}
+
+// FreezeNode pauses a node, like SIGSTOP, so it hangs until ThawNode.
+func (n *Network) FreezeNode(node *Node) error {
+	if err := node.setState(NodeUp, NodeFrozen); err != nil {
+		return err
+	}
+	if err := node.Freeze(); err != nil {
+		node.setState(NodeFrozen, NodeUp)
+		return err
+	}
+
+	n.Events().WriteEvent(logs.NodeFaultEvent(node.WalletAddr, events.TypeNodeFrozen))
+	log.Printf("[NET]\t froze node: %s Address: %s\n", node.ID, node.WalletAddr)
+	return nil
+}
+
+func (n *Network) ThawNode(node *Node) error {
+	if err := node.setState(NodeFrozen, NodeUp); err != nil {
+		return err
+	}
+	if err := node.Thaw(); err != nil {
+		node.setState(NodeUp, NodeFrozen)
+		return err
+	}
+
+	n.Events().WriteEvent(logs.NodeFaultEvent(node.WalletAddr, events.TypeNodeThawed))
+	log.Printf("[NET]\t thawed node: %s Address: %s\n", node.ID, node.WalletAddr)
+	return nil
+}
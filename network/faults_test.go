@@ -0,0 +1,88 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkCrashRestart(t *testing.T) {
+	ctx := context.Background()
+	net := NewTestNetwork(t)
+	defer net.ShutdownAll()
+
+	types := ReadLogTypes(net.Logs().Reader())
+	require.NoError(t, net.AddNodes(MinerNodeType, 3))
+	nodes := net.GetNodesOfType(AnyNodeType)
+	down, up := nodes[0], nodes[1:]
+
+	require.NoError(t, net.CrashNode(down))
+	assert.Equal(t, NodeCrashed, down.State())
+	assert.Error(t, net.CrashNode(down))
+	assert.Error(t, net.FreezeNode(down))
+	assert.Error(t, down.MiningOnce(ctx))
+	for i := 0; i < 10; i++ {
+		assert.NotEqual(t, down, net.GetRandomNode(NewRand(int64(i)), AnyNodeType))
+	}
+
+	// the chain moves on without it.
+	require.NoError(t, up[0].MiningOnce(ctx))
+	require.NoError(t, up[0].MiningOnce(ctx))
+	assert.True(t, fakeHead(up[1]) > fakeHead(down))
+
+	// and it catches up once restarted.
+	require.NoError(t, net.RestartNode(down))
+	assert.Equal(t, NodeUp, down.State())
+	assert.Error(t, net.RestartNode(down))
+	assert.Equal(t, fakeHead(up[1]), fakeHead(down))
+	require.NoError(t, down.MiningOnce(ctx))
+
+	counts := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for !countsAtLeast(counts, map[string]int{"NodeCrashed": 1, "NodeRestarted": 1, "NewBlockMined": 3}) {
+		select {
+		case typ := <-types:
+			counts[typ]++
+		case <-timeout:
+			t.Fatalf("timed out waiting for logs. saw: %v", counts)
+		}
+	}
+}
+
+func TestNetworkFreezeThaw(t *testing.T) {
+	ctx := context.Background()
+	net := NewTestNetwork(t)
+	defer net.ShutdownAll()
+
+	types := ReadLogTypes(net.Logs().Reader())
+	require.NoError(t, net.AddNodes(MinerNodeType, 3))
+	nodes := net.GetNodesOfType(AnyNodeType)
+	frozen, up := nodes[0], nodes[1:]
+
+	assert.Error(t, net.ThawNode(frozen))
+	require.NoError(t, net.FreezeNode(frozen))
+	assert.Equal(t, NodeFrozen, frozen.State())
+	assert.Error(t, frozen.MiningOnce(ctx))
+
+	// it misses blocks while frozen.
+	require.NoError(t, up[0].MiningOnce(ctx))
+	assert.True(t, fakeHead(up[1]) > fakeHead(frozen))
+
+	require.NoError(t, net.ThawNode(frozen))
+	assert.Equal(t, NodeUp, frozen.State())
+	assert.Equal(t, fakeHead(up[1]), fakeHead(frozen))
+
+	counts := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for !countsAtLeast(counts, map[string]int{"NodeFrozen": 1, "NodeThawed": 1}) {
+		select {
+		case typ := <-types:
+			counts[typ]++
+		case <-timeout:
+			t.Fatalf("timed out waiting for logs. saw: %v", counts)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	linkproxy "github.com/filecoin-project/filecoin-network-sim/linkproxy"
+)
+
+// AddrDialer is a backend that can connect to a peer through another
+// address, like a link proxy in front of the peer's swarm address.
+type AddrDialer interface {
+	ConnectAddr(ctx context.Context, swarmAddr string) error
+}
+
+// SetLinks puts a link proxy, configured by conf, between every two nodes
+// the network connects from now on. Nodes are placed in conf's regions
+// when they first connect. Only backends that are AddrDialers use links.
+func (n *Network) SetLinks(conf *linkproxy.Config) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.links = conf
+}
+
+// Region returns the region a node is in, if the network has links.
+func (n *Network) Region(node *Node) string {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return n.region(node)
+}
+
+// region should be called with the lock held.
+func (n *Network) region(node *Node) string {
+	if n.links == nil {
+		return ""
+	}
+
+	r, ok := n.regions[node]
+	if !ok {
+		r = n.links.PickRegion(n.rand)
+		n.regions[node] = r
+		if r != "" {
+			log.Printf("[NET]\t node %s is in region %s\n", node.ID, r)
+		}
+	}
+	return r
+}
+
+// dial connects a to b, through a link proxy if the network has links.
+func (n *Network) dial(ctx context.Context, a, b *Node) error {
+	n.lk.Lock()
+	conf := n.links
+	d, ok := a.NodeBackend.(AddrDialer)
+	if conf == nil || !ok {
+		n.lk.Unlock()
+		return a.Connect(ctx, b.NodeBackend)
+	}
+	link := conf.Link(n.region(a), n.region(b))
+	seed := n.rand.Int63()
+	n.lk.Unlock()
+
+	swarmAddr := b.GetSwarmAddr()
+	target, err := swarmTarget(swarmAddr)
+	if err != nil {
+		return err
+	}
+
+	p, err := linkproxy.Listen(target, link, seed)
+	if err != nil {
+		return err
+	}
+
+	if err := d.ConnectAddr(ctx, proxiedAddr(swarmAddr, p.Addr())); err != nil {
+		p.Close()
+		return err
+	}
+
+	n.lk.Lock()
+	old := n.proxies[edgeKey(a, b)]
+	n.proxies[edgeKey(a, b)] = p
+	n.lk.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	log.Printf("[NET]\t linked %s and %s: %s\n", a.ID, b.ID, link)
+	return nil
+}
+
+// closeProxy closes the link proxy of an edge, if it has one. This cuts
+// the connection. should be called with the lock held.
+func (n *Network) closeProxy(e Edge) {
+	if p, ok := n.proxies[e]; ok {
+		p.Close()
+		delete(n.proxies, e)
+	}
+}
+
+// swarmTarget returns the host:port of a swarm address, like
+// /ip4/127.0.0.1/tcp/6000/ipfs/QmID.
+func swarmTarget(swarmAddr string) (string, error) {
+	parts := strings.Split(swarmAddr, "/")
+	var host, port string
+	for i := 1; i+1 < len(parts); i += 2 {
+		switch parts[i] {
+		case "ip4", "ip6":
+			host = parts[i+1]
+		case "tcp":
+			port = parts[i+1]
+		}
+	}
+	if host == "" || port == "" {
+		return "", fmt.Errorf("[NET]\t not a tcp swarm address: %s", swarmAddr)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// proxiedAddr returns swarmAddr, with its ip and port replaced by the
+// proxy's.
+func proxiedAddr(swarmAddr string, proxy *net.TCPAddr) string {
+	parts := strings.Split(swarmAddr, "/")
+	for i := 1; i+1 < len(parts); i += 2 {
+		switch parts[i] {
+		case "ip4", "ip6":
+			parts[i], parts[i+1] = "ip4", proxy.IP.String()
+		case "tcp":
+			parts[i+1] = strconv.Itoa(proxy.Port)
+		}
+	}
+	return strings.Join(parts, "/")
+}
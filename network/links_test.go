@@ -0,0 +1,64 @@
+package network
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	linkproxy "github.com/filecoin-project/filecoin-network-sim/linkproxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwarmAddrs(t *testing.T) {
+	addr := "/ip4/127.0.0.1/tcp/6000/ipfs/QmFakeNode0"
+
+	target, err := swarmTarget(addr)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:6000", target)
+
+	_, err = swarmTarget("/ipfs/QmFakeNode0")
+	assert.Error(t, err)
+
+	proxy := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 41234}
+	assert.Equal(t, "/ip4/127.0.0.1/tcp/41234/ipfs/QmFakeNode0", proxiedAddr(addr, proxy))
+}
+
+// dialerBackend is a fake node that records the addresses it dials.
+type dialerBackend struct {
+	NodeBackend
+	dialed *[]string
+}
+
+func (b *dialerBackend) ConnectAddr(ctx context.Context, swarmAddr string) error {
+	*b.dialed = append(*b.dialed, swarmAddr)
+	return nil
+}
+
+func TestNetworkLinks(t *testing.T) {
+	var dialed []string
+	chain := NewFakeChain()
+	net := NewNetworkWithBackend(TempDir(t), func(repoDir string) (NodeBackend, error) {
+		b, err := chain.NewBackend(repoDir)
+		return &dialerBackend{b, &dialed}, err
+	})
+	defer net.ShutdownAll()
+	ReadLogTypes(net.Logs().Reader())
+
+	net.SetLinks(&linkproxy.Config{
+		Default: linkproxy.Link{Latency: time.Millisecond},
+		Regions: []linkproxy.Region{{Name: "us"}},
+	})
+	require.NoError(t, net.AddNodes(MinerNodeType, 2))
+	nodes := net.GetNodesOfType(AnyNodeType)
+
+	// the second node dialed the first through a proxy.
+	require.Len(t, dialed, 1)
+	assert.NotEqual(t, nodes[0].SwarmAddr, dialed[0])
+	assert.Len(t, net.proxies, 1)
+	assert.Equal(t, "us", net.Region(nodes[0]))
+
+	require.NoError(t, net.RemoveNode(nodes[0].ID))
+	assert.Len(t, net.proxies, 0)
+}
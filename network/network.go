@@ -1,16 +1,20 @@
 package network
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"text/template"
+	"time"
 
+	linkproxy "github.com/filecoin-project/filecoin-network-sim/linkproxy"
 	logs "github.com/filecoin-project/filecoin-network-sim/logs"
-	daemon "github.com/filecoin-project/go-filecoin/testhelpers"
+	metrics "github.com/filecoin-project/filecoin-network-sim/metrics"
 )
 
 type NodeType string
@@ -46,8 +50,20 @@ func init() {
 	}
 }
 
-func RandomNodeType() NodeType {
-	switch rand.Intn(2) {
+// ParseNodeType parses a node type by name. An empty name is AnyNodeType.
+func ParseNodeType(t string) (NodeType, error) {
+	switch NodeType(t) {
+	case MinerNodeType, ClientNodeType, AnyNodeType:
+		return NodeType(t), nil
+	case "":
+		return AnyNodeType, nil
+	default:
+		return "", fmt.Errorf("unknown node type: %q", t)
+	}
+}
+
+func RandomNodeType(rng *rand.Rand) NodeType {
+	switch rng.Intn(2) {
 	case 1:
 		return MinerNodeType
 	default:
@@ -55,48 +71,54 @@ func RandomNodeType() NodeType {
 	}
 }
 
-// daemon + cached info
+// backend + cached info
 type Node struct {
-	*daemon.Daemon
+	NodeBackend
 
 	Type       NodeType
 	ID         string
 	WalletAddr string // ClientAddr
 	MinerAddr  string
 	SwarmAddr  string
-	sl         *logs.SimLogger
-}
 
-func NewNode(d *daemon.Daemon, id string, t NodeType) (*Node, error) {
-	if t == AnyNodeType {
-		t = RandomNodeType()
-	}
+	lk    sync.Mutex // guards sl and MinerAddr, which are set lazily, SwarmAddr, and state
+	mlk   sync.Mutex // held while creating the miner, instead of lk
+	sl    *logs.SimLogger
+	state NodeState
+}
 
-	addr, err := d.GetMainWalletAddress()
+// NewNode wraps a started backend. t should be a concrete type,
+// not AnyNodeType.
+func NewNode(b NodeBackend, id string, t NodeType) (*Node, error) {
+	addr, err := b.GetMainWalletAddress()
 	if err != nil {
 		return nil, err
 	}
 
-	saddr, err := d.GetAddress()
+	saddr, err := b.GetAddress()
 	if err != nil {
 		return nil, err
 	}
 
 	n := &Node{
-		Daemon:     d,
-		ID:         id,
-		Type:       t,
-		WalletAddr: addr,
-		MinerAddr:  "",
-		SwarmAddr:  saddr,
+		NodeBackend: b,
+		ID:          id,
+		Type:        t,
+		WalletAddr:  addr,
+		MinerAddr:   "",
+		SwarmAddr:   saddr,
+		state:       NodeUp,
 	}
 
 	return n, nil
 }
 
 func (n *Node) Logs() *logs.SimLogger {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
 	if n.sl == nil {
-		r := n.Daemon.EventLogStream()
+		r := n.NodeBackend.EventLogStream()
 		n.sl = logs.NewSimLogger(n.ID, r)
 	}
 	return n.sl
@@ -106,40 +128,134 @@ func (n *Node) HasMinerIdentity() bool {
 	return n.MinerAddr == ""
 }
 
-func (n *Node) CreateOrGetMinerIdentity() (string, error) {
-	if n.MinerAddr == "" {
-		a, err := n.CreateMinerAddr(true)
-		if err != nil {
-			return "", err
-		}
-		n.MinerAddr = a.String()
+func (n *Node) CreateOrGetMinerIdentity(ctx context.Context) (string, error) {
+	n.mlk.Lock()
+	defer n.mlk.Unlock()
+
+	if a := n.GetMinerIdentity(); a != "" {
+		return a, nil
+	}
+	a, err := n.CreateMinerAddr(ctx)
+	if err != nil {
+		return "", err
 	}
-	return n.MinerAddr, nil
+
+	n.lk.Lock()
+	n.MinerAddr = a
+	n.lk.Unlock()
+	return a, nil
 }
 
 func (n *Node) GetMinerIdentity() string {
+	n.lk.Lock()
+	defer n.lk.Unlock()
 	return n.MinerAddr
 }
 
+// GetSwarmAddr returns the address the node listens on, which changes when
+// it restarts.
+func (n *Node) GetSwarmAddr() string {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return n.SwarmAddr
+}
+
 func (n *Node) MatchesType(t NodeType) bool {
 	return t == AnyNodeType || n.Type == t
 }
 
 type Network struct {
-	lk      sync.RWMutex
-	nodes   []*Node
-	repoNum int
-	repoDir string
-	logs    *logs.LineAggregator
+	lk         sync.RWMutex
+	nodes      []*Node
+	repoNum    int
+	repoDir    string
+	logs       *logs.LineAggregator
+	newBackend NewBackendFunc
+	rand       *rand.Rand // picks types for AnyNodeType, and edges
+	deals      []*Deal    // accepted deal proposals
+	topology   Topology
+
+	edges  map[Edge]bool // formed by Connect, keyed by edgeKey
+	cut    []Edge        // edges cut by Partition, until Heal
+	groups map[*Node]int // partition group of each node, while partitioned
+	sl     *logs.SimLogger
+
+	links   *linkproxy.Config // nil means nodes connect directly
+	regions map[*Node]string
+	proxies map[Edge]*linkproxy.Proxy
+
+	timeouts  Timeouts
+	timedOut  map[Op]uint64 // how many interactions timed out
+	latencies map[Op]*metrics.Histogram
+
+	spawnParallelism int // how many nodes to start or stop at once
 }
 
+// NewNetwork returns a network of go-filecoin daemons.
 func NewNetwork(repoDir string) (*Network, error) {
-	la := logs.NewLineAggregator()
-
-	if _, err := daemon.GetFilecoinBinary(); err != nil {
+	if err := CheckDaemonBinary(); err != nil {
 		return nil, err
 	}
-	return &Network{repoDir: repoDir, logs: la}, nil
+	return NewNetworkWithBackend(repoDir, NewDaemonBackend), nil
+}
+
+// NewNetworkWithBackend returns a network whose nodes are created by nb.
+func NewNetworkWithBackend(repoDir string, nb NewBackendFunc) *Network {
+	la := logs.NewLineAggregator()
+	rng := NewRand(time.Now().UnixNano())
+	return &Network{
+		repoDir:    repoDir,
+		logs:       la,
+		newBackend: nb,
+		rand:       rng,
+		topology:   Mesh{},
+		edges:      make(map[Edge]bool),
+		regions:    make(map[*Node]string),
+		proxies:    make(map[Edge]*linkproxy.Proxy),
+		timeouts:   DefaultTimeouts(),
+		timedOut:   make(map[Op]uint64),
+		latencies:  make(map[Op]*metrics.Histogram),
+
+		spawnParallelism: DefaultSpawnParallelism,
+	}
+}
+
+// SetTopology sets how nodes connect when they join. The default is Mesh.
+func (n *Network) SetTopology(t Topology) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.topology = t
+}
+
+// SetSeed seeds the network's own random choices: the types of nodes
+// that join as AnyNodeType, the edges topologies pick, and link regions.
+// Until then they are seeded from the clock.
+func (n *Network) SetSeed(seed int64) {
+	n.rand.Seed(seed)
+}
+
+func (n *Network) Topology() Topology {
+	n.lk.RLock()
+	defer n.lk.RUnlock()
+	return n.topology
+}
+
+// DefaultSpawnParallelism is how many nodes a network starts at once, by
+// default. Starting a daemon is expensive.
+const DefaultSpawnParallelism = 8
+
+// SetSpawnParallelism sets how many nodes to start, or shut down, at once.
+// 0 means all of them.
+func (n *Network) SetSpawnParallelism(p int) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.spawnParallelism = p
+}
+
+func (n *Network) SpawnParallelism() int {
+	n.lk.RLock()
+	defer n.lk.RUnlock()
+	return n.spawnParallelism
 }
 
 func (n *Network) Size() int {
@@ -154,127 +270,216 @@ func (n *Network) Logs() *logs.LineAggregator {
 
 func (n *Network) tryCreatingNode(t NodeType) (*Node, error) {
 	n.lk.Lock()
+	if t == AnyNodeType {
+		t = RandomNodeType(n.rand)
+	}
 	repoNum := n.repoNum
 	n.repoNum++
 	n.lk.Unlock() // unlock to be able to set up the node w/o holding lock.
 
-	d, err := daemon.NewDaemon(
-		daemon.RepoDir(filepath.Join(n.repoDir, fmt.Sprintf("node%d", repoNum))),
-		daemon.ShouldInit(true),
-		daemon.InsecureApi(),
-		daemon.ShouldStartMining(false),
-	)
-
+	repo := fmt.Sprintf("node%d", repoNum)
+	b, err := n.newBackend(filepath.Join(n.repoDir, repo))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %s", repo, err)
 	}
 
-	if _, err := d.Start(); err != nil {
-		d.Shutdown()
-		return nil, err
+	if err := b.Start(); err != nil {
+		b.Shutdown()
+		return nil, fmt.Errorf("%s: starting: %s", repo, err)
 	}
 
-	id, err := d.GetID()
+	id, err := b.GetID()
 	if err != nil {
-		d.Shutdown()
-		return nil, err
+		b.Shutdown()
+		return nil, fmt.Errorf("%s: %s", repo, err)
 	}
 
-	node, err := NewNode(d, id, t)
+	node, err := NewNode(b, id, t)
 	if err != nil {
-		d.Shutdown()
-		return nil, err
+		b.Shutdown()
+		return nil, fmt.Errorf("%s: %s", repo, err)
 	}
 
 	return node, nil
 }
 
+// AddNode adds a node, and connects it to the network, per the topology.
 func (n *Network) AddNode(t NodeType) (*Node, error) {
-	node, err := n.tryCreatingNode(t)
+	nodes, err := n.addNodes([]NodeType{t})
 	if err != nil {
-		return nil, err
+		return nil, err.(MultiErr)[0].Err
 	}
-	// ok from here, we have a node, and it should work out.
+	return nodes[0], nil
+}
 
-	// connect to other miners?
-	n.ConnectNodeToAll(node)
+// AddNodes adds num nodes, which join the network together. If some fail,
+// the others still join, and the error is a MultiErr of the failures.
+func (n *Network) AddNodes(t NodeType, num int) error {
+	types := make([]NodeType, num)
+	for i := range types {
+		types[i] = t
+	}
 
-	// frrist: we want realistic sim. lots of actions gated by 1-at-atime consesnus
-	node.Daemon.SetWaitMining(false)
+	if _, err := n.addNodes(types); err != nil {
+		return fmt.Errorf("[NET]\t adding %d/%d nodes failed: %w", len(err.(MultiErr)), num, err)
+	}
+	return nil
+}
+
+// addNodes starts a node of each type, at most SpawnParallelism at a
+// time, and adds them to the network together, so the topology can
+// connect them as a group. It returns the nodes that were added, and a
+// MultiErr of those that failed, indexed like types.
+func (n *Network) addNodes(types []NodeType) ([]*Node, error) {
+	started := make([]*Node, len(types))
+	err := AsyncErrs(len(types), n.SpawnParallelism(), func(i int) error {
+		var err error
+		started[i], err = n.tryCreatingNode(types[i])
+		return err
+	})
 
-	// add miner to our list.
+	var errs MultiErr
+	if err != nil {
+		errs = err.(MultiErr)
+	}
+
+	var joining []*Node
+	index := make(map[*Node]int)
+	for i, node := range started {
+		if node != nil {
+			joining = append(joining, node)
+			index[node] = i
+		}
+	}
+
+	// add them to our list, and pick their edges.
 	n.lk.Lock()
-	n.nodes = append(n.nodes, node)
+	existing := upNodes(n.nodes)
+	n.nodes = append(n.nodes, joining...)
+	edges := n.topology.Edges(n.rand, existing, joining)
 	n.lk.Unlock()
 
-	n.logs.MixReader(node.Logs().Reader())
+	// announce them to logs, before their connections.
+	for _, node := range joining {
+		n.logs.MixReader(node.Logs().Reader())
 
-	// announce the miner to logs
-	eventMap := logs.NetworkChurnEvent(node.WalletAddr, string(node.Type), true)
-	eventMap["cmdAddr"] = node.CmdAddr
+		churn := logs.NetworkChurnEvent(node.WalletAddr, string(node.Type), true)
+		churn.CmdAddr = node.CmdAddr()
+		node.Logs().WriteEvent(churn)
+	}
 
-	node.Logs().WriteEvent(eventMap)
+	ctx := context.Background()
+	for _, e := range edges {
+		if err := n.Connect(ctx, e.A, e.B); err != nil {
+			logErr(err)
+		}
+	}
 
+	// set them up in parallel, like they started.
+	err = AsyncErrs(len(joining), n.SpawnParallelism(), func(i int) error {
+		return n.setupNode(ctx, joining[i])
+	})
+	if err != nil {
+		for _, e := range err.(MultiErr) {
+			node := joining[e.Index]
+			errs = append(errs, IndexedErr{index[node], fmt.Errorf("%s: %s", node.ID, e.Err)})
+		}
+	}
+
+	if len(errs) == 0 {
+		return joining, nil
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Index < errs[j].Index })
+	return joining, errs
+}
+
+// setupNode gives a new node some funds, and a miner identity if it is a
+// miner.
+func (n *Network) setupNode(ctx context.Context, node *Node) error {
 	// need some $ ...
-	if err := node.MiningOnce(); err != nil {
-		return nil, err
+	if err := n.MineOnce(ctx, node); err != nil {
+		return err
 	}
 	if node.Type == MinerNodeType {
-		node.CreateOrGetMinerIdentity() // sets n.MinerAddr
+		n.MinerIdentity(ctx, node) // sets n.MinerAddr
 	}
 
 	tmplNodeAdded.Execute(os.Stdout, tmplNodeAddedData{
 		WalletAddr: node.WalletAddr,
-		MinerAddr:  node.MinerAddr,
-		SwarmAddr:  node.SwarmAddr,
-		ApiAddr:    node.Daemon.CmdAddr,
-		RepoDir:    node.RepoDir,
+		MinerAddr:  node.GetMinerIdentity(),
+		SwarmAddr:  node.GetSwarmAddr(),
+		ApiAddr:    node.CmdAddr(),
+		RepoDir:    node.RepoDir(),
 		Type:       node.Type,
 	})
 
 	log.Printf("[NET]\t added a new node to the network: %s Address: %s\n", node.ID, node.WalletAddr)
-	return node, nil
+	return nil
 }
 
-func (n *Network) AddNodes(t NodeType, num int) error {
-	errs := AsyncErrs(num, func(i int) error {
-		_, err := n.AddNode(t)
-		return err
-	})
+// RemoveNode shuts down the node with the given id, and removes it from
+// the network. Its logs are detached from the aggregator, after
+// announcing that it left.
+func (n *Network) RemoveNode(id string) error {
+	n.lk.Lock()
+	var node *Node
+	for i, nd := range n.nodes {
+		if nd.ID == id {
+			node = nd
+			n.nodes = append(n.nodes[:i], n.nodes[i+1:]...)
+			break
+		}
+	}
+	n.lk.Unlock()
 
-	if len(errs) > 0 {
-		return fmt.Errorf("[NET]\t adding %d/%d failed\n", len(errs), num)
+	if node == nil {
+		return fmt.Errorf("[NET]\t no node with id: %s", id)
 	}
-	return nil
+	n.forgetNode(node)
+
+	// announce the departure, while the logs are still attached.
+	node.Logs().WriteEvent(logs.NetworkChurnEvent(node.WalletAddr, string(node.Type), false))
+
+	err := node.Shutdown()
+	node.Logs().Close() // ends its reader in the aggregator.
+
+	log.Printf("[NET]\t removed a node from the network: %s Address: %s\n", node.ID, node.WalletAddr)
+	return err
 }
 
-func (n *Network) ConnectNodeToAll(node *Node) error {
+// Connect connects two nodes, and announces the edge to logs. Nodes on
+// different sides of a partition cannot connect, until Heal connects
+// them.
+func (n *Network) Connect(ctx context.Context, a, b *Node) error {
 	n.lk.Lock()
-	conn := make([]*Node, len(n.nodes))
-	for i, n2 := range n.nodes {
-		if n2 != node {
-			conn[i] = n2
-		}
+	if n.partitioned(a, b) {
+		n.cutEdge(edgeKey(a, b))
+		n.lk.Unlock()
+		return fmt.Errorf("[NET]\t %s and %s are partitioned", a.ID, b.ID)
 	}
 	n.lk.Unlock()
 
-	failed := 0
-	for _, n2 := range conn {
-		if n2 == nil {
-			continue // one of them will be nil
-		}
-
-		_, err := node.Connect(n2.Daemon)
-		if err != nil {
-			logErr(err)
-			failed++
-			return err
-		}
+	err := n.do(ctx, OpConnect, a, func(ctx context.Context) error {
+		return n.dial(ctx, a, b)
+	})
+	if err != nil {
+		return err
 	}
 
-	if failed > 0 {
-		return fmt.Errorf("[NET]\t failed to connect %d/%d\n", failed, len(conn))
+	// a partition may have come while dialing.
+	n.lk.Lock()
+	if n.partitioned(a, b) {
+		n.cutEdge(edgeKey(a, b))
+		n.lk.Unlock()
+		logErr(n.do(ctx, OpConnect, a, func(ctx context.Context) error {
+			return a.Disconnect(ctx, b.NodeBackend)
+		}))
+		return fmt.Errorf("[NET]\t %s and %s are partitioned", a.ID, b.ID)
 	}
+	n.edges[edgeKey(a, b)] = true
+	n.lk.Unlock()
+
+	a.Logs().WriteEvent(logs.ConnectedEvent(a.WalletAddr, b.WalletAddr))
 	return nil
 }
 
@@ -326,19 +531,21 @@ func (n *Network) GetNodeCounts() map[NodeType]int {
 	return m
 }
 
-func (n *Network) GetRandomNode(t NodeType) *Node {
-	nodes := n.GetNodesOfType(t)
+// GetRandomNode returns a random node of type t that is up.
+func (n *Network) GetRandomNode(rng *rand.Rand, t NodeType) *Node {
+	nodes := upNodes(n.GetNodesOfType(t))
 
 	l := len(nodes)
 	if l == 0 {
 		return nil
 	}
 
-	return nodes[rand.Intn(l)]
+	return nodes[rng.Intn(l)]
 }
 
-func (n *Network) GetRandomNodes(t NodeType, num int) []*Node {
-	nodes := n.GetNodesOfType(t)
+// GetRandomNodes returns up to num random nodes of type t that are up.
+func (n *Network) GetRandomNodes(rng *rand.Rand, t NodeType, num int) []*Node {
+	nodes := upNodes(n.GetNodesOfType(t))
 	if len(nodes) == 0 {
 		return nil
 	}
@@ -347,7 +554,7 @@ func (n *Network) GetRandomNodes(t NodeType, num int) []*Node {
 	}
 
 	// shuffle first, then output.
-	rand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+	rng.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
 	return nodes[:num]
 }
 
@@ -355,13 +562,18 @@ func (n *Network) ShutdownAll() error {
 	n.lk.Lock()
 	defer n.lk.Unlock()
 
-	errs := AsyncErrs(len(n.nodes), func(i int) error {
-		return n.nodes[i].Shutdown()
+	err := AsyncErrs(len(n.nodes), n.spawnParallelism, func(i int) error {
+		if err := n.nodes[i].Shutdown(); err != nil {
+			return fmt.Errorf("%s: %s", n.nodes[i].ID, err)
+		}
+		return nil
 	})
+	for e := range n.proxies {
+		n.closeProxy(e)
+	}
 
-	var err error
-	if len(errs) > 0 {
-		err = fmt.Errorf("[NET]\t shutting down %d/%d failed\n", len(errs), len(n.nodes))
+	if err != nil {
+		return fmt.Errorf("[NET]\t shutting down %d/%d nodes failed: %w", len(err.(MultiErr)), len(n.nodes), err)
 	}
-	return err
+	return nil
 }
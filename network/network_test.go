@@ -1,12 +1,14 @@
 package network
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,10 +20,16 @@ func TempDir(t *testing.T) string {
 	return dir
 }
 
+// NewTestNetwork returns a network of fake nodes, so tests run without
+// go-filecoin binaries.
+func NewTestNetwork(t *testing.T) *Network {
+	return NewNetworkWithBackend(TempDir(t), NewFakeChain().NewBackend)
+}
+
 func TestNetworkAddNode(t *testing.T) {
-	net, err := NewNetwork(TempDir(t))
-	assert.NoError(t, err)
+	net := NewTestNetwork(t)
 	defer net.ShutdownAll()
+	go io.Copy(ioutil.Discard, net.Logs().Reader())
 
 	n1, err := net.AddNode(AnyNodeType)
 	assert.NoError(t, err)
@@ -38,21 +46,74 @@ func TestNetworkAddNode(t *testing.T) {
 }
 
 func TestNetworkAddNodes(t *testing.T) {
-	net, err := NewNetwork(TempDir(t))
-	assert.NoError(t, err)
+	net := NewTestNetwork(t)
 	defer net.ShutdownAll()
+	go io.Copy(ioutil.Discard, net.Logs().Reader())
 
-	err = net.AddNodes(AnyNodeType, 10)
+	err := net.AddNodes(AnyNodeType, 10)
 	assert.NoError(t, err)
 }
 
+func TestNetworkAddNodesFailures(t *testing.T) {
+	chain := NewFakeChain()
+	net := NewNetworkWithBackend(TempDir(t), func(repoDir string) (NodeBackend, error) {
+		if base := filepath.Base(repoDir); base == "node1" || base == "node3" {
+			return nil, fmt.Errorf("no room for %s", base)
+		}
+		return chain.NewBackend(repoDir)
+	})
+	defer net.ShutdownAll()
+	ReadLogTypes(net.Logs().Reader())
+
+	net.SetSpawnParallelism(1) // repos in order.
+	err := net.AddNodes(AnyNodeType, 5)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "adding 2/5 nodes failed")
+	assert.Contains(t, err.Error(), "[1] node1: no room for node1; [3] node3: no room for node3")
+	assert.Equal(t, 3, net.Size())
+}
+
+func TestNetworkRemoveNode(t *testing.T) {
+	require := require.New(t)
+
+	net := NewTestNetwork(t)
+	defer net.ShutdownAll()
+
+	types := ReadLogTypes(net.Logs().Reader())
+
+	n1, err := net.AddNode(MinerNodeType)
+	require.NoError(err)
+	n2, err := net.AddNode(ClientNodeType)
+	require.NoError(err)
+
+	require.NoError(net.RemoveNode(n2.ID))
+	require.Error(net.RemoveNode(n2.ID))
+
+	require.Equal(1, net.Size())
+	require.True(n1 == net.GetNode(0))
+	require.Nil(net.GetNodeByID(n2.ID))
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case typ := <-types:
+			if typ == "ClientLeaves" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for ClientLeaves")
+		}
+	}
+}
+
 func TestNetworkConnectNodes(t *testing.T) {
+	ctx := context.Background()
 	assert := assert.New(t)
 	require := require.New(t)
 
-	net, err := NewNetwork(TempDir(t))
-	require.NoError(err)
+	net := NewTestNetwork(t)
 	defer net.ShutdownAll()
+	go io.Copy(ioutil.Discard, net.Logs().Reader())
 
 	n1, err := net.AddNode(AnyNodeType)
 	require.NoError(err)
@@ -67,24 +128,23 @@ func TestNetworkConnectNodes(t *testing.T) {
 	require.True(n2 == net.GetNode(1))
 	require.True(n3 == net.GetNode(2))
 
-	_, err = n1.Connect(n2.Daemon)
+	err = n1.Connect(ctx, n2.NodeBackend)
 	assert.NoError(err)
 
-	_, err = n1.Connect(n3.Daemon)
+	err = n1.Connect(ctx, n3.NodeBackend)
 	assert.NoError(err)
 
-	_, err = n2.Connect(n3.Daemon)
+	err = n2.Connect(ctx, n3.NodeBackend)
 	assert.NoError(err)
 }
 
 func TestLogging(t *testing.T) {
+	ctx := context.Background()
 	// create a temp network
-	net, err := NewNetwork(TempDir(t))
-	assert.NoError(t, err)
+	net := NewTestNetwork(t)
 	defer net.ShutdownAll()
 
-	buf := bytes.NewBuffer(nil)
-	go io.Copy(buf, net.Logs().Reader())
+	types := ReadLogTypes(net.Logs().Reader())
 
 	// Add the nodes to the network
 	n1, err := net.AddNode(MinerNodeType)
@@ -95,46 +155,61 @@ func TestLogging(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Connect all Nodes
-	_, err = n1.Connect(n3.Daemon)
+	err = net.Connect(ctx, n1, n3)
 	assert.NoError(t, err)
-	_, err = n1.Connect(n2.Daemon)
+	err = net.Connect(ctx, n1, n2)
 	assert.NoError(t, err)
-	_, err = n2.Connect(n3.Daemon)
+	err = net.Connect(ctx, n2, n3)
 	assert.NoError(t, err)
 
 	// every node mines a block
-	assert.NoError(t, n1.Daemon.MiningOnce())
-	//assert.NoError(t, n2.Daemon.MiningOnce())
-	//assert.NoError(t, n3.Daemon.MiningOnce())
-
-	// check logs
-
-	check := []map[string]string{
-		{"type": "MinerJoins"},
-		{"type": "MinerJoins"},
-		{"type": "MinerJoins"},
-		{"type": "Connected"},
-		{"type": "Connected"},
-		{"type": "Connected"},
-		{"type": "NewBlockMined"},
-		{"type": "BroadcastBlock"},
-		/*
-			{"type": "NewBlockMined"},
-			{"type": "BroadcastBlock"},
-			{"type": "NewBlockMined"},
-			{"type": "BroadcastBlock"},
-		*/
+	assert.NoError(t, n1.MiningOnce(ctx))
+	//assert.NoError(t, n2.MiningOnce(ctx))
+	//assert.NoError(t, n3.MiningOnce(ctx))
+
+	// check logs. interleaving across nodes is arbitrary, so only count.
+	check := map[string]int{
+		"MinerJoins":     3,
+		"Connected":      3,
+		"NewBlockMined":  1,
+		"BroadcastBlock": 1,
 	}
 
-	d := json.NewDecoder(buf)
-	for _, m1 := range check {
-		var m2 map[string]interface{}
-		assert.NoError(t, d.Decode(&m2))
+	counts := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for !countsAtLeast(counts, check) {
+		select {
+		case typ := <-types:
+			counts[typ]++
+		case <-timeout:
+			t.Fatalf("timed out waiting for logs. saw: %v", counts)
+		}
+	}
+}
+
+// ReadLogTypes decodes sim events from r, and sends their types on the
+// returned channel.
+func ReadLogTypes(r io.Reader) <-chan string {
+	types := make(chan string, 1024)
+	go func() {
+		d := json.NewDecoder(r)
+		for {
+			var m map[string]interface{}
+			if err := d.Decode(&m); err != nil {
+				return
+			}
+			typ, _ := m["type"].(string)
+			types <- typ
+		}
+	}()
+	return types
+}
 
-		for k, _ := range m1 {
-			//assert.Equal(t, v, m2[k])
-			fmt.Printf("%#v", m2[k])
+func countsAtLeast(counts, min map[string]int) bool {
+	for k, v := range min {
+		if counts[k] < v {
+			return false
 		}
-		//t.Log(m2)
 	}
+	return true
 }
@@ -0,0 +1,178 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	logs "github.com/filecoin-project/filecoin-network-sim/logs"
+)
+
+// NetworkLoggerID is the "from" of sim events about the whole network.
+const NetworkLoggerID = "network"
+
+// edgeKey returns the edge between a and b, in a fixed order, so it can
+// be a map key.
+func edgeKey(a, b *Node) Edge {
+	if a.ID > b.ID {
+		a, b = b, a
+	}
+	return Edge{a, b}
+}
+
+// Partition splits the network into groups, by disconnecting the edges
+// between nodes in different groups. Nodes in no group, including nodes
+// that join while partitioned, are together in one more group. Until
+// Heal, nodes in different groups cannot connect.
+func (n *Network) Partition(groups [][]*Node) error {
+	n.lk.Lock()
+	if n.groups != nil {
+		n.lk.Unlock()
+		return fmt.Errorf("[NET]\t already partitioned")
+	}
+
+	n.groups = make(map[*Node]int)
+	for i, g := range groups {
+		for _, node := range g {
+			n.groups[node] = i + 1 // 0 is the group of nodes in no group.
+		}
+	}
+
+	for e := range n.edges {
+		if n.partitioned(e.A, e.B) {
+			delete(n.edges, e)
+			n.closeProxy(e)
+			n.cutEdge(e)
+		}
+	}
+	// a copy: dropEdges changes n.cut in place, when nodes go.
+	cut := append([]Edge(nil), n.cut...)
+	n.lk.Unlock()
+
+	ctx := context.Background()
+	failed := 0
+	for _, e := range cut {
+		err := n.do(ctx, OpConnect, e.A, func(ctx context.Context) error {
+			return e.A.Disconnect(ctx, e.B.NodeBackend)
+		})
+		if err != nil {
+			logErr(err)
+			failed++
+		}
+	}
+
+	addrs := make([][]string, len(groups))
+	for i, g := range groups {
+		addrs[i] = make([]string, len(g))
+		for j, node := range g {
+			addrs[i][j] = node.WalletAddr
+		}
+	}
+	n.Events().WriteEvent(logs.PartitionedEvent(NetworkLoggerID, addrs))
+	log.Printf("[NET]\t partitioned the network into %d groups, cutting %d edges\n", len(groups), len(cut))
+
+	if failed > 0 {
+		return fmt.Errorf("[NET]\t failed to disconnect %d/%d\n", failed, len(cut))
+	}
+	return nil
+}
+
+// cutEdge keeps e for Heal to connect. should be called with the lock
+// held.
+func (n *Network) cutEdge(e Edge) {
+	for _, c := range n.cut {
+		if c == e {
+			return
+		}
+	}
+	n.cut = append(n.cut, e)
+}
+
+// Heal reconnects the edges cut by Partition, and connects those it kept
+// from forming, between nodes still in the network.
+func (n *Network) Heal() error {
+	n.lk.Lock()
+	if n.groups == nil {
+		n.lk.Unlock()
+		return fmt.Errorf("[NET]\t not partitioned")
+	}
+	cut := n.cut
+	n.cut = nil
+	n.groups = nil
+	n.lk.Unlock()
+
+	ctx := context.Background()
+	failed := 0
+	for _, e := range cut {
+		if err := n.Connect(ctx, e.A, e.B); err != nil {
+			logErr(err)
+			failed++
+		}
+	}
+
+	n.Events().WriteEvent(logs.HealedEvent(NetworkLoggerID))
+	log.Printf("[NET]\t healed the network, reconnecting %d edges\n", len(cut))
+
+	if failed > 0 {
+		return fmt.Errorf("[NET]\t failed to reconnect %d/%d\n", failed, len(cut))
+	}
+	return nil
+}
+
+// Partitioned returns whether the network is partitioned.
+func (n *Network) Partitioned() bool {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return n.groups != nil
+}
+
+// partitioned returns whether a and b are on different sides of a
+// partition. should be called with the lock held.
+func (n *Network) partitioned(a, b *Node) bool {
+	return n.groups != nil && n.groups[a] != n.groups[b]
+}
+
+// forgetNode drops the edges, partition group and region of a node that
+// left.
+func (n *Network) forgetNode(node *Node) {
+	n.dropEdges(node)
+
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	delete(n.groups, node)
+	delete(n.regions, node)
+}
+
+// dropEdges drops the edges of a node that is gone, for good or not.
+func (n *Network) dropEdges(node *Node) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	for e := range n.edges {
+		if e.A == node || e.B == node {
+			delete(n.edges, e)
+			n.closeProxy(e)
+		}
+	}
+
+	cut := n.cut[:0]
+	for _, e := range n.cut {
+		if e.A != node && e.B != node {
+			cut = append(cut, e)
+		}
+	}
+	n.cut = cut
+}
+
+// Events returns the logger for sim events about the whole network, like
+// Partitioned and Healed.
+func (n *Network) Events() *logs.SimLogger {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	if n.sl == nil {
+		n.sl = logs.NewEventLogger(NetworkLoggerID)
+		n.logs.MixReader(n.sl.Reader())
+	}
+	return n.sl
+}
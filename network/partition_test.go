@@ -0,0 +1,97 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeHead(n *Node) uint64 {
+	b := n.NodeBackend.(*FakeBackend)
+	b.chain.lk.Lock()
+	defer b.chain.lk.Unlock()
+	return uint64(b.head.Height)
+}
+
+func TestNetworkPartition(t *testing.T) {
+	ctx := context.Background()
+	net := NewTestNetwork(t)
+	defer net.ShutdownAll()
+
+	types := ReadLogTypes(net.Logs().Reader())
+	require.NoError(t, net.AddNodes(MinerNodeType, 4))
+	nodes := net.GetNodesOfType(AnyNodeType)
+	a, b := nodes[:2], nodes[2:]
+
+	assert.Error(t, net.Heal())
+	require.NoError(t, net.Partition([][]*Node{a, b}))
+	assert.True(t, net.Partitioned())
+	assert.Error(t, net.Partition([][]*Node{a, b}))
+	assert.Error(t, net.Connect(ctx, a[0], b[0]))
+
+	// each side mines its own chain.
+	require.NoError(t, a[0].MiningOnce(ctx))
+	require.NoError(t, a[0].MiningOnce(ctx))
+	require.NoError(t, b[0].MiningOnce(ctx))
+	assert.Equal(t, fakeHead(a[0]), fakeHead(a[1]))
+	assert.Equal(t, fakeHead(b[0]), fakeHead(b[1]))
+	assert.True(t, fakeHead(a[1]) > fakeHead(b[1]))
+
+	// and they converge on the longest, once healed.
+	require.NoError(t, net.Heal())
+	assert.False(t, net.Partitioned())
+	for _, n := range nodes {
+		assert.Equal(t, fakeHead(a[0]), fakeHead(n))
+	}
+
+	counts := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for !countsAtLeast(counts, map[string]int{"Partitioned": 1, "Healed": 1}) {
+		select {
+		case typ := <-types:
+			counts[typ]++
+		case <-timeout:
+			t.Fatalf("timed out waiting for logs. saw: %v", counts)
+		}
+	}
+}
+
+func TestNetworkPartitionRemoveNode(t *testing.T) {
+	net := NewTestNetwork(t)
+	defer net.ShutdownAll()
+
+	ReadLogTypes(net.Logs().Reader())
+	require.NoError(t, net.AddNodes(ClientNodeType, 3))
+	nodes := net.GetNodesOfType(AnyNodeType)
+
+	require.NoError(t, net.Partition([][]*Node{nodes[:1]}))
+	require.NoError(t, net.RemoveNode(nodes[0].ID))
+
+	// only edges between nodes still in the network reconnect.
+	require.NoError(t, net.Heal())
+	assert.Len(t, net.edges, 1)
+}
+
+func TestNetworkPartitionJoin(t *testing.T) {
+	net := NewTestNetwork(t)
+	defer net.ShutdownAll()
+
+	ReadLogTypes(net.Logs().Reader())
+	require.NoError(t, net.AddNodes(ClientNodeType, 2))
+	nodes := net.GetNodesOfType(AnyNodeType)
+	require.NoError(t, net.Partition([][]*Node{nodes[:1], nodes[1:]}))
+
+	// a node that joins while partitioned only connects to its own group,
+	// the group of nodes in no group, until the network heals.
+	joined, err := net.AddNode(ClientNodeType)
+	require.NoError(t, err)
+	assert.Len(t, net.edges, 0)
+
+	require.NoError(t, net.Heal())
+	assert.Len(t, net.edges, 3)
+	assert.True(t, net.edges[edgeKey(joined, nodes[0])])
+	assert.True(t, net.edges[edgeKey(joined, nodes[1])])
+}
@@ -0,0 +1,220 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// findDaemonPid returns the pid of the go-filecoin daemon running on
+// repoDir. The daemon helpers do not expose their process, so it looks
+// for the daemon's command line in /proc, which only Linux has.
+func findDaemonPid(repoDir string) (int, error) {
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, dir := range dirs {
+		cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil {
+			continue // gone, or not ours.
+		}
+		if isDaemonCmdline(cmdline, repoDir) {
+			return strconv.Atoi(filepath.Base(dir))
+		}
+	}
+	return 0, fmt.Errorf("no go-filecoin daemon running on repo %s", repoDir)
+}
+
+// isDaemonCmdline returns whether a /proc cmdline (args separated by
+// NULs) is a go-filecoin daemon on repoDir.
+func isDaemonCmdline(cmdline []byte, repoDir string) bool {
+	args := bytes.Split(bytes.TrimRight(cmdline, "\x00"), []byte{0})
+	if len(args) < 2 || filepath.Base(string(args[0])) != "go-filecoin" {
+		return false
+	}
+
+	daemon, repo := false, false
+	for i, a := range args[1:] {
+		switch {
+		case string(a) == "daemon":
+			daemon = true
+		case string(a) == "--repodir="+repoDir:
+			repo = true
+		case string(a) == "--repodir" && i+2 < len(args) && string(args[i+2]) == repoDir:
+			repo = true
+		}
+	}
+	return daemon && repo
+}
+
+// cliProc is a go-filecoin cli process the sim spawned, to talk to the
+// daemon at CmdAddr.
+type cliProc struct {
+	Pid     int
+	CmdAddr string
+}
+
+// cliProcs returns the go-filecoin cli processes that are children of
+// this process. The daemon helpers run the cli for each interaction.
+func cliProcs() []cliProc {
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return nil
+	}
+
+	self := os.Getpid()
+	var procs []cliProc
+	for _, dir := range dirs {
+		stat, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			continue
+		}
+		if ppid, err := statPpid(stat); err != nil || ppid != self {
+			continue
+		}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil {
+			continue
+		}
+		addr, ok := cliCmdAddr(cmdline)
+		if !ok {
+			continue
+		}
+
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+		procs = append(procs, cliProc{Pid: pid, CmdAddr: addr})
+	}
+	return procs
+}
+
+// statPpid returns the parent pid in a /proc stat line, which looks like
+// "pid (comm) state ppid ...". comm may have spaces and parens.
+func statPpid(stat []byte) (int, error) {
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("bad stat: %q", stat)
+	}
+	fields := bytes.Fields(stat[i+1:])
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("bad stat: %q", stat)
+	}
+	return strconv.Atoi(string(fields[1]))
+}
+
+// cliCmdAddr returns the daemon api address a /proc cmdline of a
+// go-filecoin cli invocation talks to. Daemons are not cli invocations.
+func cliCmdAddr(cmdline []byte) (string, bool) {
+	args := bytes.Split(bytes.TrimRight(cmdline, "\x00"), []byte{0})
+	if len(args) < 2 || filepath.Base(string(args[0])) != "go-filecoin" {
+		return "", false
+	}
+
+	addr := ""
+	for i, a := range args[1:] {
+		switch {
+		case string(a) == "daemon":
+			return "", false
+		case bytes.HasPrefix(a, []byte("--cmdapiaddr=")):
+			addr = string(a[len("--cmdapiaddr="):])
+		case string(a) == "--cmdapiaddr" && i+2 < len(args):
+			addr = string(args[i+2])
+		}
+	}
+	return addr, true
+}
+
+// Supervisor watches the go-filecoin cli processes the sim spawns, and
+// kills the stragglers: those still running MaxAge after it first saw
+// them. Many cli commands hang forever on errors, and each one holds on
+// to file descriptors. A MaxAge of 0 kills nothing.
+type Supervisor struct {
+	MaxAge time.Duration
+
+	lk     sync.Mutex
+	seen   map[int]time.Time
+	killed uint64
+	kill   func(pid int) error
+}
+
+func NewSupervisor(maxAge time.Duration) *Supervisor {
+	return &Supervisor{
+		MaxAge: maxAge,
+		seen:   make(map[int]time.Time),
+		kill: func(pid int) error {
+			return syscall.Kill(pid, syscall.SIGKILL)
+		},
+	}
+}
+
+// Run reaps stragglers every interval, until ctx is done.
+func (s *Supervisor) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if k := s.Reap(); k > 0 {
+				log.Printf("[NET]\t killed %d straggling cli processes\n", k)
+			}
+		}
+	}
+}
+
+// Reap kills the stragglers once, and returns how many it killed.
+func (s *Supervisor) Reap() int {
+	return s.reap(cliProcs(), time.Now())
+}
+
+func (s *Supervisor) reap(procs []cliProc, now time.Time) int {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.MaxAge <= 0 {
+		return 0
+	}
+
+	running := make(map[int]time.Time, len(procs))
+	killed := 0
+	for _, p := range procs {
+		first, ok := s.seen[p.Pid]
+		if !ok {
+			first = now
+		}
+		if now.Sub(first) < s.MaxAge {
+			running[p.Pid] = first
+			continue
+		}
+		if err := s.kill(p.Pid); err != nil {
+			running[p.Pid] = first // try again next time.
+			continue
+		}
+		killed++
+	}
+
+	s.seen = running // forget the ones that exited.
+	s.killed += uint64(killed)
+	return killed
+}
+
+// Killed returns how many stragglers the supervisor killed.
+func (s *Supervisor) Killed() uint64 {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.killed
+}
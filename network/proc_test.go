@@ -0,0 +1,74 @@
+package network
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDaemonCmdline(t *testing.T) {
+	cmdline := func(args ...string) []byte {
+		return []byte(strings.Join(args, "\x00") + "\x00")
+	}
+
+	assert.True(t, isDaemonCmdline(cmdline("/usr/bin/go-filecoin", "daemon", "--repodir=/tmp/node1", "--cmdapiaddr=:3453"), "/tmp/node1"))
+	assert.True(t, isDaemonCmdline(cmdline("go-filecoin", "daemon", "--repodir", "/tmp/node1"), "/tmp/node1"))
+	assert.False(t, isDaemonCmdline(cmdline("go-filecoin", "daemon", "--repodir=/tmp/node10"), "/tmp/node1"))
+	assert.False(t, isDaemonCmdline(cmdline("go-filecoin", "swarm", "peers", "--repodir=/tmp/node1"), "/tmp/node1"))
+	assert.False(t, isDaemonCmdline(cmdline("vim", "daemon", "--repodir=/tmp/node1"), "/tmp/node1"))
+	assert.False(t, isDaemonCmdline(nil, "/tmp/node1"))
+}
+
+func TestStatPpid(t *testing.T) {
+	ppid, err := statPpid([]byte("4242 (go-filecoin) S 17 4242 17 0 -1 4194560"))
+	assert.NoError(t, err)
+	assert.Equal(t, 17, ppid)
+
+	ppid, err = statPpid([]byte("4242 (a (weird) name) R 99 4242"))
+	assert.NoError(t, err)
+	assert.Equal(t, 99, ppid)
+
+	_, err = statPpid([]byte("4242 go-filecoin"))
+	assert.Error(t, err)
+}
+
+func TestCliCmdAddr(t *testing.T) {
+	cmdline := func(args ...string) []byte {
+		return []byte(strings.Join(args, "\x00") + "\x00")
+	}
+
+	addr, ok := cliCmdAddr(cmdline("/usr/bin/go-filecoin", "swarm", "connect", "/ip4/1.2.3.4/tcp/6000", "--cmdapiaddr=:3453"))
+	assert.True(t, ok)
+	assert.Equal(t, ":3453", addr)
+
+	addr, ok = cliCmdAddr(cmdline("go-filecoin", "--cmdapiaddr", ":3454", "mining", "once"))
+	assert.True(t, ok)
+	assert.Equal(t, ":3454", addr)
+
+	_, ok = cliCmdAddr(cmdline("go-filecoin", "daemon", "--cmdapiaddr=:3453"))
+	assert.False(t, ok)
+	_, ok = cliCmdAddr(cmdline("vim", "--cmdapiaddr=:3453"))
+	assert.False(t, ok)
+}
+
+func TestSupervisorReap(t *testing.T) {
+	var killed []int
+	s := NewSupervisor(time.Minute)
+	s.kill = func(pid int) error {
+		killed = append(killed, pid)
+		return nil
+	}
+
+	start := time.Now()
+	assert.Equal(t, 0, s.reap([]cliProc{{Pid: 1}, {Pid: 2}}, start))
+	assert.Equal(t, 0, s.reap([]cliProc{{Pid: 2}, {Pid: 3}}, start.Add(30*time.Second)))
+
+	// 2 has been running for a minute. 1 exited, and 3 is new enough.
+	assert.Equal(t, 1, s.reap([]cliProc{{Pid: 2}, {Pid: 3}}, start.Add(time.Minute)))
+	assert.Equal(t, []int{2}, killed)
+	assert.Equal(t, 1, s.reap([]cliProc{{Pid: 3}}, start.Add(2*time.Minute)))
+	assert.Equal(t, []int{2, 3}, killed)
+	assert.Equal(t, uint64(2), s.Killed())
+}
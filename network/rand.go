@@ -0,0 +1,34 @@
+package network
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// NewRand returns a *rand.Rand that is safe for concurrent use.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(seed).(rand.Source64)})
+}
+
+type lockedSource struct {
+	lk  sync.Mutex
+	src rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.src.Seed(seed)
+}
@@ -2,18 +2,15 @@ package network
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"reflect"
-	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	sm "github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
-
 	randfile "github.com/filecoin-project/filecoin-network-sim/randfile"
 )
 
@@ -27,132 +24,415 @@ const (
 	ActionSendFile
 )
 
+// AllActions is every Action.
+var AllActions = []Action{ActionPayment, ActionAsk, ActionBid, ActionDeal, ActionSendFile}
+
+func (a Action) String() string {
+	switch a {
+	case ActionPayment:
+		return "Payment"
+	case ActionAsk:
+		return "Ask"
+	case ActionBid:
+		return "Bid"
+	case ActionDeal:
+		return "Deal"
+	case ActionSendFile:
+		return "SendFile"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
 type Args struct {
 	StartNodes      int
 	MaxNodes        int
+	MinNodes        int
 	ForkBranching   int
 	ForkProbability float64
 	JoinTime        time.Duration
+	LeaveTime       time.Duration // 0 means nodes never leave
 	BlockTime       time.Duration
 	ActionTime      time.Duration
+	PartitionTime   time.Duration // how often to partition the network, 0 means never
+	HealTime        time.Duration // how long partitions last, more than 0 if they happen
+	CrashTime       time.Duration // how often to crash a node, 0 means never
+	FreezeTime      time.Duration // how often to freeze a node, 0 means never
+	DownTime        time.Duration // how long crashed and frozen nodes stay down
 	TestfilesDir    string
+	Seed            int64 // 0 picks one from the clock
 	Actions         ActionArgs
 }
 
 type ActionArgs struct {
-	Ask     bool
-	Bid     bool
-	Deal    bool
-	Payment bool
-	Mine    bool
+	Ask      bool
+	Bid      bool
+	Deal     bool
+	Payment  bool
+	SendFile bool
+	Mine     bool
+	Weights  ActionWeights
+}
+
+// ActionWeights sets how often each enabled action is picked, relative to
+// the others. A weight of 0 disables the action, unless all weights are
+// 0: then the enabled actions are picked uniformly.
+type ActionWeights struct {
+	Ask      int
+	Bid      int
+	Deal     int
+	Payment  int
+	SendFile int
+}
+
+// WeightedAction is an Action, and its weight in an ActionMix.
+type WeightedAction struct {
+	Action Action
+	Weight int
+}
+
+// ActionMix is the set of actions a Randomizer picks from.
+type ActionMix []WeightedAction
+
+func (m ActionMix) total() int {
+	t := 0
+	for _, wa := range m {
+		t += wa.Weight
+	}
+	return t
+}
+
+// String shows the resolved distribution, e.g. "Deal 83.3%, Payment 16.7%".
+func (m ActionMix) String() string {
+	total := m.total()
+	if total == 0 {
+		return "none"
+	}
+
+	strs := make([]string, len(m))
+	for i, wa := range m {
+		strs[i] = fmt.Sprintf("%s %.1f%%", wa.Action, 100*float64(wa.Weight)/float64(total))
+	}
+	return strings.Join(strs, ", ")
 }
 
 type Randomizer struct {
-	Net     *Network
-	Args    Args
-	Actions []Action
+	Net   *Network
+	Clock *Clock // all the Randomizer's loops wait on it
+
+	lk   sync.RWMutex // guards args and mix, which change live
+	args Args
+	mix  ActionMix
+
+	// rand seeds every other source of randomness in the Randomizer, so
+	// runs with the same Args.Seed make the same choices.
+	rand *rand.Rand
+
+	// runSteps are the clock's steps when Run started. Each loop counts
+	// the steps after them, so a step right after Run is not missed.
+	runSteps uint64
+
+	countLk sync.Mutex
+	counts  map[Action]ActionCount
 }
 
 func NewRandomizer(n *Network, a Args) *Randomizer {
-	r := &Randomizer{
-		Net:     n,
-		Args:    a,
-		Actions: []Action{},
+	if a.Seed == 0 {
+		a.Seed = time.Now().UnixNano()
 	}
 
-	addif := func(t bool, a Action) {
-		if t {
-			r.Actions = append(r.Actions, a)
+	rng := NewRand(a.Seed)
+	if n != nil {
+		// the network's choices come from the seed too.
+		n.SetSeed(rng.Int63())
+	}
+
+	return &Randomizer{
+		Net:   n,
+		Clock: NewClock(),
+		args:  a,
+		mix:   newActionMix(a.Actions),
+		rand:  rng,
+
+		counts: make(map[Action]ActionCount),
+	}
+}
+
+func newActionMix(a ActionArgs) ActionMix {
+	w := a.Weights
+	if w == (ActionWeights{}) {
+		w = ActionWeights{Ask: 1, Bid: 1, Deal: 1, Payment: 1, SendFile: 1}
+	}
+
+	mix := ActionMix{}
+	addif := func(t bool, a Action, weight int) {
+		if t && weight > 0 {
+			mix = append(mix, WeightedAction{a, weight})
 		}
 	}
-	addif(a.Actions.Ask, ActionAsk)
-	addif(a.Actions.Bid, ActionBid)
-	addif(a.Actions.Deal, ActionDeal)
-	addif(a.Actions.Payment, ActionPayment)
+	addif(a.Ask, ActionAsk, w.Ask)
+	addif(a.Bid, ActionBid, w.Bid)
+	addif(a.Deal, ActionDeal, w.Deal)
+	addif(a.Payment, ActionPayment, w.Payment)
+	addif(a.SendFile, ActionSendFile, w.SendFile)
+	return mix
+}
+
+// Args returns the current Args.
+func (r *Randomizer) Args() Args {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	return r.args
+}
+
+// Validate checks that a Randomizer can run with a.
+func (a Args) Validate() error {
+	if a.BlockTime <= 0 || a.ActionTime <= 0 || a.JoinTime <= 0 || a.LeaveTime < 0 || a.PartitionTime < 0 || a.HealTime < 0 ||
+		a.CrashTime < 0 || a.FreezeTime < 0 || a.DownTime < 0 {
+		return fmt.Errorf("times must be positive (t-leave, t-partition, t-crash and t-freeze may be 0)")
+	}
+	if a.PartitionTime > 0 && a.HealTime == 0 {
+		return fmt.Errorf("partitions need a t-heal, or they would heal at once")
+	}
+	if a.ForkProbability < 0 || a.ForkProbability > 1 {
+		return fmt.Errorf("fork probability must be in [0, 1]: %f", a.ForkProbability)
+	}
+	if a.ForkBranching < 0 || a.MinNodes < 0 || a.MaxNodes < 0 {
+		return fmt.Errorf("node counts and fork branching must not be negative")
+	}
+	return nil
+}
+
+// SetArgs changes the Args of a running Randomizer. Loops pick up the new
+// times on their next tick. StartNodes and Seed only matter before Run.
+func (r *Randomizer) SetArgs(a Args) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.args = a
+	r.mix = newActionMix(a.Actions)
+	return nil
+}
 
-	return r
+// Actions returns the current mix of random actions.
+func (r *Randomizer) Actions() ActionMix {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	return r.mix
+}
+
+// Pause stops the Randomizer from doing anything, until Resume or Step.
+// Actions already started finish.
+func (r *Randomizer) Pause() {
+	r.Clock.Pause()
+}
+
+func (r *Randomizer) Resume() {
+	r.Clock.Resume()
+}
+
+// Step advances every loop one tick: one epoch of mining, one action,
+// and one round of joining and leaving.
+func (r *Randomizer) Step() {
+	r.Clock.Step()
+}
+
+func (r *Randomizer) Paused() bool {
+	return r.Clock.Paused()
 }
 
 func (r *Randomizer) Run(ctx context.Context) {
 	time.Sleep(time.Millisecond * 100) // output correctly
+	args := r.Args()
 	fmt.Println("\nRandomizer running with params:")
-	fmt.Println(StructToString(&r.Args))
+	// the mix goes in the Actions block, which is last.
+	fmt.Println(strings.TrimRight(StructToString(&args), "\n"))
+	fmt.Printf("\tMix: %s\n\n", r.Actions())
+
+	r.runSteps = r.Clock.Steps()
+
+	// derive sources in a fixed order, before anything runs concurrently.
+	mineRand := r.newRand()
+	nodesRand := r.newRand()
+	actionsRand := r.newRand()
+	partitionRand := r.newRand()
+	faultsRand := r.newRand()
+
+	go r.mineBlocks(ctx, mineRand)
+	go r.addAndRemoveNodes(ctx, nodesRand)
+	go r.randomActions(ctx, actionsRand)
+	go r.partitions(ctx, partitionRand)
+	go r.faults(ctx, faultsRand)
+}
 
-	if r.Args.Actions.Mine {
-		go r.mineBlocks(ctx)
-	}
-	go r.addAndRemoveNodes(ctx)
-	go r.randomActions(ctx)
+// newRand returns a new source of randomness, derived from the seed.
+func (r *Randomizer) newRand() *rand.Rand {
+	return NewRand(r.rand.Int63())
 }
 
-func (r *Randomizer) periodic(ctx context.Context, t time.Duration, periodicFunc func(ctx context.Context)) {
+// periodic calls periodicFunc every interval(args) of sim time, or on
+// every step of the clock, with the Args current at the time. It skips
+// ticks while the interval is 0.
+func (r *Randomizer) periodic(ctx context.Context, interval func(a Args) time.Duration, periodicFunc func(ctx context.Context, a Args)) {
+	steps := r.runSteps
 	for {
-		time.Sleep(t)
-
-		select {
-		case <-ctx.Done():
+		t := interval(r.Args())
+		if t <= 0 {
+			t = time.Second // disabled. check again later.
+		}
+		var err error
+		if steps, err = r.Clock.Wait(ctx, t, steps); err != nil {
 			return
-		default:
 		}
 
-		periodicFunc(ctx)
+		a := r.Args()
+		if interval(a) <= 0 {
+			continue
+		}
+		periodicFunc(ctx, a)
 	}
 }
 
-func nextRandomType(n *Network) NodeType {
+func nextRandomType(rng *rand.Rand, n *Network) NodeType {
 	c := n.GetNodeCounts()
 	if float64(c[ClientNodeType]) < (float64(c[MinerNodeType]) * 1.5) {
 		return ClientNodeType
 	}
 
-	return AnyNodeType
+	return RandomNodeType(rng)
 }
 
 func (r *Randomizer) addInitialNodes(ctx context.Context) {
-	fmt.Printf("starting with %d nodes\n", r.Args.StartNodes)
-	var wg sync.WaitGroup
-	for i := 0; i < r.Args.StartNodes; i++ {
-		t := ClientNodeType
+	start := r.Args().StartNodes
+	fmt.Printf("starting with %d nodes, in a %s topology\n", start, r.Net.Topology())
+	types := make([]NodeType, start)
+	for i := range types {
+		types[i] = ClientNodeType
 		if i%2 == 0 {
-			t = MinerNodeType
+			types[i] = MinerNodeType
 		}
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			r.Net.AddNode(t)
-		}()
 	}
-	wg.Wait()
 
-	// ensure all nodes are connected. (async start)
-	for _, n := range r.Net.GetNodesOfType(AnyNodeType) {
-		if n == nil {
-			logErr(fmt.Errorf("node is nil: %v", n))
-			continue
-		}
-
-		r.Net.ConnectNodeToAll(n)
+	// they join together, so the topology connects them as a group.
+	if _, err := r.Net.addNodes(types); err != nil {
+		logErr(fmt.Errorf("adding %d/%d initial nodes failed: %s", len(err.(MultiErr)), start, err))
 	}
 }
 
-func (r *Randomizer) addAndRemoveNodes(ctx context.Context) {
+func (r *Randomizer) addAndRemoveNodes(ctx context.Context, rng *rand.Rand) {
+	leaveRand := NewRand(rng.Int63())
+
 	// add nodes at the beginning, to get going faster
 	r.addInitialNodes(ctx)
 
+	// periodically remove nodes
+	leaveTime := func(a Args) time.Duration { return a.LeaveTime }
+	go r.periodic(ctx, leaveTime, func(ctx context.Context, a Args) {
+		if r.Net.Size() <= a.MinNodes {
+			return
+		}
+
+		nd := r.Net.GetRandomNode(leaveRand, AnyNodeType)
+		if nd == nil {
+			return
+		}
+		logErr(r.Net.RemoveNode(nd.ID))
+	})
+
 	// periodically add more nodes
-	r.periodic(ctx, r.Args.JoinTime, func(ctx context.Context) {
-		if r.Net.Size() >= r.Args.MaxNodes {
+	joinTime := func(a Args) time.Duration { return a.JoinTime }
+	r.periodic(ctx, joinTime, func(ctx context.Context, a Args) {
+		if r.Net.Size() >= a.MaxNodes {
 			return
 		}
 
-		t := nextRandomType(r.Net)
+		t := nextRandomType(rng, r.Net)
 		_, err := r.Net.AddNode(t)
 		logErr(err)
 	})
 }
 
-func rollToMine(probability float64) bool {
+// partitions periodically splits the network in two random groups, and
+// heals it after HealTime of sim time. Steps do not shorten it, so a paused
+// sim can be stepped through a fork.
+func (r *Randomizer) partitions(ctx context.Context, rng *rand.Rand) {
+	partitionTime := func(a Args) time.Duration { return a.PartitionTime }
+	r.periodic(ctx, partitionTime, func(ctx context.Context, a Args) {
+		nodes := r.Net.GetNodesOfType(AnyNodeType)
+		if len(nodes) < 2 || r.Net.Partitioned() {
+			return
+		}
+
+		rng.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+		split := 1 + rng.Intn(len(nodes)-1)
+		if err := r.Net.Partition([][]*Node{nodes[:split], nodes[split:]}); err != nil {
+			logErr(err)
+		}
+		log.Printf("[RAND]\t partitioned %d|%d nodes for %s\n", split, len(nodes)-split, a.HealTime)
+
+		// heal even if ctx is done, so the network is whole at the end.
+		r.Clock.Sleep(ctx, a.HealTime)
+		logErr(r.Net.Heal())
+	})
+}
+
+// faults periodically crashes nodes, and freezes others. They come back
+// after DownTime of sim time: crashed nodes restart from their repo, and
+// frozen nodes thaw. Steps do not shorten DownTime. It keeps at least
+// MinNodes up.
+func (r *Randomizer) faults(ctx context.Context, rng *rand.Rand) {
+	freezeRand := NewRand(rng.Int63())
+
+	// pick returns a node to take down, if enough are up.
+	pick := func(rng *rand.Rand, a Args) *Node {
+		if len(upNodes(r.Net.GetNodesOfType(AnyNodeType))) <= a.MinNodes {
+			return nil
+		}
+		return r.Net.GetRandomNode(rng, AnyNodeType)
+	}
+
+	crashTime := func(a Args) time.Duration { return a.CrashTime }
+	go r.periodic(ctx, crashTime, func(ctx context.Context, a Args) {
+		nd := pick(rng, a)
+		if nd == nil {
+			return
+		}
+		if err := r.Net.CrashNode(nd); err != nil {
+			logErr(err)
+			return
+		}
+
+		go func() {
+			if err := r.Clock.Sleep(ctx, a.DownTime); err != nil {
+				return // the sim is over.
+			}
+			logErr(r.Net.RestartNode(nd))
+		}()
+	})
+
+	freezeTime := func(a Args) time.Duration { return a.FreezeTime }
+	r.periodic(ctx, freezeTime, func(ctx context.Context, a Args) {
+		nd := pick(freezeRand, a)
+		if nd == nil {
+			return
+		}
+		if err := r.Net.FreezeNode(nd); err != nil {
+			logErr(err)
+			return
+		}
+
+		go func() {
+			// thaw even if ctx is done, so the node can shut down.
+			r.Clock.Sleep(ctx, a.DownTime)
+			logErr(r.Net.ThawNode(nd))
+		}()
+	})
+}
+
+func rollToMine(rng *rand.Rand, probability float64) bool {
 	if probability < 0.001 {
 		return false
 	}
@@ -160,31 +440,35 @@ func rollToMine(probability float64) bool {
 		return true
 	}
 
-	roll := rand.Float64()
+	roll := rng.Float64()
 	// fmt.Printf("probability roll: %f < %f\n", roll, probability)
 	return roll < probability
 }
 
 // Only miners should mine block
-func (r *Randomizer) mineBlocks(ctx context.Context) {
+func (r *Randomizer) mineBlocks(ctx context.Context, rng *rand.Rand) {
 	fmt.Println("mining automatically")
 
 	epoch := -1 // so next one is 0.
-	r.periodic(ctx, r.Args.BlockTime, func(ctx context.Context) {
+	blockTime := func(a Args) time.Duration { return a.BlockTime }
+	r.periodic(ctx, blockTime, func(ctx context.Context, a Args) {
+		if !a.Actions.Mine {
+			return
+		}
 		epoch++
 
 		// once per ForkBranching.
 		// do it this way, to sample without replacement and deal with the case
 		// where there are (N < ForkBranching) nodes in the network.
-		nds := r.Net.GetRandomNodes(MinerNodeType, r.Args.ForkBranching)
+		nds := r.Net.GetRandomNodes(rng, MinerNodeType, a.ForkBranching)
 		// fmt.Printf("epoch %d: %d to mine\n", epoch, len(nds))
 		var wg sync.WaitGroup
 		for _, n := range nds {
-			if rollToMine(r.Args.ForkProbability) {
+			if rollToMine(rng, a.ForkProbability) {
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
-					logErr(n.Daemon.MiningOnce())
+					logErr(r.Net.MineOnce(ctx, n))
 				}()
 			}
 		}
@@ -192,296 +476,180 @@ func (r *Randomizer) mineBlocks(ctx context.Context) {
 	})
 }
 
-func (r *Randomizer) randomActions(ctx context.Context) {
-	r.periodic(ctx, r.Args.ActionTime, func(ctx context.Context) {
-		if len(r.Actions) < 1 {
+func (r *Randomizer) randomActions(ctx context.Context, rng *rand.Rand) {
+	actionTime := func(a Args) time.Duration { return a.ActionTime }
+	r.periodic(ctx, actionTime, func(ctx context.Context, a Args) {
+		mix := r.Actions()
+		if len(mix) < 1 {
 			return
 		}
 
-		action := r.Actions[rand.Intn(len(r.Actions))]
-		go r.doRandomAction(ctx, action)
+		// each action gets its own source, so concurrent actions do not
+		// change each others' choices.
+		action := mix.pick(rng)
+		arng := NewRand(rng.Int63())
+		go r.doRandomAction(ctx, arng, action)
 	})
 }
 
-func (r *Randomizer) doRandomAction(ctx context.Context, a Action) {
+// pick picks one of the actions, with probability proportional to its
+// weight.
+func (m ActionMix) pick(rng *rand.Rand) Action {
+	roll := rng.Intn(m.total())
+	for _, wa := range m {
+		if roll < wa.Weight {
+			return wa.Action
+		}
+		roll -= wa.Weight
+	}
+	panic("unreachable")
+}
+
+func (r *Randomizer) doRandomAction(ctx context.Context, rng *rand.Rand, a Action) {
+	log.Printf("[RAND]\t action: %s", a)
+
+	var err error
 	switch a {
 	case ActionPayment:
-		r.doActionPayment(ctx)
+		err = r.doActionPayment(ctx, rng)
 	case ActionAsk:
-		r.doActionAsk(ctx)
+		err = r.doActionAsk(ctx, rng)
 	case ActionBid:
-		r.doActionBid(ctx)
+		err = r.doActionBid(ctx, rng)
 	case ActionDeal:
-		r.doActionDeal(ctx)
+		err = r.doActionDeal(ctx, rng)
 	case ActionSendFile:
-	}
-}
-
-func (r *Randomizer) doActionPayment(ctx context.Context) {
-	var amtToSend = 5000
-
-	nds := r.Net.GetRandomNodes(AnyNodeType, 2)
-	if len(nds) < 2 || nds[0] == nil || nds[1] == nil {
-		log.Print("[RAND]\t not enough nodes for random actions")
-		return
+		err = r.doActionSendFile(ctx, rng)
 	}
 
-	log.Print("[RAND]\t Trying to send payment.")
-	a1, err1 := nds[0].Daemon.GetMainWalletAddress()
-	a2, err2 := nds[1].Daemon.GetMainWalletAddress()
-	logErr(err1)
-	logErr(err2)
-	if a1 == "" || a2 == "" {
-		log.Print("[RAND]\t could not get wallet addresses.", a1, a2, err1, err2)
+	if err == errSkipped {
 		return
 	}
+	logErr(err)
+	r.countAction(a, err)
+}
 
-	// ensure source has balance first. if doesn't, it wont work.
-	bal, err := nds[0].Daemon.WalletBalance(a1)
-	if err != nil {
-		log.Print("[RAND]\t could not get balance for address: ", a1)
-		return
-	}
-	if bal < amtToSend {
-		log.Printf("[RAND]\t not enough money in address: %s %d", a1, bal)
-		return
-	}
+// errSkipped is returned by actions that had nothing to act on, like no
+// nodes of the right type. They do not count as attempts.
+var errSkipped = errors.New("skipped")
 
-	// if does not succeed in 3 block times, it's hung on an error
-	ctx, _ = context.WithTimeout(ctx, r.Args.BlockTime*3)
-	logErr(nds[0].Daemon.SendFilecoin(ctx, a1, a2, amtToSend))
-	return
+// ActionCount is how many times a random action was attempted, and how
+// many of those failed. The others succeeded.
+type ActionCount struct {
+	Attempted uint64
+	Failed    uint64
 }
 
-func (r *Randomizer) doActionAsk(ctx context.Context) {
-	size := (rand.Intn(16) + 1) + 30 // ~MB
-	price := rand.Intn(13) + 13
+func (c ActionCount) Succeeded() uint64 {
+	return c.Attempted - c.Failed
+}
 
-	nd := r.Net.GetRandomNode(MinerNodeType)
-	if nd == nil {
-		return
-	}
+func (r *Randomizer) countAction(a Action, err error) {
+	r.countLk.Lock()
+	defer r.countLk.Unlock()
 
-	// ensure they have a miner addrss associated with them.
-	from, err := nd.CreateOrGetMinerIdentity()
+	c := r.counts[a]
+	c.Attempted++
 	if err != nil {
-		logErr(err)
-		return
+		c.Failed++
 	}
-
-	log.Printf("adding ask: %s %d %d", from, size, price)
-	logErr(nd.Daemon.MinerAddAsk(ctx, from, size, price))
-	return
+	r.counts[a] = c
 }
 
-func (r *Randomizer) doActionBid(ctx context.Context) {
-	// size := (rand.Intn(16) + 1) * (1 << 20) // ~MB
-	size := (rand.Intn(16) + 1) + 30
-	price := rand.Intn(17) + 1
+// ActionCounts returns the counts of the random actions attempted so far.
+func (r *Randomizer) ActionCounts() map[Action]ActionCount {
+	r.countLk.Lock()
+	defer r.countLk.Unlock()
 
-	nd := r.Net.GetRandomNode(ClientNodeType)
-	if nd == nil {
-		return
-	}
-
-	// ensure they have an addr they can bid from
-	from, err := nd.Daemon.GetMainWalletAddress()
-	if err != nil {
-		logErr(err)
-		return
+	counts := make(map[Action]ActionCount, len(r.counts))
+	for a, c := range r.counts {
+		counts[a] = c
 	}
-
-	log.Printf("adding bid: %s %d %d", from, size, price)
-	logErr(nd.Daemon.ClientAddBid(ctx, from, size, price))
-	return
+	return counts
 }
 
-func (r *Randomizer) doActionDeal(ctx context.Context) {
-	nd := r.Net.GetRandomNode(ClientNodeType)
-	if nd == nil {
-		return
+func (r *Randomizer) doActionPayment(ctx context.Context, rng *rand.Rand) error {
+	var amtToSend = 5000
+
+	nds := r.Net.GetRandomNodes(rng, AnyNodeType, 2)
+	if len(nds) < 2 || nds[0] == nil || nds[1] == nil {
+		log.Print("[RAND]\t not enough nodes for random actions")
+		return errSkipped
 	}
 
-	/*
-		from, err := nd.Daemon.GetMainWalletAddress()
-		if err != nil {
-			logErr(err)
-			return
-		}
-	*/
+	log.Print("[RAND]\t Trying to send payment.")
 
-	out, err := nd.Daemon.OrderbookGetAsks(ctx)
-	if err != nil {
-		logErr(err)
-		return
-	}
-	asks, err := extractAsks(out.ReadStdout())
-	if err != nil {
-		logErr(err)
-		return
-	}
+	// the payment timeout limits it, in case it hangs on an error.
+	return r.Net.Payment(ctx, nds[0], nds[1], amtToSend)
+}
 
-	out, err = nd.Daemon.OrderbookGetBids(ctx)
-	if err != nil {
-		logErr(err)
-		return
-	}
+func (r *Randomizer) doActionAsk(ctx context.Context, rng *rand.Rand) error {
+	size := (rng.Intn(16) + 1) + 30 // ~MB
+	price := rng.Intn(13) + 13
 
-	bids, err := extractUnusedBids(out.ReadStdout())
-	if err != nil {
-		logErr(err)
-		return
+	nd := r.Net.GetRandomNode(rng, MinerNodeType)
+	if nd == nil {
+		return errSkipped
 	}
 
-	wallet := nd.WalletAddr
-
-	log.Printf("Wallet Address: %s\n", wallet)
+	return r.Net.Ask(ctx, nd, size, price)
+}
 
-	ask, bid, err := getBestDealPair(asks, bids, wallet)
+func (r *Randomizer) doActionBid(ctx context.Context, rng *rand.Rand) error {
+	// size := (rng.Intn(16) + 1) * (1 << 20) // ~MB
+	size := (rng.Intn(16) + 1) + 30
+	price := rng.Intn(17) + 1
 
-	if err != nil {
-		logErr(err)
-		return
+	nd := r.Net.GetRandomNode(rng, ClientNodeType)
+	if nd == nil {
+		return errSkipped
 	}
 
-	log.Printf("[RAND] deal found ask and bid\n")
-	log.Printf("[RAND] ask %d %s %s\n", ask.ID, ask.Price.String(), ask.Size.String())
-	log.Printf("[RAND] bid %d %s %s\n", bid.ID, bid.Price.String(), bid.Size.String())
+	return r.Net.Bid(ctx, nd, size, price)
+}
 
-	// get a randomfile
-	fp, err := randfile.RandomFile(r.Args.TestfilesDir, nd.RepoDir)
-	if err != nil {
-		logErr(err)
-		return
+func (r *Randomizer) doActionDeal(ctx context.Context, rng *rand.Rand) error {
+	nd := r.Net.GetRandomNode(rng, ClientNodeType)
+	if nd == nil {
+		return errSkipped
 	}
 
-	out, err = nd.Daemon.ClientImport(fp)
+	ask, bid, err := r.Net.FindDeal(ctx, nd, nil)
 	if err != nil {
-		logErr(err)
-		return
+		return err
 	}
 
-	cid := out.ReadStdoutTrimNewlines()
-
-	out, err = nd.Daemon.ProposeDeal(ask.ID, bid.ID, cid)
+	// get a randomfile
+	fp, err := randfile.RandomFile(rng, r.Args().TestfilesDir, nd.RepoDir())
 	if err != nil {
-		logErr(err)
-		return
+		return err
 	}
 
-	log.Printf("[RAND] deal proposal: %s\n", out)
+	_, err = r.Net.ProposeDeal(ctx, nd, ask, bid, fp)
+	return err
 }
 
-func getBestDealPair(asks []sm.Ask, bids []sm.Bid, wallet string) (sm.Ask, sm.Bid, error) {
-	// Sort bids by ID, FIFO
-	sort.Slice(bids[:], func(i, j int) bool {
-		return bids[i].ID < bids[j].ID
-	})
-
-	// Sort asks by Price, as we will always want the best price
-	sort.Slice(asks[:], func(i, j int) bool {
-		return asks[i].Price.LessThan(asks[j].Price)
-	})
-
-	// All bids for the given wallet
-	var walletBids []sm.Bid
-
-	// Find all bids for the provided wallet
-	for _, b := range bids {
-		if b.Owner.String() == wallet {
-			log.Printf("[RAND] getBestDealPair found bid for wallet %s id, %d, price %s, size, %s\n", wallet, b.ID, b.Price.String(), b.Size.String())
-			walletBids = append(walletBids, b)
-		}
+// doActionSendFile has a random client that is up retrieve the data of a
+// random deal, other than the client that stored it.
+func (r *Randomizer) doActionSendFile(ctx context.Context, rng *rand.Rand) error {
+	deals := r.Net.Deals()
+	if len(deals) == 0 {
+		log.Print("[RAND]\t no deals to retrieve yet")
+		return errSkipped
 	}
+	d := deals[rng.Intn(len(deals))]
 
-	if len(walletBids) != 0 {
-		for _, b := range walletBids {
-			// Check to see if the bid fits within an ask
-			for _, a := range asks {
-				if b.Size.LessEqual(a.Size) && b.Price.GreaterEqual(a.Price) {
-					// Valid bid for ask
-					return a, b, nil
-				}
-			}
+	var others []*Node
+	for _, nd := range upNodes(r.Net.GetNodesOfType(ClientNodeType)) {
+		if nd != d.Client {
+			others = append(others, nd)
 		}
-	} else {
-		log.Printf("Could not find any bids for wallet %s\n", wallet)
 	}
-
-	err := fmt.Errorf("Could not find matching ask / bid for wallet %s", wallet)
-	return sm.Ask{}, sm.Bid{}, err
-
-}
-
-func extractAsks(input string) ([]sm.Ask, error) {
-
-	// remove last new line
-	o := strings.Trim(input, "\n")
-	// separate ndjson on new lines
-	as := strings.Split(o, "\n")
-	log.Printf("[RAND] extractAsks: asks of length %d: %v\n", len(as), as)
-	if len(as) <= 1 {
-		return nil, fmt.Errorf("No Asks yet")
+	if len(others) == 0 {
+		return errSkipped
 	}
 
-	var asks []sm.Ask
-	for _, a := range as {
-		var ask sm.Ask
-		log.Printf("[RAND] extractAsks: ask %v\n", a)
-		err := json.Unmarshal([]byte(a), &ask)
-		if err != nil {
-			panic(err)
-		}
-		asks = append(asks, ask)
-	}
-	return asks, nil
-}
-
-func extractUnusedBids(input string) ([]sm.Bid, error) {
-	// remove last new line
-	o := strings.Trim(input, "\n")
-	// separate ndjson on new lines
-	bs := strings.Split(o, "\n")
-	log.Printf("[RAND] extractUnusedBids: bids of length %d: %v\n", len(bs), bs)
-	if len(bs) <= 1 {
-		return nil, fmt.Errorf("No Bids yet")
-	}
-
-	var bids []sm.Bid
-	for _, b := range bs {
-		var bid sm.Bid
-		log.Printf("[RAND] extractUnusedBids: bid %v\n", b)
-		err := json.Unmarshal([]byte(b), &bid)
-		if err != nil {
-			panic(err)
-		}
-		if bid.Used {
-			continue
-		}
-		bids = append(bids, bid)
-	}
-	return bids, nil
-}
-
-func extractDeals(input string) []sm.Deal {
-
-	// remove last new line
-	o := strings.Trim(input, "\n")
-	// separate ndjson on new lines
-	ds := strings.Split(o, "\n")
-	log.Printf("[RAND] extractDeals: deals of length %d: %v\n", len(ds), ds)
-
-	var deals []sm.Deal
-	for _, d := range ds {
-		var deal sm.Deal
-		log.Printf("[RAND] extractDeals: deal %v\n", d)
-		err := json.Unmarshal([]byte(d), &deal)
-		if err != nil {
-			panic(err)
-		}
-		deals = append(deals, deal)
-	}
-	return deals
+	return r.Net.Retrieve(ctx, others[rng.Intn(len(others))], d)
 }
 
 func logErr(err error) {
@@ -4,52 +4,175 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRandomizer(t *testing.T) {
-	net, err := NewNetwork(TempDir(t))
-	assert.NoError(t, err)
+	net := NewTestNetwork(t)
 	defer net.ShutdownAll()
 
-	buf := bytes.NewBuffer(nil)
+	buf := &syncBuffer{}
 	go io.Copy(buf, net.Logs().Reader())
 
-	r := Randomizer{
-		Net:        net,
-		TotalNodes: 30,
-		BlockTime:  100 * time.Millisecond,
-		ActionTime: 100 * time.Millisecond,
-		Actions: []Action{
-			ActionPayment,
-			ActionAsk,
-			ActionBid,
+	r := NewRandomizer(net, Args{
+		StartNodes:      4,
+		MaxNodes:        6,
+		MinNodes:        3,
+		ForkBranching:   1,
+		ForkProbability: 1.0,
+		JoinTime:        200 * time.Millisecond,
+		LeaveTime:       300 * time.Millisecond,
+		BlockTime:       100 * time.Millisecond,
+		ActionTime:      20 * time.Millisecond,
+		PartitionTime:   500 * time.Millisecond,
+		HealTime:        300 * time.Millisecond,
+		CrashTime:       600 * time.Millisecond,
+		FreezeTime:      700 * time.Millisecond,
+		DownTime:        300 * time.Millisecond,
+		Actions: ActionArgs{
+			Ask:     true,
+			Bid:     true,
+			Deal:    true,
+			Payment: true,
+			Mine:    true,
 		},
-	}
+	})
 
 	ctx, cancel := context.WithCancel(context.Background())
 	r.Run(ctx)
 
-	runDuration := 5 * time.Second
+	runDuration := 3 * time.Second
 	time.Sleep(runDuration)
 	cancel()
-	time.Sleep(time.Second)
+	time.Sleep(200 * time.Millisecond)
 	// wait till done. want goprocess.
 
-	// s := string(buf.Bytes())
-	// rd := bytes.NewBuffer([]byte(s))
-	counts := CountLogs(t, buf)
+	counts := CountLogs(t, bytes.NewReader(buf.Bytes()))
 	t.Log(counts)
 	assert.True(t, counts["NewBlockMined"] > 1)
 	assert.True(t, counts["MinerJoins"] > 1)
 	assert.True(t, counts["ClientJoins"] > 1)
 	assert.True(t, counts["BroadcastBlock"] > 1)
 	assert.True(t, counts["AddAsk"] > 1)
+	assert.True(t, counts["AddBid"] > 1)
 	assert.True(t, counts["SendPayment"] > 1)
+	assert.True(t, counts["MinerLeaves"]+counts["ClientLeaves"] >= 1)
+	assert.True(t, counts["Partitioned"] >= 1)
+	assert.True(t, counts["Healed"] >= 1)
+	assert.True(t, counts["NodeCrashed"] >= 1)
+	assert.True(t, counts["NodeRestarted"] >= 1)
+	assert.True(t, counts["NodeFrozen"] >= 1)
+	assert.True(t, counts["NodeThawed"] >= 1)
+
+	actions := r.ActionCounts()
+	assert.True(t, actions[ActionAsk].Succeeded() > 1)
+	assert.True(t, actions[ActionPayment].Succeeded() > 1)
+	assert.Equal(t, uint64(0), actions[ActionSendFile].Attempted)
+}
+
+func TestRandomizerSeed(t *testing.T) {
+	// run returns what a Randomizer seeded with seed does: the types of the
+	// nodes that join, and the events of its first actions, in order.
+	run := func(seed int64) []string {
+		net := NewTestNetwork(t)
+		defer net.ShutdownAll()
+
+		buf := &syncBuffer{}
+		go io.Copy(buf, net.Logs().Reader())
+
+		r := NewRandomizer(net, Args{
+			Seed:       seed,
+			JoinTime:   time.Second,
+			ActionTime: time.Second,
+			Actions:    ActionArgs{Ask: true, Bid: true, Payment: true},
+		})
+
+		var seq []string
+		for i := 0; i < 4; i++ {
+			nd, err := net.AddNode(AnyNodeType)
+			require.NoError(t, err)
+			seq = append(seq, fmt.Sprintf("%s %s", nd.ID, nd.Type))
+		}
+		// so every action has a node to act on.
+		_, err := net.AddNode(MinerNodeType)
+		require.NoError(t, err)
+		_, err = net.AddNode(ClientNodeType)
+		require.NoError(t, err)
+
+		// step the actions one at a time, so they happen in order.
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r.Pause()
+		r.Run(ctx)
+
+		const steps = 12
+		attempted := func() (n uint64) {
+			for _, c := range r.ActionCounts() {
+				n += c.Attempted
+			}
+			return n
+		}
+		for i := uint64(1); i <= steps; i++ {
+			r.Step()
+			require.Eventually(t, func() bool { return attempted() >= i }, 5*time.Second, time.Millisecond)
+			require.Equal(t, i, attempted())
+		}
+
+		actionEvents := func() []string {
+			var evs []string
+			d := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+			for {
+				var ev struct{ Type, From, To string }
+				if err := d.Decode(&ev); err != nil {
+					return evs
+				}
+				switch ev.Type {
+				case "AddAsk", "AddBid", "SendPayment":
+					evs = append(evs, fmt.Sprintf("%s %s %s", ev.Type, ev.From, ev.To))
+				}
+			}
+		}
+		require.Eventually(t, func() bool { return len(actionEvents()) == steps }, 5*time.Second, 10*time.Millisecond)
+		return append(seq, actionEvents()...)
+	}
+
+	assert.Equal(t, run(42), run(42))
+	assert.NotEqual(t, run(42), run(43))
+}
+
+func TestRandomizerActionWeights(t *testing.T) {
+	r := NewRandomizer(nil, Args{
+		Seed: 1,
+		Actions: ActionArgs{
+			Ask:     false,
+			Bid:     true,
+			Deal:    true,
+			Payment: true,
+			Weights: ActionWeights{Ask: 3, Bid: 0, Deal: 5, Payment: 1},
+		},
+	})
+	require.Equal(t, ActionMix{{ActionDeal, 5}, {ActionPayment, 1}}, r.Actions())
+	assert.Equal(t, "Deal 83.3%, Payment 16.7%", r.Actions().String())
+
+	counts := map[Action]int{}
+	rng := r.newRand()
+	for i := 0; i < 6000; i++ {
+		counts[r.Actions().pick(rng)]++
+	}
+	assert.Len(t, counts, 2)
+	assert.InDelta(t, 5000, counts[ActionDeal], 200)
+	assert.InDelta(t, 1000, counts[ActionPayment], 200)
+
+	// no weights at all means uniform.
+	r = NewRandomizer(nil, Args{Actions: ActionArgs{Ask: true, Bid: true}})
+	assert.Equal(t, "Ask 50.0%, Bid 50.0%", r.Actions().String())
 }
 
 func CountLogs(t *testing.T, r io.Reader) map[string]int {
@@ -62,8 +185,26 @@ func CountLogs(t *testing.T, r io.Reader) map[string]int {
 			break
 		}
 
-		t := m["type"].(string)
+		t, _ := m["type"].(string)
 		counts[t] = counts[t] + 1
 	}
 	return counts
 }
+
+// syncBuffer is a bytes.Buffer safe to write and read concurrently.
+type syncBuffer struct {
+	lk  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
@@ -0,0 +1,197 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metrics "github.com/filecoin-project/filecoin-network-sim/metrics"
+)
+
+// Op is a kind of daemon interaction, with its own timeout.
+type Op string
+
+const (
+	OpMine      = Op("mine")      // mining a block
+	OpMiner     = Op("miner")     // creating a miner identity
+	OpConnect   = Op("connect")   // swarm connect and disconnect
+	OpPayment   = Op("payment")   // checking a balance and sending filecoin
+	OpAsk       = Op("ask")       // adding an ask
+	OpBid       = Op("bid")       // adding a bid
+	OpOrderbook = Op("orderbook") // querying the orderbook
+	OpImport    = Op("import")    // importing a file into a client
+	OpDeal      = Op("deal")      // proposing a deal
+	OpRetrieve  = Op("retrieve")  // fetching the data of a deal
+)
+
+var Ops = []Op{OpMine, OpMiner, OpConnect, OpPayment, OpAsk, OpBid, OpOrderbook, OpImport, OpDeal, OpRetrieve}
+
+// Timeouts are how long each daemon interaction may take, before the sim
+// gives up on it, and kills the cli processes it left behind. 0 means no
+// timeout.
+type Timeouts struct {
+	Default time.Duration
+	Ops     map[Op]time.Duration // overrides Default
+}
+
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Default: time.Minute,
+		Ops: map[Op]time.Duration{
+			OpConnect:  30 * time.Second,
+			OpDeal:     2 * time.Minute,
+			OpRetrieve: 2 * time.Minute,
+		},
+	}
+}
+
+// For returns the timeout of op.
+func (t Timeouts) For(op Op) time.Duration {
+	if d, ok := t.Ops[op]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// Max returns the longest timeout of any op.
+func (t Timeouts) Max() time.Duration {
+	max := t.Default
+	for _, d := range t.Ops {
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// String returns the timeouts as written for Set, default first.
+func (t *Timeouts) String() string {
+	parts := []string{t.Default.String()}
+	var ops []string
+	for op := range t.Ops {
+		ops = append(ops, string(op))
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		parts = append(parts, fmt.Sprintf("%s=%s", op, t.Ops[Op(op)]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses timeouts written like "30s" (the default) or "deal=2m",
+// comma separated, over the current ones. It is a flag.Value, so a flag
+// can be given several times.
+func (t *Timeouts) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		op, dur := "", part
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			op, dur = part[:i], part[i+1:]
+		}
+
+		d, err := time.ParseDuration(dur)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q, want a positive duration", part)
+		}
+
+		if op == "" {
+			t.Default = d
+			continue
+		}
+		if !knownOp(Op(op)) {
+			return fmt.Errorf("unknown timeout op %q, want one of %s", op, Ops)
+		}
+		if t.Ops == nil {
+			t.Ops = make(map[Op]time.Duration)
+		}
+		t.Ops[Op(op)] = d
+	}
+	return nil
+}
+
+func knownOp(op Op) bool {
+	for _, o := range Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTimeouts sets the timeouts of daemon interactions. The default is
+// DefaultTimeouts.
+func (n *Network) SetTimeouts(t Timeouts) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.timeouts = t
+}
+
+func (n *Network) Timeouts() Timeouts {
+	n.lk.RLock()
+	defer n.lk.RUnlock()
+	return n.timeouts
+}
+
+// TimeoutCounts returns how many interactions of each op timed out.
+func (n *Network) TimeoutCounts() map[Op]uint64 {
+	n.lk.RLock()
+	defer n.lk.RUnlock()
+
+	counts := make(map[Op]uint64, len(n.timedOut))
+	for op, c := range n.timedOut {
+		counts[op] = c
+	}
+	return counts
+}
+
+// Latencies returns how long the interactions of each op took, timed out
+// ones included.
+func (n *Network) Latencies() map[Op]metrics.HistogramSnapshot {
+	n.lk.RLock()
+	defer n.lk.RUnlock()
+
+	l := make(map[Op]metrics.HistogramSnapshot, len(n.latencies))
+	for op, h := range n.latencies {
+		l[op] = h.Snapshot()
+	}
+	return l
+}
+
+func (n *Network) observeLatency(op Op, d time.Duration) {
+	n.lk.Lock()
+	h, ok := n.latencies[op]
+	if !ok {
+		h = metrics.NewHistogram(metrics.LatencyBuckets)
+		n.latencies[op] = h
+	}
+	n.lk.Unlock()
+
+	h.ObserveDuration(d)
+}
+
+// do runs f, an interaction with node, with the timeout of op, and
+// records its latency. If it times out, do counts it. Backends kill the
+// process of a call when its ctx is done.
+func (n *Network) do(ctx context.Context, op Op, node *Node, f func(ctx context.Context) error) error {
+	start := time.Now()
+	defer func() { n.observeLatency(op, time.Since(start)) }()
+
+	d := n.Timeouts().For(op)
+	if d <= 0 {
+		return f(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	err := f(ctx)
+	if ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+
+	n.lk.Lock()
+	n.timedOut[op]++
+	n.lk.Unlock()
+
+	return fmt.Errorf("[NET]\t %s on node %s timed out after %s", op, node.ID, d)
+}
@@ -0,0 +1,64 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutsSet(t *testing.T) {
+	to := DefaultTimeouts()
+	require.NoError(t, to.Set("30s"))
+	require.NoError(t, to.Set("deal=5m,mine=10s"))
+	assert.Equal(t, 30*time.Second, to.For(OpAsk))
+	assert.Equal(t, 5*time.Minute, to.For(OpDeal))
+	assert.Equal(t, 10*time.Second, to.For(OpMine))
+	assert.Equal(t, 5*time.Minute, to.Max())
+	assert.Equal(t, "30s,connect=30s,deal=5m0s,mine=10s,retrieve=2m0s", to.String())
+
+	assert.Error(t, to.Set("forever"))
+	assert.Error(t, to.Set("-1s"))
+	assert.Error(t, to.Set("nap=1s"))
+}
+
+// hangingBackend is a fake node whose mining hangs, like a stuck cli.
+type hangingBackend struct {
+	NodeBackend
+	hang bool
+}
+
+func (b *hangingBackend) MiningOnce(ctx context.Context) error {
+	if !b.hang {
+		return b.NodeBackend.MiningOnce(ctx)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestNetworkTimeouts(t *testing.T) {
+	chain := NewFakeChain()
+	net := NewNetworkWithBackend(TempDir(t), func(repoDir string) (NodeBackend, error) {
+		b, err := chain.NewBackend(repoDir)
+		return &hangingBackend{NodeBackend: b}, err
+	})
+	defer net.ShutdownAll()
+	ReadLogTypes(net.Logs().Reader())
+
+	nd, err := net.AddNode(MinerNodeType)
+	require.NoError(t, err)
+	nd.NodeBackend.(*hangingBackend).hang = true
+
+	net.SetTimeouts(Timeouts{Default: time.Minute, Ops: map[Op]time.Duration{OpMine: 10 * time.Millisecond}})
+	assert.Error(t, net.MineOnce(context.Background(), nd))
+	assert.Error(t, net.MineOnce(context.Background(), nd))
+	assert.Equal(t, map[Op]uint64{OpMine: 2}, net.TimeoutCounts())
+
+	// other errors are not timeouts.
+	nd.NodeBackend.(*hangingBackend).hang = false
+	require.NoError(t, net.CrashNode(nd))
+	assert.Error(t, net.MineOnce(context.Background(), nd))
+	assert.Equal(t, map[Op]uint64{OpMine: 2}, net.TimeoutCounts())
+}
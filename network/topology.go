@@ -0,0 +1,377 @@
+package network
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Edge is a connection between two nodes.
+type Edge struct {
+	A, B *Node
+}
+
+// Topology decides which connections nodes make when they join a network.
+type Topology interface {
+	// Edges returns the edges to form when the nodes in joining join a
+	// network of the nodes in existing. Both are in join order. The
+	// initial nodes of a sim join together, into an empty network.
+	Edges(rng *rand.Rand, existing, joining []*Node) []Edge
+
+	// String returns the topology as written for ParseTopology.
+	String() string
+}
+
+// ParseTopology parses a topology written like "ring" or "kregular:4":
+//
+//	mesh                 every node connects to every other node
+//	ring                 each node connects to the next one, in a ring
+//	kregular:<k>         each node connects to k random nodes
+//	er:<p>               Erdős–Rényi: each pair of nodes connects with probability p
+//	smallworld:<k>,<b>   Watts–Strogatz: a ring of k neighbours, each edge rewired with probability b
+//	bootstrap:<h>[,<l>]  the first h nodes are hubs, all others connect to l random hubs (default 1)
+func ParseTopology(s string) (Topology, error) {
+	name, params := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name, params = s[:i], s[i+1:]
+	}
+
+	var ps []string
+	if params != "" {
+		ps = strings.Split(params, ",")
+	}
+	bad := func(usage string) error {
+		return fmt.Errorf("invalid topology %q, want %s", s, usage)
+	}
+
+	switch name {
+	case "mesh":
+		if len(ps) != 0 {
+			return nil, bad("mesh")
+		}
+		return Mesh{}, nil
+
+	case "ring":
+		if len(ps) != 0 {
+			return nil, bad("ring")
+		}
+		return Ring{}, nil
+
+	case "kregular":
+		if len(ps) != 1 {
+			return nil, bad("kregular:<k>")
+		}
+		k, err := strconv.Atoi(ps[0])
+		if err != nil || k < 1 {
+			return nil, bad("kregular:<k>, with k >= 1")
+		}
+		return KRegular{K: k}, nil
+
+	case "er":
+		if len(ps) != 1 {
+			return nil, bad("er:<p>")
+		}
+		p, err := strconv.ParseFloat(ps[0], 64)
+		if err != nil || p < 0 || p > 1 {
+			return nil, bad("er:<p>, with p in [0,1]")
+		}
+		return ErdosRenyi{P: p}, nil
+
+	case "smallworld":
+		if len(ps) != 2 {
+			return nil, bad("smallworld:<k>,<b>")
+		}
+		k, err1 := strconv.Atoi(ps[0])
+		b, err2 := strconv.ParseFloat(ps[1], 64)
+		if err1 != nil || err2 != nil || k < 2 || b < 0 || b > 1 {
+			return nil, bad("smallworld:<k>,<b>, with k >= 2 and b in [0,1]")
+		}
+		return SmallWorld{K: k, Beta: b}, nil
+
+	case "bootstrap":
+		if len(ps) != 1 && len(ps) != 2 {
+			return nil, bad("bootstrap:<h>[,<l>]")
+		}
+		h, err := strconv.Atoi(ps[0])
+		if err != nil || h < 1 {
+			return nil, bad("bootstrap:<h>[,<l>], with h >= 1")
+		}
+		l := 1
+		if len(ps) == 2 {
+			l, err = strconv.Atoi(ps[1])
+			if err != nil || l < 1 {
+				return nil, bad("bootstrap:<h>[,<l>], with l >= 1")
+			}
+		}
+		return Bootstrap{Hubs: h, Links: l}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown topology: %q", s)
+	}
+}
+
+// edgeSet collects edges, without duplicates or self loops.
+type edgeSet struct {
+	edges []Edge
+	seen  map[[2]*Node]bool
+}
+
+func (s *edgeSet) add(a, b *Node) {
+	if a == b {
+		return
+	}
+	if s.seen == nil {
+		s.seen = make(map[[2]*Node]bool)
+	}
+	if s.seen[[2]*Node{a, b}] || s.seen[[2]*Node{b, a}] {
+		return
+	}
+	s.seen[[2]*Node{a, b}] = true
+	s.edges = append(s.edges, Edge{a, b})
+}
+
+func (s *edgeSet) has(a, b *Node) bool {
+	return s.seen[[2]*Node{a, b}] || s.seen[[2]*Node{b, a}]
+}
+
+func (s *edgeSet) degree(n *Node) int {
+	d := 0
+	for _, e := range s.edges {
+		if e.A == n || e.B == n {
+			d++
+		}
+	}
+	return d
+}
+
+// Mesh connects every node to every other node.
+type Mesh struct{}
+
+func (Mesh) Edges(rng *rand.Rand, existing, joining []*Node) []Edge {
+	var s edgeSet
+	all := append(append([]*Node{}, existing...), joining...)
+	for i, a := range joining {
+		for _, b := range all[:len(existing)+i] {
+			s.add(a, b)
+		}
+	}
+	return s.edges
+}
+
+func (Mesh) String() string { return "mesh" }
+
+// Ring connects each node to the next one, in join order, and the last
+// node to the first. Nodes joining a ring later connect to two nodes next
+// to each other, whose edge stays.
+type Ring struct{}
+
+func (Ring) Edges(rng *rand.Rand, existing, joining []*Node) []Edge {
+	var s edgeSet
+	if len(existing) == 0 {
+		for i := range joining {
+			s.add(joining[i], joining[(i+1)%len(joining)])
+		}
+		return s.edges
+	}
+
+	all := append([]*Node{}, existing...)
+	for _, n := range joining {
+		i := rng.Intn(len(all))
+		s.add(n, all[i])
+		s.add(n, all[(i+1)%len(all)])
+		all = append(all, n)
+	}
+	return s.edges
+}
+
+func (Ring) String() string { return "ring" }
+
+// KRegular connects each node to K random nodes. The initial nodes form a
+// random K-regular graph, when there is one. Nodes joining later connect
+// to K random nodes, so their degrees drift above K.
+type KRegular struct {
+	K int
+}
+
+func (t KRegular) Edges(rng *rand.Rand, existing, joining []*Node) []Edge {
+	if len(existing) == 0 {
+		return randomRegular(rng, joining, t.K)
+	}
+
+	var s edgeSet
+	all := append([]*Node{}, existing...)
+	for _, n := range joining {
+		for _, i := range rng.Perm(len(all)) {
+			if s.degree(n) >= t.K {
+				break
+			}
+			s.add(n, all[i])
+		}
+		all = append(all, n)
+	}
+	return s.edges
+}
+
+func (t KRegular) String() string { return fmt.Sprintf("kregular:%d", t.K) }
+
+// randomRegular returns a random k-regular graph over nodes, by pairing
+// up k stubs per node at random. If that keeps failing, or no k-regular
+// graph exists, it falls back to a shuffled ring lattice, which is as
+// close to k-regular as the number of nodes allows.
+func randomRegular(rng *rand.Rand, nodes []*Node, k int) []Edge {
+	n := len(nodes)
+	if k >= n {
+		return Mesh{}.Edges(rng, nil, nodes)
+	}
+
+	if n*k%2 == 0 {
+	attempts:
+		for try := 0; try < 100; try++ {
+			stubs := make([]*Node, 0, n*k)
+			for _, nd := range nodes {
+				for i := 0; i < k; i++ {
+					stubs = append(stubs, nd)
+				}
+			}
+			rng.Shuffle(len(stubs), func(i, j int) { stubs[i], stubs[j] = stubs[j], stubs[i] })
+
+			var s edgeSet
+			for i := 0; i < len(stubs); i += 2 {
+				a, b := stubs[i], stubs[i+1]
+				if a == b || s.has(a, b) {
+					continue attempts
+				}
+				s.add(a, b)
+			}
+			return s.edges
+		}
+	}
+
+	shuffled := append([]*Node{}, nodes...)
+	rng.Shuffle(n, func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return ringLattice(shuffled, k).edges
+}
+
+// ringLattice connects each node to the k/2 nodes after it, in a ring,
+// and if k is odd, to the node opposite.
+func ringLattice(nodes []*Node, k int) *edgeSet {
+	var s edgeSet
+	n := len(nodes)
+	for i := range nodes {
+		for j := 1; j <= k/2; j++ {
+			s.add(nodes[i], nodes[(i+j)%n])
+		}
+		if k%2 == 1 {
+			s.add(nodes[i], nodes[(i+n/2)%n])
+		}
+	}
+	return &s
+}
+
+// ErdosRenyi connects each pair of nodes with probability P.
+type ErdosRenyi struct {
+	P float64
+}
+
+func (t ErdosRenyi) Edges(rng *rand.Rand, existing, joining []*Node) []Edge {
+	var s edgeSet
+	all := append(append([]*Node{}, existing...), joining...)
+	for i, a := range joining {
+		for _, b := range all[:len(existing)+i] {
+			if rng.Float64() < t.P {
+				s.add(a, b)
+			}
+		}
+	}
+	return s.edges
+}
+
+func (t ErdosRenyi) String() string {
+	return "er:" + strconv.FormatFloat(t.P, 'g', -1, 64)
+}
+
+// SmallWorld is the Watts–Strogatz model: the initial nodes form a ring
+// where each node connects to its K nearest neighbours, and then each edge
+// is rewired to a random node with probability Beta. Nodes joining later
+// connect to the K/2 nodes that joined last, rewired the same way.
+type SmallWorld struct {
+	K    int
+	Beta float64
+}
+
+func (t SmallWorld) Edges(rng *rand.Rand, existing, joining []*Node) []Edge {
+	var lattice []Edge
+	all := append(append([]*Node{}, existing...), joining...)
+	if len(existing) == 0 {
+		lattice = ringLattice(joining, t.K).edges
+	} else {
+		for i := len(existing); i < len(all); i++ {
+			for j := 1; j <= t.K/2 && j <= i; j++ {
+				lattice = append(lattice, Edge{all[i], all[i-j]})
+			}
+		}
+	}
+
+	var s edgeSet
+	for _, e := range lattice {
+		b := e.B
+		if rng.Float64() < t.Beta {
+			// rewire to a node it is not connected to yet, if any.
+			for _, i := range rng.Perm(len(all)) {
+				if all[i] != e.A && !s.has(e.A, all[i]) {
+					b = all[i]
+					break
+				}
+			}
+		}
+		s.add(e.A, b)
+	}
+	return s.edges
+}
+
+func (t SmallWorld) String() string {
+	return fmt.Sprintf("smallworld:%d,%s", t.K, strconv.FormatFloat(t.Beta, 'g', -1, 64))
+}
+
+// Bootstrap is a hub and spoke model, like a network with bootstrap
+// nodes: the first Hubs nodes to join are hubs, connected to each other,
+// and every other node connects to Links random hubs.
+type Bootstrap struct {
+	Hubs  int
+	Links int // 0 means 1
+}
+
+func (t Bootstrap) Edges(rng *rand.Rand, existing, joining []*Node) []Edge {
+	var s edgeSet
+	all := append(append([]*Node{}, existing...), joining...)
+	hubs := all
+	if len(hubs) > t.Hubs {
+		hubs = hubs[:t.Hubs]
+	}
+
+	for i := len(existing); i < len(all); i++ {
+		n := all[i]
+		if i < len(hubs) {
+			for _, h := range hubs[:i] {
+				s.add(n, h)
+			}
+			continue
+		}
+
+		links := rng.Perm(len(hubs))
+		if t.Links < 1 {
+			links = links[:1]
+		} else if len(links) > t.Links {
+			links = links[:t.Links]
+		}
+		for _, h := range links {
+			s.add(n, hubs[h])
+		}
+	}
+	return s.edges
+}
+
+func (t Bootstrap) String() string {
+	return fmt.Sprintf("bootstrap:%d,%d", t.Hubs, t.Links)
+}
@@ -0,0 +1,138 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNodes(num int) []*Node {
+	nodes := make([]*Node, num)
+	for i := range nodes {
+		nodes[i] = &Node{ID: fmt.Sprintf("n%d", i)}
+	}
+	return nodes
+}
+
+func degrees(edges []Edge) map[*Node]int {
+	d := map[*Node]int{}
+	for _, e := range edges {
+		d[e.A]++
+		d[e.B]++
+	}
+	return d
+}
+
+func checkSimple(t *testing.T, edges []Edge) {
+	seen := map[[2]*Node]bool{}
+	for _, e := range edges {
+		assert.True(t, e.A != e.B, "self loop")
+		assert.False(t, seen[[2]*Node{e.A, e.B}] || seen[[2]*Node{e.B, e.A}], "duplicate edge")
+		seen[[2]*Node{e.A, e.B}] = true
+	}
+}
+
+func TestParseTopology(t *testing.T) {
+	for _, s := range []string{"mesh", "ring", "kregular:4", "er:0.25", "smallworld:4,0.1", "bootstrap:2,1"} {
+		topo, err := ParseTopology(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, s, topo.String())
+	}
+
+	topo, err := ParseTopology("bootstrap:3")
+	require.NoError(t, err)
+	assert.Equal(t, Bootstrap{Hubs: 3, Links: 1}, topo)
+
+	for _, s := range []string{"", "star", "mesh:1", "kregular", "kregular:0", "er:2", "smallworld:4", "smallworld:1,0.5", "bootstrap:0"} {
+		_, err := ParseTopology(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestTopologyInitialEdges(t *testing.T) {
+	rng := NewRand(1)
+	nodes := testNodes(10)
+
+	cases := []struct {
+		topo   Topology
+		edges  int
+		degree int // of every node, if > 0
+	}{
+		{Mesh{}, 45, 9},
+		{Ring{}, 10, 2},
+		{KRegular{K: 3}, 15, 3},
+		{KRegular{K: 4}, 20, 4},
+		{ErdosRenyi{P: 0}, 0, 0},
+		{ErdosRenyi{P: 1}, 45, 9},
+		{SmallWorld{K: 4, Beta: 0}, 20, 4},
+		{SmallWorld{K: 4, Beta: 0.5}, 20, 0},
+		{Bootstrap{Hubs: 2, Links: 1}, 9, 0},
+	}
+
+	for _, c := range cases {
+		edges := c.topo.Edges(rng, nil, nodes)
+		checkSimple(t, edges)
+		assert.Len(t, edges, c.edges, c.topo.String())
+		if c.degree > 0 {
+			for _, n := range nodes {
+				assert.Equal(t, c.degree, degrees(edges)[n], c.topo.String())
+			}
+		}
+	}
+
+	// spokes only connect to hubs.
+	for _, e := range (Bootstrap{Hubs: 2, Links: 2}).Edges(rng, nil, nodes) {
+		assert.True(t, e.B == nodes[0] || e.B == nodes[1])
+	}
+}
+
+func TestTopologyJoinEdges(t *testing.T) {
+	rng := NewRand(1)
+	nodes := testNodes(8)
+	existing, joining := nodes[:6], nodes[6:]
+
+	for _, topo := range []Topology{Mesh{}, Ring{}, KRegular{K: 3}, ErdosRenyi{P: 0.5}, SmallWorld{K: 4, Beta: 0.2}, Bootstrap{Hubs: 2}} {
+		edges := topo.Edges(rng, existing, joining)
+		checkSimple(t, edges)
+
+		d := degrees(edges)
+		for _, e := range edges {
+			// every edge has a joining node.
+			assert.True(t, e.A == nodes[6] || e.A == nodes[7] || e.B == nodes[6] || e.B == nodes[7], topo.String())
+		}
+		if _, ok := topo.(ErdosRenyi); !ok {
+			assert.True(t, d[nodes[6]] > 0, topo.String())
+			assert.True(t, d[nodes[7]] > 0, topo.String())
+		}
+	}
+}
+
+func TestNetworkTopology(t *testing.T) {
+	net := NewTestNetwork(t)
+	defer net.ShutdownAll()
+	net.SetTopology(Ring{})
+
+	types := ReadLogTypes(net.Logs().Reader())
+	require.NoError(t, net.AddNodes(ClientNodeType, 5))
+
+	// a ring of 5 has 5 edges.
+	counts := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for !countsAtLeast(counts, map[string]int{"Connected": 5, "ClientJoins": 5}) {
+		select {
+		case typ := <-types:
+			counts[typ]++
+		case <-timeout:
+			t.Fatalf("timed out waiting for logs. saw: %v", counts)
+		}
+	}
+
+	select {
+	case typ := <-types:
+		assert.NotEqual(t, "Connected", typ)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
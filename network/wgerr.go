@@ -1,28 +1,87 @@
 package network
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 )
 
-func AsyncErrs(num int, each func(i int) error) []error {
-	errc := make(chan error, num)
+// IndexedErr is the error of the i-th task of a batch.
+type IndexedErr struct {
+	Index int
+	Err   error
+}
+
+func (e IndexedErr) Error() string {
+	return fmt.Sprintf("[%d] %s", e.Index, e.Err)
+}
+
+func (e IndexedErr) Unwrap() error {
+	return e.Err
+}
+
+// MultiErr is the errors of the tasks of a batch that failed, in index
+// order.
+type MultiErr []IndexedErr
+
+func (m MultiErr) Error() string {
+	msgs := make([]string, len(m))
+	for i, e := range m {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Indexes returns the indexes of the tasks that failed.
+func (m MultiErr) Indexes() []int {
+	idx := make([]int, len(m))
+	for i, e := range m {
+		idx[i] = e.Index
+	}
+	return idx
+}
+
+// AsyncErrs runs each(i) for every i in [0, num), at most limit at a time
+// (all at once if limit < 1). It returns a MultiErr of the ones that
+// failed, or nil if none did.
+func AsyncErrs(num, limit int, each func(i int) error) error {
+	if limit < 1 || limit > num {
+		limit = num
+	}
+
+	tasks := make(chan int)
+	errc := make(chan IndexedErr, num)
 	var wg sync.WaitGroup
 
-	for i := 0; i < num; i++ {
+	for w := 0; w < limit; w++ {
 		wg.Add(1)
-		go func(j int) {
+		go func() {
 			defer wg.Done()
-			errc <- each(j)
-		}(i)
+			for i := range tasks {
+				if err := each(i); err != nil {
+					errc <- IndexedErr{i, err}
+				}
+			}
+		}()
 	}
 
+	for i := 0; i < num; i++ {
+		tasks <- i
+	}
+	close(tasks)
+
 	wg.Wait()
 	close(errc)
 
-	var errs []error
-	for _, e := range errs {
+	var errs MultiErr
+	for e := range errc {
 		errs = append(errs, e)
 	}
+	if len(errs) == 0 {
+		return nil
+	}
 
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Index < errs[j].Index })
 	return errs
 }
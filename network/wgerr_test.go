@@ -0,0 +1,49 @@
+package network
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncErrs(t *testing.T) {
+	err := AsyncErrs(10, 3, func(i int) error {
+		if i%4 == 1 {
+			return fmt.Errorf("odd one out")
+		}
+		return nil
+	})
+	require.Error(t, err)
+	merr, ok := err.(MultiErr)
+	require.True(t, ok)
+	assert.Equal(t, []int{1, 5, 9}, merr.Indexes())
+	assert.Equal(t, "[1] odd one out; [5] odd one out; [9] odd one out", err.Error())
+
+	assert.NoError(t, AsyncErrs(10, 0, func(i int) error { return nil }))
+	assert.NoError(t, AsyncErrs(0, 3, func(i int) error { return fmt.Errorf("no tasks") }))
+}
+
+func TestAsyncErrsLimit(t *testing.T) {
+	var lk sync.Mutex
+	running, max := 0, 0
+	AsyncErrs(20, 4, func(i int) error {
+		lk.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		lk.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		lk.Lock()
+		running--
+		lk.Unlock()
+		return nil
+	})
+	assert.Equal(t, 4, max)
+}
@@ -1,33 +1,37 @@
 package network
 
 import (
+	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"path/filepath"
 )
 
-func RandomFile(filesdir, tmpdir string) (string, error) {
-	f, err := RandomFileTestDir(filesdir)
+func RandomFile(rng *rand.Rand, filesdir, tmpdir string) (string, error) {
+	f, err := RandomFileTestDir(rng, filesdir)
 	if err == nil {
 		return f, nil
 	}
-	return RandomFileText(tmpdir)
+	return RandomFileText(rng, tmpdir)
 }
 
-func RandomFileTestDir(dir string) (string, error) {
+func RandomFileTestDir(rng *rand.Rand, dir string) (string, error) {
 	// check if there is a testdir locally
 	fs, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return "", err // failed to read testfiles
 	}
+	if len(fs) == 0 {
+		return "", fmt.Errorf("no test files in %s", dir)
+	}
 
 	// random entry
-	fi := fs[rand.Intn(len(fs))]
+	fi := fs[rng.Intn(len(fs))]
 	fp := filepath.Join(dir, fi.Name())
 	return fp, nil
 }
 
-func RandomFileText(tmpdir string) (string, error) {
+func RandomFileText(rng *rand.Rand, tmpdir string) (string, error) {
 	if tmpdir == "" {
 		tmpdir = "/tmp"
 	}
@@ -39,7 +43,7 @@ func RandomFileText(tmpdir string) (string, error) {
 	defer f.Close()
 
 	// write to it
-	rf := randomFiles[rand.Intn(len(randomFiles))]
+	rf := randomFiles[rng.Intn(len(randomFiles))]
 	_, err = f.Write([]byte(rf))
 	if err != nil {
 		return "", err
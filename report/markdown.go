@@ -0,0 +1,117 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// maxGrowthRows is how many points of the chain growth the markdown shows.
+const maxGrowthRows = 20
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	buf, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// WriteMarkdown writes the report as a markdown document, with a table
+// per section.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b bytes.Buffer
+	p := func(format string, a ...interface{}) { fmt.Fprintf(&b, format, a...) }
+
+	p("# Sim report\n\n")
+	p("%s to %s (%s), %d events.\n\n", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), round(r.Duration), r.Events)
+
+	c := r.Chain
+	p("## Chain\n\n")
+	p("| height | blocks | orphans | orphan rate | forks | max fork depth |\n")
+	p("|---|---|---|---|---|---|\n")
+	p("| %d | %d | %d | %.1f%% | %d | %d |\n\n", c.Height, c.Blocks, c.Orphans, 100*c.OrphanRate, c.Forks, c.MaxDepth)
+
+	if len(c.ForkDepths) > 0 {
+		var depths []int
+		for d := range c.ForkDepths {
+			depths = append(depths, d)
+		}
+		sort.Ints(depths)
+
+		p("| fork depth | forks |\n|---|---|\n")
+		for _, d := range depths {
+			p("| %d | %d |\n", d, c.ForkDepths[d])
+		}
+		p("\n")
+	}
+
+	if len(c.Growth) > 0 {
+		p("| time | height |\n|---|---|\n")
+		for _, pt := range sample(c.Growth, maxGrowthRows) {
+			p("| %s | %d |\n", round(pt.At), pt.Height)
+		}
+		p("\n")
+	}
+
+	p("## Miners\n\n")
+	p("| miner | blocks | won | rewards |\n|---|---|---|---|\n")
+	for _, m := range r.Miners {
+		p("| %s | %d | %d | %d |\n", m.Addr, m.Blocks, m.Won, m.Rewards)
+	}
+	p("\n")
+
+	m := r.Market
+	p("## Market\n\n")
+	p("| | count | total size |\n|---|---|---|\n")
+	p("| asks | %d | %d |\n", m.Asks, m.AskSize)
+	p("| bids | %d | %d |\n", m.Bids, m.BidSize)
+	p("| deals | %d | %d |\n", m.Deals, m.DealSize)
+	p("| finished deals | %d | |\n\n", m.FinishedDeals)
+	if len(m.Prices) > 0 {
+		p("| matched price | deals |\n|---|---|\n")
+		for _, pc := range m.Prices {
+			p("| %s | %d |\n", pc.Price, pc.Count)
+		}
+		p("\n")
+	}
+
+	pay := r.Payments
+	p("## Payments\n\n")
+	p("%d payments, of %d in total, %.1f per minute.\n\n", pay.Count, pay.Value, pay.PerMinute)
+
+	p("## Nodes\n\n")
+	p("| node | type | joined | left | uptime | up | faults |\n|---|---|---|---|---|---|---|\n")
+	for _, n := range r.Nodes {
+		left := ""
+		if n.Left > 0 {
+			left = round(n.Left).String()
+		}
+		p("| %s | %s | %s | %s | %s | %.0f%% | %d |\n", n.Addr, n.Type, round(n.Joined), left, round(n.Uptime), 100*n.UpRatio, n.Faults)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Second / 10)
+}
+
+// sample returns at most n points, evenly spread, always with the last.
+func sample(pts []HeightPoint, n int) []HeightPoint {
+	if len(pts) <= n {
+		return pts
+	}
+
+	out := make([]HeightPoint, 0, n)
+	for i := 0; i < n-1; i++ {
+		out = append(out, pts[i*len(pts)/(n-1)])
+	}
+	return append(out, pts[len(pts)-1])
+}
@@ -0,0 +1,388 @@
+// Package report summarizes a sim run from its events: how the chain
+// grew and forked, who mined it, what the market and payments did, and
+// how long each node was up. It is for comparing runs, e.g. with
+// different fork settings.
+package report
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	events "github.com/filecoin-project/filecoin-network-sim/logs/events"
+)
+
+// Report is the summary of a run.
+type Report struct {
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"` // nanoseconds
+	Events   int           `json:"events"`
+
+	Chain    Chain    `json:"chain"`
+	Miners   []Miner  `json:"miners"`
+	Market   Market   `json:"market"`
+	Payments Payments `json:"payments"`
+	Nodes    []Node   `json:"nodes"`
+}
+
+// Chain is how the chain grew. The main chain is the one ending at the
+// highest block, the first mined of its height. Blocks mined but not on
+// it are orphans. A fork is a branch of orphans off the main chain, and
+// its depth is the length of the branch.
+type Chain struct {
+	Height     uint64        `json:"height"`
+	Blocks     int           `json:"blocks"`
+	Orphans    int           `json:"orphans"`
+	OrphanRate float64       `json:"orphanRate"`
+	Forks      int           `json:"forks"`
+	ForkDepths map[int]int   `json:"forkDepths"` // number of forks of each depth
+	MaxDepth   int           `json:"maxForkDepth"`
+	Growth     []HeightPoint `json:"growth"`
+}
+
+// HeightPoint is the chain height At a time into the run.
+type HeightPoint struct {
+	At     time.Duration `json:"at"` // nanoseconds
+	Height uint64        `json:"height"`
+}
+
+// Miner is what one miner mined. Won blocks are on the main chain, and
+// only they earn rewards.
+type Miner struct {
+	Addr    string `json:"addr"`
+	Blocks  int    `json:"blocks"`
+	Won     int    `json:"won"`
+	Rewards uint64 `json:"rewards"`
+}
+
+// Market is the storage market activity. Sizes and prices are as the
+// orderbook reports them.
+type Market struct {
+	Asks          int          `json:"asks"`
+	AskSize       uint64       `json:"askSize"`
+	Bids          int          `json:"bids"`
+	BidSize       uint64       `json:"bidSize"`
+	Deals         int          `json:"deals"`
+	DealSize      uint64       `json:"dealSize"`
+	FinishedDeals int          `json:"finishedDeals"`
+	Prices        []PriceCount `json:"matchedPrices"` // of deals, by price
+}
+
+// PriceCount is how many deals were made at Price.
+type PriceCount struct {
+	Price string `json:"price"`
+	Count int    `json:"count"`
+}
+
+type Payments struct {
+	Count     int     `json:"count"`
+	Value     uint64  `json:"value"`
+	PerMinute float64 `json:"perMinute"`
+}
+
+// Node is how long a node was up, between joining and leaving (or the end
+// of the run), not counting the time it was crashed or frozen.
+type Node struct {
+	Addr    string        `json:"addr"`
+	Type    string        `json:"type"`
+	Joined  time.Duration `json:"joined"` // nanoseconds into the run
+	Left    time.Duration `json:"left,omitempty"`
+	Uptime  time.Duration `json:"uptime"`
+	Faults  int           `json:"faults"` // crashes and freezes
+	UpRatio float64       `json:"upRatio"`
+}
+
+// Builder is an io.Writer that collects the sim events written to it, one
+// per line, to build a Report. Lines that are not events are ignored.
+type Builder struct {
+	lk   sync.Mutex
+	line []byte // partial line, until its newline is written
+
+	start, end time.Time
+	events     int
+
+	blocks []*block // in the order they were mined
+	byCid  map[string]*block
+	growth []heightAt
+
+	market   Market
+	prices   map[string]int
+	payments Payments
+	nodes    []*node
+	byAddr   map[string]*node
+}
+
+type block struct {
+	cid     string
+	parent  string
+	height  uint64
+	miner   string
+	reward  uint64
+	onChain bool
+}
+
+// heightAt is the chain height at a time. Times are kept as they are, and
+// made offsets into the run in Report: the start of the run moves earlier
+// when events arrive out of order.
+type heightAt struct {
+	at     time.Time
+	height uint64
+}
+
+type node struct {
+	Node
+	joined, left time.Time // left is zero until the node leaves
+	upSince      time.Time // zero while down
+}
+
+func NewBuilder() *Builder {
+	return &Builder{
+		byCid:  make(map[string]*block),
+		prices: make(map[string]int),
+		byAddr: make(map[string]*node),
+	}
+}
+
+func (b *Builder) Write(buf []byte) (int, error) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	b.line = append(b.line, buf...)
+	for {
+		i := bytes.IndexByte(b.line, '\n')
+		if i < 0 {
+			return len(buf), nil
+		}
+		line := b.line[:i]
+		b.line = b.line[i+1:]
+
+		if e, err := events.Decode(line); err == nil {
+			b.add(e)
+		}
+	}
+}
+
+// add should be called with the lock held.
+func (b *Builder) add(e events.Event) {
+	env := e.Header()
+	t := env.Time
+	if b.start.IsZero() || t.Before(b.start) {
+		b.start = t
+	}
+	if t.After(b.end) {
+		b.end = t
+	}
+	b.events++
+
+	switch e := e.(type) {
+	case *events.NewBlockMined:
+		if _, ok := b.byCid[e.Block]; ok {
+			return
+		}
+		blk := &block{cid: e.Block, height: e.Height, miner: env.From, reward: parseUint(e.Reward)}
+		if len(e.Parents) > 0 {
+			blk.parent = e.Parents[0]
+		}
+		b.blocks = append(b.blocks, blk)
+		b.byCid[e.Block] = blk
+
+		if len(b.growth) == 0 || e.Height > b.growth[len(b.growth)-1].height {
+			b.growth = append(b.growth, heightAt{t, e.Height})
+		}
+
+	case *events.AddAsk:
+		b.market.Asks++
+		b.market.AskSize += parseUint(e.Ask.Size.String())
+	case *events.AddBid:
+		b.market.Bids++
+		b.market.BidSize += parseUint(e.Bid.Size.String())
+	case *events.MakeDeal:
+		b.market.Deals++
+		b.market.DealSize += parseUint(e.Size.String())
+		b.prices[e.Price.String()]++
+	case *events.SendPayment:
+		b.payments.Count++
+		b.payments.Value += parseUint(e.Value)
+
+	case *events.NetworkChurn:
+		switch env.Type {
+		case events.TypeMinerJoins, events.TypeClientJoins:
+			typ := "Miner"
+			if env.Type == events.TypeClientJoins {
+				typ = "Client"
+			}
+			n := &node{Node: Node{Addr: env.From, Type: typ}, joined: t, upSince: t}
+			b.nodes = append(b.nodes, n)
+			b.byAddr[env.From] = n
+		default:
+			if n, ok := b.byAddr[env.From]; ok {
+				n.down(t)
+				n.left = t
+				delete(b.byAddr, env.From)
+			}
+		}
+
+	case *events.NodeFault:
+		n, ok := b.byAddr[env.From]
+		if !ok {
+			return
+		}
+		switch env.Type {
+		case events.TypeNodeCrashed, events.TypeNodeFrozen:
+			n.down(t)
+			n.Faults++
+		case events.TypeNodeRestarted, events.TypeNodeThawed:
+			if n.upSince.IsZero() {
+				n.upSince = t
+			}
+		}
+	}
+
+	if env.Type == events.TypeFinishDeal {
+		b.market.FinishedDeals++
+	}
+}
+
+func (n *node) down(t time.Time) {
+	if !n.upSince.IsZero() {
+		n.Uptime += t.Sub(n.upSince)
+		n.upSince = time.Time{}
+	}
+}
+
+func parseUint(s string) uint64 {
+	v, _ := strconv.ParseUint(s, 10, 64)
+	return v
+}
+
+// Report returns the report of the events written so far.
+func (b *Builder) Report() *Report {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	r := &Report{
+		Start:    b.start,
+		End:      b.end,
+		Duration: b.end.Sub(b.start),
+		Events:   b.events,
+		Market:   b.market,
+		Payments: b.payments,
+	}
+	r.Chain = b.chain()
+	r.Miners = b.miners()
+
+	for price, c := range b.prices {
+		r.Market.Prices = append(r.Market.Prices, PriceCount{price, c})
+	}
+	sort.Slice(r.Market.Prices, func(i, j int) bool {
+		pi, pj := r.Market.Prices[i].Price, r.Market.Prices[j].Price
+		if parseUint(pi) != parseUint(pj) {
+			return parseUint(pi) < parseUint(pj)
+		}
+		return pi < pj
+	})
+
+	if minutes := r.Duration.Minutes(); minutes > 0 {
+		r.Payments.PerMinute = float64(r.Payments.Count) / minutes
+	}
+
+	for _, n := range b.nodes {
+		nr := n.Node
+		nr.Joined = n.joined.Sub(b.start)
+		if !n.upSince.IsZero() {
+			nr.Uptime += b.end.Sub(n.upSince)
+		}
+		end := r.Duration
+		if !n.left.IsZero() {
+			nr.Left = n.left.Sub(b.start)
+			end = nr.Left
+		}
+		if life := end - nr.Joined; life > 0 {
+			nr.UpRatio = float64(nr.Uptime) / float64(life)
+		}
+		r.Nodes = append(r.Nodes, nr)
+	}
+	return r
+}
+
+// chain marks the blocks on the main chain, and finds the forks off it.
+// should be called with the lock held.
+func (b *Builder) chain() Chain {
+	c := Chain{Blocks: len(b.blocks), ForkDepths: map[int]int{}}
+	for _, h := range b.growth {
+		c.Growth = append(c.Growth, HeightPoint{At: h.at.Sub(b.start), Height: h.height})
+	}
+
+	var head *block
+	for _, blk := range b.blocks {
+		blk.onChain = false
+		if head == nil || blk.height > head.height {
+			head = blk
+		}
+	}
+	for blk := head; blk != nil; blk = b.byCid[blk.parent] {
+		blk.onChain = true
+	}
+	if head != nil {
+		c.Height = head.height
+	}
+
+	// the depth of each orphan is the length of the longest branch of
+	// orphans from it. blocks are mined after their parents, so going
+	// backwards sees children first.
+	children := make(map[*block]int)
+	for i := len(b.blocks) - 1; i >= 0; i-- {
+		blk := b.blocks[i]
+		if blk.onChain {
+			continue
+		}
+		c.Orphans++
+
+		depth := children[blk] + 1
+		parent, ok := b.byCid[blk.parent]
+		if ok && !parent.onChain {
+			if depth > children[parent] {
+				children[parent] = depth
+			}
+			continue
+		}
+
+		// it branches off the main chain, or from a block we never saw.
+		c.Forks++
+		c.ForkDepths[depth]++
+		if depth > c.MaxDepth {
+			c.MaxDepth = depth
+		}
+	}
+
+	if c.Blocks > 0 {
+		c.OrphanRate = float64(c.Orphans) / float64(c.Blocks)
+	}
+	return c
+}
+
+// miners should be called with the lock held, after chain.
+func (b *Builder) miners() []Miner {
+	var miners []Miner
+	index := make(map[string]int)
+	for _, blk := range b.blocks {
+		i, ok := index[blk.miner]
+		if !ok {
+			i = len(miners)
+			index[blk.miner] = i
+			miners = append(miners, Miner{Addr: blk.miner})
+		}
+
+		miners[i].Blocks++
+		if blk.onChain {
+			miners[i].Won++
+			miners[i].Rewards += blk.reward
+		}
+	}
+
+	sort.SliceStable(miners, func(i, j int) bool { return miners[i].Won > miners[j].Won })
+	return miners
+}
@@ -0,0 +1,137 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	events "github.com/filecoin-project/filecoin-network-sim/logs/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	start := time.Date(2018, 4, 20, 19, 33, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	env := func(typ, from string, s int) events.Envelope {
+		return events.NewEnvelope(typ, from, "all", at(s))
+	}
+	mined := func(s int, miner, cid, parent string, height uint64) events.Event {
+		return &events.NewBlockMined{Envelope: env(events.TypeNewBlockMined, miner, s), Block: cid, Parents: []string{parent}, Height: height, Reward: "10"}
+	}
+
+	evts := []events.Event{
+		&events.NetworkChurn{Envelope: env(events.TypeMinerJoins, "m1", 0)},
+		&events.NetworkChurn{Envelope: env(events.TypeMinerJoins, "m2", 0)},
+		&events.NetworkChurn{Envelope: env(events.TypeClientJoins, "c1", 10)},
+
+		// m1 mines the main chain a-b-c-d. m2 forks off a with x-y, and
+		// off c with z.
+		mined(1, "m1", "a", "genesis", 1),
+		mined(2, "m1", "b", "a", 2),
+		mined(2, "m2", "x", "a", 2),
+		mined(3, "m2", "y", "x", 3),
+		mined(4, "m1", "c", "b", 3),
+		mined(5, "m1", "d", "c", 4),
+		mined(5, "m2", "z", "c", 4),
+		mined(5, "m2", "z", "c", 4), // seen twice
+
+		&events.AddAsk{Envelope: env(events.TypeAddAsk, "m1", 20), Ask: events.Ask{Size: "1000", Price: "5"}},
+		&events.AddBid{Envelope: env(events.TypeAddBid, "c1", 21), Bid: events.Bid{Size: "10", Price: "10"}},
+		&events.AddBid{Envelope: env(events.TypeAddBid, "c1", 22), Bid: events.Bid{Size: "20", Price: "10"}},
+		&events.MakeDeal{Envelope: env(events.TypeMakeDeal, "c1", 30), Size: "10", Price: "5"},
+		&events.MakeDeal{Envelope: env(events.TypeMakeDeal, "c1", 31), Size: "20", Price: "5"},
+		&events.SendPayment{Envelope: env(events.TypeSendPayment, "m1", 40), Value: "100"},
+
+		&events.NodeFault{Envelope: env(events.TypeNodeCrashed, "m2", 60)},
+		&events.NodeFault{Envelope: env(events.TypeNodeRestarted, "m2", 90)},
+		&events.NetworkChurn{Envelope: env(events.TypeClientLeaves, "c1", 70)},
+		&events.NetworkChurn{Envelope: env(events.TypeClientJoins, "c2", 100)},
+		&events.Healed{Envelope: env(events.TypeHealed, "network", 120)},
+	}
+
+	b := NewBuilder()
+	for _, e := range evts {
+		buf, err := json.Marshal(e)
+		require.NoError(t, err)
+		b.Write(append(buf, '\n'))
+	}
+	b.Write([]byte("not json\n"))
+
+	r := b.Report()
+	assert.Equal(t, 2*time.Minute, r.Duration)
+	assert.Equal(t, len(evts), r.Events)
+
+	c := r.Chain
+	assert.Equal(t, uint64(4), c.Height)
+	assert.Equal(t, 7, c.Blocks)
+	assert.Equal(t, 3, c.Orphans)
+	assert.InDelta(t, 3.0/7, c.OrphanRate, 1e-9)
+	assert.Equal(t, 2, c.Forks)
+	assert.Equal(t, map[int]int{1: 1, 2: 1}, c.ForkDepths)
+	assert.Equal(t, 2, c.MaxDepth)
+	assert.Equal(t, []HeightPoint{{time.Second, 1}, {2 * time.Second, 2}, {3 * time.Second, 3}, {5 * time.Second, 4}}, c.Growth)
+
+	assert.Equal(t, []Miner{{"m1", 4, 4, 40}, {"m2", 3, 0, 0}}, r.Miners)
+
+	assert.Equal(t, Market{
+		Asks: 1, AskSize: 1000,
+		Bids: 2, BidSize: 30,
+		Deals: 2, DealSize: 30,
+		Prices: []PriceCount{{"5", 2}},
+	}, r.Market)
+	assert.Equal(t, Payments{Count: 1, Value: 100, PerMinute: 0.5}, r.Payments)
+
+	require.Len(t, r.Nodes, 4)
+	assert.Equal(t, 2*time.Minute, r.Nodes[0].Uptime)
+	assert.Equal(t, 90*time.Second, r.Nodes[1].Uptime)
+	assert.Equal(t, 1, r.Nodes[1].Faults)
+	assert.Equal(t, 0.75, r.Nodes[1].UpRatio)
+	assert.Equal(t, 70*time.Second, r.Nodes[2].Left)
+	assert.Equal(t, time.Minute, r.Nodes[2].Uptime)
+	assert.Equal(t, 1.0, r.Nodes[2].UpRatio)
+	assert.Equal(t, 20*time.Second, r.Nodes[3].Uptime)
+
+	md := bytes.NewBuffer(nil)
+	require.NoError(t, r.WriteMarkdown(md))
+	assert.Contains(t, md.String(), "| 4 | 7 | 3 | 42.9% | 2 | 2 |")
+	assert.Contains(t, md.String(), "| m1 | 4 | 4 | 40 |")
+
+	js := bytes.NewBuffer(nil)
+	require.NoError(t, r.WriteJSON(js))
+	var back Report
+	require.NoError(t, json.Unmarshal(js.Bytes(), &back))
+	assert.Equal(t, r.Chain, back.Chain)
+}
+
+func TestReportOutOfOrder(t *testing.T) {
+	start := time.Date(2018, 4, 20, 19, 33, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	env := func(typ, from string, s int) events.Envelope {
+		return events.NewEnvelope(typ, from, "all", at(s))
+	}
+
+	// the streams of the nodes interleave: the earliest event comes last.
+	evts := []events.Event{
+		&events.NetworkChurn{Envelope: env(events.TypeMinerJoins, "m1", 5)},
+		&events.NewBlockMined{Envelope: env(events.TypeNewBlockMined, "m1", 10), Block: "a", Parents: []string{"genesis"}, Height: 1, Reward: "10"},
+		&events.NetworkChurn{Envelope: env(events.TypeMinerLeaves, "m1", 20)},
+		&events.NetworkChurn{Envelope: env(events.TypeClientJoins, "c1", 0)},
+	}
+
+	b := NewBuilder()
+	for _, e := range evts {
+		buf, err := json.Marshal(e)
+		require.NoError(t, err)
+		b.Write(append(buf, '\n'))
+	}
+
+	r := b.Report()
+	assert.Equal(t, start, r.Start)
+	assert.Equal(t, []HeightPoint{{10 * time.Second, 1}}, r.Chain.Growth)
+	require.Len(t, r.Nodes, 2)
+	assert.Equal(t, 5*time.Second, r.Nodes[0].Joined)
+	assert.Equal(t, 20*time.Second, r.Nodes[0].Left)
+	assert.Equal(t, time.Duration(0), r.Nodes[1].Joined)
+}
@@ -0,0 +1,204 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	logs "github.com/filecoin-project/filecoin-network-sim/logs"
+	network "github.com/filecoin-project/filecoin-network-sim/network"
+	randfile "github.com/filecoin-project/filecoin-network-sim/randfile"
+)
+
+// LoggerID is the "from" of the ScenarioStep events a Runner logs.
+const LoggerID = "scenario"
+
+// Runner executes a Scenario against a network, logging every step
+// through a SimLogger mixed into the network's logs.
+type Runner struct {
+	Net          *network.Network
+	Scenario     *Scenario
+	TestfilesDir string // for deals without a File
+
+	nodes []*network.Node
+	deals []*network.Deal
+	sl    *logs.SimLogger
+	rand  *rand.Rand
+}
+
+func NewRunner(n *network.Network, s *Scenario, testfilesDir string, seed int64) *Runner {
+	sl := logs.NewEventLogger(LoggerID)
+	n.Logs().MixReader(sl.Reader())
+
+	return &Runner{
+		Net:          n,
+		Scenario:     s,
+		TestfilesDir: testfilesDir,
+		sl:           sl,
+		rand:         network.NewRand(seed),
+	}
+}
+
+// Run executes the steps at their times, in order. Failed steps are
+// logged, and the run carries on. It returns an error if any step failed.
+func (r *Runner) Run(ctx context.Context) error {
+	defer r.sl.Close()
+
+	fmt.Printf("\nRunning scenario %q (%d steps)\n", r.Scenario.Name, len(r.Scenario.Steps))
+
+	start := time.Now()
+	failed := 0
+	for i, st := range r.Scenario.Steps {
+		wait := time.Until(start.Add(time.Duration(st.At)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		log.Printf("[SCEN]\t step %d at %s: %s\n", i, time.Duration(st.At), st.Action)
+		err := r.doStep(ctx, st)
+		if err != nil {
+			log.Printf("[SCEN]\t step %d failed: %s\n", i, err)
+			failed++
+		}
+		r.sl.WriteEvent(logs.ScenarioStepEvent(LoggerID, i, st.Action, err))
+	}
+
+	fmt.Printf("Scenario %q finished: %d/%d steps failed\n", r.Scenario.Name, failed, len(r.Scenario.Steps))
+	if failed > 0 {
+		return fmt.Errorf("%d/%d scenario steps failed", failed, len(r.Scenario.Steps))
+	}
+	return nil
+}
+
+func (r *Runner) doStep(ctx context.Context, st Step) error {
+	switch st.Action {
+	case ActionAddNodes:
+		t, err := network.ParseNodeType(st.Type)
+		if err != nil {
+			return err
+		}
+
+		// one at a time, so node indices follow the scenario.
+		for i := 0; i < st.Count; i++ {
+			nd, err := r.Net.AddNode(t)
+			if err != nil {
+				return err
+			}
+			r.nodes = append(r.nodes, nd)
+		}
+		return nil
+
+	case ActionRemoveNode:
+		nd, err := r.node(st.Node)
+		if err != nil {
+			return err
+		}
+		return r.Net.RemoveNode(nd.ID)
+
+	case ActionConnect:
+		from, err := r.node(st.From)
+		if err != nil {
+			return err
+		}
+		to, err := r.node(st.To)
+		if err != nil {
+			return err
+		}
+		return r.Net.Connect(ctx, from, to)
+
+	case ActionMine:
+		nd, err := r.node(st.Node)
+		if err != nil {
+			return err
+		}
+		return r.Net.MineOnce(ctx, nd)
+
+	case ActionAsk:
+		nd, err := r.node(st.Node)
+		if err != nil {
+			return err
+		}
+		return r.Net.Ask(ctx, nd, st.Size, st.Price)
+
+	case ActionBid:
+		nd, err := r.node(st.Node)
+		if err != nil {
+			return err
+		}
+		return r.Net.Bid(ctx, nd, st.Size, st.Price)
+
+	case ActionDeal:
+		client, err := r.node(st.Client)
+		if err != nil {
+			return err
+		}
+
+		var miner *network.Node
+		if st.Miner != nil {
+			if miner, err = r.node(st.Miner); err != nil {
+				return err
+			}
+		}
+
+		ask, bid, err := r.Net.FindDeal(ctx, client, miner)
+		if err != nil {
+			return err
+		}
+
+		fp := st.File
+		if fp == "" {
+			fp, err = randfile.RandomFile(r.rand, r.TestfilesDir, client.RepoDir())
+			if err != nil {
+				return err
+			}
+		}
+
+		d, err := r.Net.ProposeDeal(ctx, client, ask, bid, fp)
+		if err != nil {
+			return err
+		}
+		r.deals = append(r.deals, d)
+		return nil
+
+	case ActionPayment:
+		from, err := r.node(st.From)
+		if err != nil {
+			return err
+		}
+		to, err := r.node(st.To)
+		if err != nil {
+			return err
+		}
+		return r.Net.Payment(ctx, from, to, st.Amount)
+
+	case ActionRetrieve:
+		client, err := r.node(st.Client)
+		if err != nil {
+			return err
+		}
+		if st.Deal == nil {
+			return fmt.Errorf("no deal given")
+		}
+		if *st.Deal < 0 || *st.Deal >= len(r.deals) {
+			return fmt.Errorf("no deal %d (scenario has made %d)", *st.Deal, len(r.deals))
+		}
+		return r.Net.Retrieve(ctx, client, r.deals[*st.Deal])
+
+	default:
+		return fmt.Errorf("unknown action: %q", st.Action)
+	}
+}
+
+func (r *Runner) node(i *int) (*network.Node, error) {
+	if i == nil {
+		return nil, fmt.Errorf("no node given")
+	}
+	if *i < 0 || *i >= len(r.nodes) {
+		return nil, fmt.Errorf("no node %d (scenario has added %d)", *i, len(r.nodes))
+	}
+	return r.nodes[*i], nil
+}
@@ -0,0 +1,187 @@
+// Package scenario runs scripted simulations: a timeline of steps read
+// from a YAML or JSON file, executed against a network.Network.
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Actions a Step can take.
+const (
+	ActionAddNodes   = "add-nodes"   // Type, Count
+	ActionRemoveNode = "remove-node" // Node
+	ActionConnect    = "connect"     // From, To
+	ActionMine       = "mine"        // Node
+	ActionAsk        = "ask"         // Node, Size, Price
+	ActionBid        = "bid"         // Node, Size, Price
+	ActionDeal       = "deal"        // Client, Miner (optional), File (optional)
+	ActionPayment    = "payment"     // From, To, Amount
+	ActionRetrieve   = "retrieve"    // Client, Deal
+)
+
+// Scenario is a timeline of steps. Nodes are referred to by index, in
+// the order the scenario added them, starting at 0.
+type Scenario struct {
+	Name  string `json:"name" yaml:"name"`
+	Steps []Step `json:"steps" yaml:"steps"`
+}
+
+// Step is one action, taken At some time after the scenario starts.
+// Which of the other fields are used depends on the Action, and those
+// it needs must be set: node indices and deals are pointers, so node 0
+// is told apart from no node.
+type Step struct {
+	At     Duration `json:"at" yaml:"at"`
+	Action string   `json:"action" yaml:"action"`
+
+	Type  string `json:"type,omitempty" yaml:"type,omitempty"`
+	Count int    `json:"count,omitempty" yaml:"count,omitempty"`
+
+	Node   *int `json:"node,omitempty" yaml:"node,omitempty"`
+	From   *int `json:"from,omitempty" yaml:"from,omitempty"`
+	To     *int `json:"to,omitempty" yaml:"to,omitempty"`
+	Client *int `json:"client,omitempty" yaml:"client,omitempty"`
+	Miner  *int `json:"miner,omitempty" yaml:"miner,omitempty"`
+
+	Size   int    `json:"size,omitempty" yaml:"size,omitempty"`
+	Price  int    `json:"price,omitempty" yaml:"price,omitempty"`
+	Amount int    `json:"amount,omitempty" yaml:"amount,omitempty"`
+	File   string `json:"file,omitempty" yaml:"file,omitempty"`
+
+	// Deal is the index of a deal the scenario made, starting at 0.
+	Deal *int `json:"deal,omitempty" yaml:"deal,omitempty"`
+}
+
+// Duration is a time.Duration written as a string, like "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	td, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(td)
+	return nil
+}
+
+// Load reads a scenario file. Files ending in .json are read as JSON,
+// anything else as YAML.
+func Load(path string) (*Scenario, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if filepath.Ext(path) == ".json" {
+		return ParseJSON(buf)
+	}
+	return ParseYAML(buf)
+}
+
+// ParseJSON parses a scenario. Unknown fields are errors, so a typo does
+// not leave a field unset.
+func ParseJSON(buf []byte) (*Scenario, error) {
+	var s Scenario
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, s.validate()
+}
+
+// ParseYAML parses a scenario. Unknown fields are errors, as in ParseJSON.
+func ParseYAML(buf []byte) (*Scenario, error) {
+	var s Scenario
+	if err := yaml.UnmarshalStrict(buf, &s); err != nil {
+		return nil, err
+	}
+	return &s, s.validate()
+}
+
+// validate checks the steps, and sorts them by time. Steps at the same
+// time keep their order in the file.
+func (s *Scenario) validate() error {
+	for i, st := range s.Steps {
+		if err := st.validate(); err != nil {
+			return fmt.Errorf("step %d: %s", i, err)
+		}
+		if st.At < 0 {
+			return fmt.Errorf("step %d: negative time: %s", i, time.Duration(st.At))
+		}
+	}
+
+	sort.SliceStable(s.Steps, func(i, j int) bool {
+		return s.Steps[i].At < s.Steps[j].At
+	})
+	return nil
+}
+
+// validate checks that the fields the action needs are set.
+func (st Step) validate() error {
+	var missing []string
+	need := func(set bool, field string) {
+		if !set {
+			missing = append(missing, field)
+		}
+	}
+
+	switch st.Action {
+	case ActionAddNodes:
+		need(st.Count > 0, "count")
+	case ActionRemoveNode, ActionMine:
+		need(st.Node != nil, "node")
+	case ActionConnect:
+		need(st.From != nil, "from")
+		need(st.To != nil, "to")
+	case ActionAsk, ActionBid:
+		need(st.Node != nil, "node")
+		need(st.Size > 0, "size")
+		need(st.Price > 0, "price")
+	case ActionDeal:
+		need(st.Client != nil, "client")
+	case ActionPayment:
+		need(st.From != nil, "from")
+		need(st.To != nil, "to")
+		need(st.Amount > 0, "amount")
+	case ActionRetrieve:
+		need(st.Client != nil, "client")
+		need(st.Deal != nil, "deal")
+	default:
+		return fmt.Errorf("unknown action: %q", st.Action)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%s needs %s", st.Action, strings.Join(missing, ", "))
+	}
+	return nil
+}
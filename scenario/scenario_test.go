@@ -0,0 +1,192 @@
+package scenario
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	network "github.com/filecoin-project/filecoin-network-sim/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testYAML = `
+name: test deal
+steps:
+  - at: 0s
+    action: add-nodes
+    type: Client
+    count: 1
+  - at: 0s
+    action: add-nodes
+    type: Miner
+    count: 1
+  - at: 50ms
+    action: mine
+    node: 1
+  - at: 100ms
+    action: ask
+    node: 1
+    size: 1000
+    price: 5
+  - at: 50ms
+    action: mine
+    node: 0
+  - at: 150ms
+    action: bid
+    node: 0
+    size: 10
+    price: 10
+  - at: 200ms
+    action: deal
+    client: 0
+    miner: 1
+  - at: 250ms
+    action: payment
+    from: 1
+    to: 0
+    amount: 10
+  - at: 300ms
+    action: retrieve
+    client: 0
+    deal: 0
+`
+
+const testJSON = `{
+  "name": "test deal",
+  "steps": [
+    {"at": "0s", "action": "add-nodes", "type": "Client", "count": 1},
+    {"at": "0s", "action": "add-nodes", "type": "Miner", "count": 1},
+    {"at": "50ms", "action": "mine", "node": 1},
+    {"at": "100ms", "action": "ask", "node": 1, "size": 1000, "price": 5},
+    {"at": "50ms", "action": "mine", "node": 0},
+    {"at": "150ms", "action": "bid", "node": 0, "size": 10, "price": 10},
+    {"at": "200ms", "action": "deal", "client": 0, "miner": 1},
+    {"at": "250ms", "action": "payment", "from": 1, "to": 0, "amount": 10},
+    {"at": "300ms", "action": "retrieve", "client": 0, "deal": 0}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	require := require.New(t)
+
+	sy, err := ParseYAML([]byte(testYAML))
+	require.NoError(err)
+	sj, err := ParseJSON([]byte(testJSON))
+	require.NoError(err)
+	require.Equal(sy, sj)
+
+	// sorted by time, keeping file order for equal times.
+	require.Len(sy.Steps, 9)
+	require.Equal(ActionAddNodes, sy.Steps[0].Action)
+	require.Equal("Client", sy.Steps[0].Type)
+	require.Equal(ActionMine, sy.Steps[2].Action)
+	require.Equal(1, *sy.Steps[2].Node)
+	require.Equal(ActionMine, sy.Steps[3].Action)
+	require.Equal(0, *sy.Steps[3].Node)
+	require.Equal(Duration(200*time.Millisecond), sy.Steps[6].At)
+	require.Equal(1, *sy.Steps[6].Miner)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := ParseYAML([]byte("steps:\n  - {at: 1s, action: fly}\n"))
+	assert.Error(t, err)
+
+	_, err = ParseYAML([]byte("steps:\n  - {at: -1s, action: mine}\n"))
+	assert.Error(t, err)
+
+	_, err = ParseYAML([]byte("steps:\n  - {at: 1s, action: add-nodes}\n"))
+	assert.Error(t, err)
+
+	_, err = ParseJSON([]byte(`{"steps": [{"at": "soon", "action": "mine", "node": 0}]}`))
+	assert.Error(t, err)
+
+	// typos, and fields an action needs that are not set.
+	_, err = ParseYAML([]byte("steps:\n  - {at: 1s, action: payment, from: 0, to: 1, ammount: 10}\n"))
+	assert.Error(t, err)
+	_, err = ParseJSON([]byte(`{"steps": [{"at": "1s", "action": "deal", "cleint": 0}]}`))
+	assert.Error(t, err)
+	_, err = ParseYAML([]byte("steps:\n  - {at: 1s, action: payment, from: 0, to: 1}\n"))
+	assert.EqualError(t, err, "step 0: payment needs amount")
+	_, err = ParseYAML([]byte("steps:\n  - {at: 1s, action: mine}\n"))
+	assert.EqualError(t, err, "step 0: mine needs node")
+	_, err = ParseYAML([]byte("steps:\n  - {at: 1s, action: mine, node: 0}\n"))
+	assert.NoError(t, err)
+}
+
+func TestRunner(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "scenario test")
+	require.NoError(err)
+	net := network.NewNetworkWithBackend(dir, network.NewFakeChain().NewBackend)
+	defer net.ShutdownAll()
+
+	s, err := ParseYAML([]byte(testYAML))
+	require.NoError(err)
+
+	r := NewRunner(net, s, "../demos/testfiles", 1)
+	events := readEvents(net.Logs().Reader())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(r.Run(ctx))
+	require.Equal(2, net.Size())
+
+	want := []string{"NewBlockMined", "AddAsk", "AddBid", "MakeDeal", "SendPayment", "RetrieveFile"}
+	sawAll := func(seen map[string]bool) bool {
+		for _, typ := range want {
+			if !seen[typ] {
+				return false
+			}
+		}
+		return true
+	}
+
+	steps := 0
+	seen := map[string]bool{}
+	for steps < len(s.Steps) || !sawAll(seen) {
+		select {
+		case m := <-events:
+			typ, _ := m["type"].(string)
+			seen[typ] = true
+			if typ == "ScenarioStep" {
+				require.Nil(m["error"], "step %v", m["step"])
+				steps++
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out: saw %d steps, and events %v", steps, seen)
+		}
+	}
+}
+
+func TestRunnerBadNode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scenario test")
+	require.NoError(t, err)
+	net := network.NewNetworkWithBackend(dir, network.NewFakeChain().NewBackend)
+	defer net.ShutdownAll()
+
+	s, err := ParseYAML([]byte("steps:\n  - {at: 0s, action: mine, node: 3}\n"))
+	require.NoError(t, err)
+
+	go io.Copy(ioutil.Discard, net.Logs().Reader())
+	assert.Error(t, NewRunner(net, s, "", 1).Run(context.Background()))
+}
+
+func readEvents(r io.Reader) <-chan map[string]interface{} {
+	events := make(chan map[string]interface{}, 1024)
+	go func() {
+		d := json.NewDecoder(r)
+		for {
+			var m map[string]interface{}
+			if err := d.Decode(&m); err != nil {
+				return
+			}
+			events <- m
+		}
+	}()
+	return events
+}